@@ -2,14 +2,18 @@ package main
 
 import (
 	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/backtest"
 	"Hyflip-Server/internal/cache"
 	"Hyflip-Server/internal/config"
 	"Hyflip-Server/internal/env"
 	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/portfolio"
 	"Hyflip-Server/internal/routes"
 	"Hyflip-Server/internal/storage"
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/labstack/echo/v4"
 	"io"
 	"log"
@@ -32,13 +36,13 @@ func main() {
 	defer logFile.Close()
 	// Init env
 	env.InitEnv()
-	key := os.Getenv(env.INTERNAL_HYPIXEL_API_KEY)
-	if key == "" {
+	keys := env.HypixelApiKeys()
+	if len(keys) == 0 {
 		panic("Internal Hypixel API key not found in env.")
 	}
 
 	// Init API client
-	cl := api.Init(key)
+	cl := api.Init(keys, api.OptionsFromEnv()...)
 	checkKey(cl)
 
 	// Init DB
@@ -48,11 +52,14 @@ func main() {
 	configTable := storage.InitConfigTable(userDb)
 	defer configTable.Close()
 	log.Println("Initialized config table.")
+	historyTable := storage.InitBazaarHistoryTable(userDb, 30*24*time.Hour)
+	log.Println("Initialized bazaar history table.")
+	cl.UseLocalHistory(historyTable, flippers.PriceHistoryTimeSpan)
 
 	// Register routes
 	e := echo.New()
 	e.HideBanner = true
-	routes.RegisterRoutes(e, userDb, cl, configTable, nil)
+	routes.RegisterRoutes(e, userDb, cl, configTable, historyTable, nil, nil, nil, nil)
 	log.Println("Registered routes.")
 
 	// Start echo in a goroutine so we don't block our command loop ;3
@@ -71,22 +78,23 @@ func main() {
 
 	cacheTime := time.Now()
 	log.Println("Creating cache...")
-	bzCache := cache.NewBazaarCache(cl, time.Second*20)
+	bzCache := cache.NewBazaarCache(cl, time.Second*20, cache.WithRecorder(historyTable))
 	log.Println("Cache created in " + time.Now().Sub(cacheTime).String() + ".")
 
-	commandLoop(cl, hash, configTable, bzCache)
+	commandLoop(cl, hash, configTable, historyTable, bzCache)
 }
 
 func checkKey(cl *api.HypixelApiClient) {
 	valid, err := api.CheckApiKey(cl)
-	if err != nil {
+	if err != nil && !valid {
 		panic(err)
 	}
 
 	if valid {
-		log.Println("API Key is valid. Proceeding...")
+		log.Printf("%d/%d API Keys are valid. Proceeding...\n", cl.Keys.Healthy(), len(cl.Keys.All()))
+		api.StartKeyRecovery(cl, 10*time.Minute)
 	} else {
-		panic("api key is invalid")
+		panic("every api key is invalid")
 	}
 }
 
@@ -108,7 +116,7 @@ func loadConfigs(token string, configTable *storage.ConfigTableClient) (*config.
 	return configTable.GetConfig(token)
 }
 
-func commandLoop(cl *api.HypixelApiClient, hash string, configTable *storage.ConfigTableClient, bzCache *cache.BazaarCache) {
+func commandLoop(cl *api.HypixelApiClient, hash string, configTable *storage.ConfigTableClient, historyTable *storage.BazaarHistoryTable, bzCache *cache.BazaarCache) {
 	time.Sleep(230 * time.Millisecond) // for our > to LIKELY appear below the 'http server started at'
 	reader := bufio.NewReader(os.Stdin)
 
@@ -155,13 +163,165 @@ func commandLoop(cl *api.HypixelApiClient, hash string, configTable *storage.Con
 			}
 
 			log.Println("Flipping complete in ", time.Since(timeStart))
+		case strings.HasPrefix(line, "portfolio "):
+			req, err := parsePortfolioArgs(strings.Fields(line)[1:])
+			if err != nil {
+				log.Println("Usage: portfolio <purse> <slots> [risk 0-1] [horizon hours]. Error: " + err.Error())
+				continue
+			}
+			conf, err := loadConfigs(hash, configTable)
+			if err != nil {
+				log.Println("Error loading config. Error: " + err.Error())
+				continue
+			}
+
+			flips := flippers.FilterFlips(bzCache.Get(), &conf.BzConfig)
+			plan, err := portfolio.Optimize(flips, req)
+			if err != nil {
+				log.Println("Could not plan portfolio. Error: " + err.Error())
+				continue
+			}
+			for _, a := range plan.Allocations {
+				log.Printf("%s x%d. Capital: %.0f. Expected profit: %.0f (risk %.2f, ~%.1fh)\n", a.ProductID, a.Volume, a.CapitalLocked, a.ExpectedProfit, a.Risk, a.FillHours)
+			}
+			log.Printf("Plan: %d/%d flips, %.0f capital locked, %.0f expected profit (%.2f%%).\n", plan.SlotsUsed, plan.ConsideredFlips, plan.CapitalLocked, plan.ExpectedProfit, plan.ExpectedReturnPercentage)
+		case strings.HasPrefix(line, "backtest "):
+			req, err := parseBacktestArgs(strings.Fields(line)[1:])
+			if err != nil {
+				log.Println("Usage: backtest <from> <to> <purse> <slots> [step minutes] (dates as 2006-01-02 or RFC 3339). Error: " + err.Error())
+				continue
+			}
+			conf, err := loadConfigs(hash, configTable)
+			if err != nil {
+				log.Println("Error loading config. Error: " + err.Error())
+				continue
+			}
+
+			timeStart := time.Now()
+			report, err := backtest.Run(context.Background(), historyTable, &conf.BzConfig, req)
+			if err != nil {
+				log.Println("Could not backtest. Error: " + err.Error())
+				continue
+			}
+			for _, p := range report.Products {
+				log.Printf("%s: %d trades, %d wins, %.0f PnL\n", p.ProductID, p.Trades, p.Wins, p.PnL)
+			}
+			log.Printf("Replayed %d snapshots in %s.\n", report.Snapshots, time.Since(timeStart))
+			log.Printf("PnL: %.0f (%.2f%%). Realized: %.0f, unrealized: %.0f over %d open positions.\n", report.PnL, report.ReturnPercentage, report.RealizedPnL, report.UnrealizedPnL, report.OpenPositions)
+			log.Printf("Trades: %d, hit rate %.1f%%, %d cancelled, %d relisted, %d stopped as manipulated.\n", report.Trades, report.HitRatePercentage, report.Cancelled, report.Relisted, report.ManipulationRejections)
+			log.Printf("Capital: %.0f peak, %.0f average (%.1f%% of the purse). Max drawdown: %.0f (%.2f%%).\n", report.PeakCapital, report.AverageCapital, report.CapitalUsePercentage, report.MaxDrawdown, report.MaxDrawdownPercentage)
+		case strings.HasPrefix(line, "tune "):
+			req, err := parseTuneArgs(strings.Fields(line)[1:])
+			if err != nil {
+				log.Println("Usage: tune <from> <to> <purse> <slots> [grid|random] [samples] (dates as 2006-01-02 or RFC 3339). Error: " + err.Error())
+				continue
+			}
+			conf, err := loadConfigs(hash, configTable)
+			if err != nil {
+				log.Println("Error loading config. Error: " + err.Error())
+				continue
+			}
+
+			timeStart := time.Now()
+			tuning, err := backtest.Tune(context.Background(), historyTable, &conf.BzConfig, req)
+			if err != nil {
+				log.Println("Could not tune. Error: " + err.Error())
+				continue
+			}
+			log.Printf("Tried %d configs in %s (%d ruled out). Current config: %.0f/h, %.0f PnL, %d trades.\n", tuning.Candidates, time.Since(timeStart), tuning.RuledOut, tuning.Baseline.Report.ProfitPerHour, tuning.Baseline.Report.PnL, tuning.Baseline.Report.Trades)
+			for i, result := range tuning.Results {
+				log.Printf("#%d %v: %.0f/h, %.0f PnL, %d trades (%.1f%% hit rate), %.1f flips per cycle.\n", i+1, result.Params, result.Report.ProfitPerHour, result.Report.PnL, result.Report.Trades, result.Report.HitRatePercentage, result.Report.FlipsPerCycle)
+			}
+			if len(tuning.Results) > 0 {
+				best, _ := json.Marshal(tuning.Results[0].Config)
+				log.Println("Best config (PUT it to /api/config/bz): " + string(best))
+			}
 		case line == "exit":
 			log.Println("Exiting...")
 			return
 		default:
-			log.Println("Unknown command. Available: cracc <username>, bzflip, exit")
+			log.Println("Unknown command. Available: cracc <username>, bzflip, portfolio <purse> <slots> [risk] [horizon], backtest <from> <to> <purse> <slots> [step], tune <from> <to> <purse> <slots> [search] [samples], exit")
+		}
+	}
+}
+
+// parsePortfolioArgs purse, slots, then optionally risk tolerance and horizon in hours.
+func parsePortfolioArgs(args []string) (portfolio.Request, error) {
+	req := portfolio.Request{RiskTolerance: 0.5, HorizonHours: 24}
+	if len(args) < 2 {
+		return req, errors.New("purse and slots are required")
+	}
+	var err error
+	if req.Purse, err = strconv.ParseFloat(args[0], 64); err != nil {
+		return req, err
+	}
+	if req.Slots, err = strconv.Atoi(args[1]); err != nil {
+		return req, err
+	}
+	if len(args) > 2 {
+		if req.RiskTolerance, err = strconv.ParseFloat(args[2], 64); err != nil {
+			return req, err
+		}
+	}
+	if len(args) > 3 {
+		if req.HorizonHours, err = strconv.ParseFloat(args[3], 64); err != nil {
+			return req, err
 		}
 	}
+	return req, req.Validate()
+}
+
+// parseBacktestArgs from, to, purse and slots, then optionally the step in minutes.
+func parseBacktestArgs(args []string) (backtest.Request, error) {
+	var req backtest.Request
+	if len(args) < 4 {
+		return req, errors.New("from, to, purse and slots are required")
+	}
+	var err error
+	if req.From, err = parseTime(args[0]); err != nil {
+		return req, err
+	}
+	if req.To, err = parseTime(args[1]); err != nil {
+		return req, err
+	}
+	if req.Purse, err = strconv.ParseFloat(args[2], 64); err != nil {
+		return req, err
+	}
+	if req.Slots, err = strconv.Atoi(args[3]); err != nil {
+		return req, err
+	}
+	if len(args) > 4 {
+		if req.StepMinutes, err = strconv.ParseFloat(args[4], 64); err != nil {
+			return req, err
+		}
+	}
+	return req, req.Validate()
+}
+
+// parseTuneArgs the same as parseBacktestArgs, then optionally the search and how many samples.
+func parseTuneArgs(args []string) (backtest.TuneRequest, error) {
+	var req backtest.TuneRequest
+	var err error
+	if req.Request, err = parseBacktestArgs(args[:min(len(args), 4)]); err != nil {
+		return req, err
+	}
+	if len(args) > 4 {
+		req.Search = args[4]
+	}
+	if len(args) > 5 {
+		if req.Samples, err = strconv.Atoi(args[5]); err != nil {
+			return req, err
+		}
+	}
+	return req, req.Validate()
+}
+
+// parseTime a date (midnight UTC) or an RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
 }
 
 // createAccount - convenience sake.
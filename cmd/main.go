@@ -4,12 +4,20 @@ import (
 	"Hyflip-Server/internal/api"
 	"Hyflip-Server/internal/cache"
 	"Hyflip-Server/internal/env"
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/minions"
+	"Hyflip-Server/internal/recipes"
 	"Hyflip-Server/internal/routes"
 	"Hyflip-Server/internal/storage"
+	"context"
+	"errors"
 	"github.com/labstack/echo/v4"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -19,8 +27,8 @@ func main() {
 	defer logFile.Close()
 	// Init env
 	env.InitEnv()
-	key := os.Getenv(env.INTERNAL_HYPIXEL_API_KEY)
-	if key == "" {
+	keys := env.HypixelApiKeys()
+	if len(keys) == 0 {
 		panic("Internal Hypixel API key not found in env.")
 	}
 
@@ -31,37 +39,114 @@ func main() {
 	configTable := storage.InitConfigTable(userDb)
 	defer configTable.Close()
 	log.Println("Initialized config table.")
+	historyTable := storage.InitBazaarHistoryTable(userDb, 30*24*time.Hour)
+	log.Println("Initialized bazaar history table.")
 
-	cl, bzCache := finishApiCalls(key)
+	cl, bzCache := finishApiCalls(keys, historyTable)
+	// every flip type prices off the bazaar cache's latest poll, the first cycles just fail until it has polled once
+	flipCaches := cache.NewRegistry()
+	flipCaches.Add(bzCache)
+	items := flippers.NewItemCatalog(cl)
+	flipCaches.Add(cache.NewFlipCache(&flippers.NpcFlipper{Items: items, Products: bzCache.Products}, time.Second*20))
+	if craft := craftFlipper(cl, bzCache); craft != nil {
+		flipCaches.Add(cache.NewFlipCache(craft, time.Minute))
+	}
+	if forge := forgeFlipper(cl, bzCache); forge != nil {
+		flipCaches.Add(cache.NewFlipCache(forge, time.Minute))
+	}
 	// Register routes
 	e := echo.New()
 	e.HideBanner = true
-	routes.RegisterRoutes(e, userDb, cl, configTable, bzCache)
+	routes.RegisterRoutes(e, userDb, cl, configTable, historyTable, bzCache, flipCaches, items, loadMinions())
 	log.Println("Registered routes.")
 
-	e.Logger.Fatal(e.Start(":3000"))
+	go func() {
+		if err := e.Start(":3000"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// wait for ctrl+c, then cancel whatever the cache is fetching and let SSE clients go
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down...")
+	flipCaches.StopAll()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down server. Error: " + err.Error())
+	}
 }
 
-func finishApiCalls(key string) (*api.HypixelApiClient, *cache.BazaarCache) {
+func finishApiCalls(keys []string, historyTable *storage.BazaarHistoryTable) (*api.HypixelApiClient, *cache.BazaarCache) {
 	// Init API client
-	cl := api.Init(key)
+	cl := api.Init(keys, api.OptionsFromEnv()...)
 	verifyKey(cl)
+	// our own recordings beat NEU once we have them
+	cl.UseLocalHistory(historyTable, flippers.PriceHistoryTimeSpan)
 
 	// Finish getting cache
-	bzCache := cache.NewBazaarCache(cl, time.Second*20)
+	bzCache := cache.NewBazaarCache(cl, time.Second*20, cache.WithRecorder(historyTable))
 	return cl, bzCache
 }
 
+// craftFlipper loads the NEU repo recipes. Without them craft flips are just off, nothing else cares.
+func craftFlipper(cl *api.HypixelApiClient, bzCache *cache.BazaarCache) *flippers.CraftFlipper {
+	dir := os.Getenv(env.NEU_REPO_DIR)
+	if dir == "" {
+		dir = recipes.DefaultRepoDir
+	}
+	book, err := recipes.LoadNeuRepo(dir)
+	if err != nil {
+		log.Println("Could not load recipes, craft flips are disabled. Error: " + err.Error())
+		return nil
+	}
+	log.Printf("Loaded recipes of %d items.\n", len(book.Recipes))
+	return &flippers.CraftFlipper{Api: cl, Book: book, Products: bzCache.Products}
+}
+
+// forgeFlipper same deal as craftFlipper, for the forge recipes file.
+func forgeFlipper(cl *api.HypixelApiClient, bzCache *cache.BazaarCache) *flippers.ForgeFlipper {
+	file := os.Getenv(env.FORGE_RECIPES_FILE)
+	if file == "" {
+		file = recipes.DefaultForgeFile
+	}
+	forgeRecipes, err := recipes.LoadForgeRecipes(file)
+	if err != nil {
+		log.Println("Could not load forge recipes, forge flips are disabled. Error: " + err.Error())
+		return nil
+	}
+	log.Printf("Loaded %d forge recipes.\n", len(forgeRecipes))
+	return &flippers.ForgeFlipper{Api: cl, Recipes: forgeRecipes, Products: bzCache.Products}
+}
+
+// loadMinions the minion definitions. nil just turns /api/minions off.
+func loadMinions() *minions.Definitions {
+	file := os.Getenv(env.MINIONS_FILE)
+	if file == "" {
+		file = minions.DefaultDefinitionsFile
+	}
+	defs, err := minions.LoadDefinitions(file)
+	if err != nil {
+		log.Println("Could not load minion definitions, minions are disabled. Error: " + err.Error())
+		return nil
+	}
+	log.Printf("Loaded %d minions.\n", len(defs.Minions))
+	return defs
+}
+
 func verifyKey(cl *api.HypixelApiClient) {
 	valid, err := api.CheckApiKey(cl)
-	if err != nil {
+	if err != nil && !valid {
 		panic(err)
 	}
 
 	if valid {
-		log.Println("API Key is valid. Proceeding...")
+		log.Printf("%d/%d API Keys are valid. Proceeding...\n", cl.Keys.Healthy(), len(cl.Keys.All()))
+		api.StartKeyRecovery(cl, 10*time.Minute)
 	} else {
-		panic("api key is invalid")
+		panic("every api key is invalid")
 	}
 }
 
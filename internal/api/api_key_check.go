@@ -1,8 +1,10 @@
 package api
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"errors"
+	"log"
+	"time"
 )
 
 type ValidKeyBody struct {
@@ -10,25 +12,60 @@ type ValidKeyBody struct {
 	Cause   string `json:"cause"`
 }
 
-// CheckApiKey - Validate an API key.
+// CheckApiKey - Validate every API key in the pool. Invalid ones are taken out of rotation, valid ones put (back) in.
+// Returns true as long as at least one key is healthy.
 func CheckApiKey(cl *HypixelApiClient) (bool, error) {
-	var jsonDecodedBody ValidKeyBody
-	// Note: NOT a valid endpoint in Hypixel API v2. But we could use literally anything else and it'd tell us if the API key is invalid or not, so works.
-	err := cl.Get(BaseApiUrl+"key", &jsonDecodedBody)
-	if err != nil {
-		if !strings.Contains(err.Error(), "invalid status") {
-			return false, err
+	var lastErr error
+	for _, key := range cl.Keys.All() {
+		valid, err := checkKey(cl, key)
+		if err != nil {
+			// couldn't tell. leave the key as it is
+			log.Println("Could not check API key " + keyLabel(key) + ". Error: " + err.Error())
+			lastErr = err
+			continue
 		}
-	}
 
-	if jsonDecodedBody.Success {
-		return false, fmt.Errorf("this should not be successful... what")
-	} else {
-		// status code would be better but meh
-		if strings.Contains(jsonDecodedBody.Cause, "Invalid") {
-			return false, fmt.Errorf("invalid api key")
+		if valid {
+			cl.Keys.MarkHealthy(key)
+		} else {
+			log.Println("API key " + keyLabel(key) + " is invalid.")
+			cl.Keys.MarkInvalid(key)
 		}
 	}
 
+	if cl.Keys.Healthy() == 0 {
+		return false, lastErr
+	}
 	return true, nil
 }
+
+// StartKeyRecovery rechecks the invalid keys every `interval` and puts them back into rotation if Hypixel accepts them again. Runs forever.
+func StartKeyRecovery(cl *HypixelApiClient, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for _, key := range cl.Keys.Invalid() {
+				if valid, err := checkKey(cl, key); err == nil && valid {
+					log.Println("API key " + keyLabel(key) + " recovered.")
+					cl.Keys.MarkHealthy(key)
+				}
+			}
+		}
+	}()
+}
+
+// checkKey validates a single key. A 403 means the key is bad, anything else that made it to Hypixel means it's fine.
+func checkKey(cl *HypixelApiClient, key string) (bool, error) {
+	var jsonDecodedBody ValidKeyBody
+	// Note: NOT a valid endpoint in Hypixel API v2. But we could use literally anything else and it'd tell us if the API key is invalid or not, so works.
+	err := cl.getWithKey(context.Background(), cl.Endpoints.Hypixel+"key", key, &jsonDecodedBody)
+	switch {
+	case err == nil, errors.Is(err, ErrNotFound), errors.Is(err, ErrRateLimited):
+		// rate limits are per key, so being rate limited means the key exists
+		return true, nil
+	case errors.Is(err, ErrInvalidKey):
+		return false, nil
+	}
+	return false, err
+}
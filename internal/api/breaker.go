@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen returned without sending anything while an upstream's circuit breaker is open. Also matches ErrUpstreamUnavailable.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker open: %w", ErrUpstreamUnavailable)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker one per upstream. After `threshold` transient failures in a row every request fails fast with ErrCircuitOpen
+// for `cooldown`, then a single probe is let through: success closes it again, failure re-opens it.
+// Saves us from spending a goroutine-second on each of hundreds of doomed calls when e.g. NEU is down.
+type CircuitBreaker struct {
+	name      string
+	lock      sync.Mutex
+	state     breakerState
+	failures  int
+	threshold int
+	cooldown  time.Duration
+	openedAt  time.Time
+	// probing a half-open probe is in flight. everyone else still fails fast
+	probing bool
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow returns ErrCircuitOpen if the request shouldn't be sent.
+func (b *CircuitBreaker) Allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state != breakerClosed {
+		log.Println("Circuit breaker for " + b.name + " closed again.")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Println("Circuit breaker for " + b.name + " opened. Failing fast for " + b.cooldown.String() + ".")
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Cancel releases an allowed request that was given up on before it said anything about the upstream. A cancelled probe lets
+// the next request probe instead, without counting as a failure.
+func (b *CircuitBreaker) Cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+// Open whether requests are currently being refused.
+func (b *CircuitBreaker) Open() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.cooldown
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// f = failure, s = success, c = cancel, w = wait out the cooldown, a = allowed, x = refused
+	tests := []struct {
+		name     string
+		steps    string
+		wantOpen bool
+	}{
+		{"closed below the threshold", "fa", false},
+		{"opens at the threshold", "ffx", true},
+		{"success resets the count", "fsfa", false},
+		{"half-open lets one probe through", "ffwax", false},
+		{"probe success closes it", "ffwasaa", false},
+		{"probe failure opens it again", "ffwafx", true},
+		{"cancelled probe lets the next one probe", "ffwacax", false},
+		{"cancel while closed changes nothing", "fcfx", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 2, 20*time.Millisecond)
+			for i, step := range tt.steps {
+				switch step {
+				case 'f':
+					b.Failure()
+				case 's':
+					b.Success()
+				case 'c':
+					b.Cancel()
+				case 'w':
+					time.Sleep(30 * time.Millisecond)
+				case 'a', 'x':
+					err := b.Allow()
+					if allowed := err == nil; allowed != (step == 'a') {
+						t.Fatalf("step %d: Allow() = %v", i, err)
+					}
+					if err != nil && !errors.Is(err, ErrUpstreamUnavailable) {
+						t.Fatalf("step %d: Allow() = %v, want it to count as unavailable", i, err)
+					}
+				}
+			}
+			expect(t, "Open()", b.Open(), tt.wantOpen)
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, 10*time.Millisecond)
+	b.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Allow() == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	expect(t, "probes let through", allowed.Load(), int32(1))
+}
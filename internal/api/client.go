@@ -1,54 +1,330 @@
 package api
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github.com/bytedance/sonic"
 	"github.com/valyala/fasthttp"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// HypixelApiClient - One client per API key. Name is kind of misleading lol, this client is also used for all kind of other reqs.
+// Transport is whatever actually sends our requests. *fasthttp.Client satisfies it, and so do the record/replay transports
+// in transport.go. Swap it out to run against anything that isn't the real internet.
+type Transport interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+}
+
+// HypixelApiClient - Name is kind of misleading lol, this client is also used for all kind of other reqs.
 type HypixelApiClient struct {
-	ApiKey string
-	Client *fasthttp.Client
+	// Keys every internal API key. Hypixel requests rotate through the healthy ones
+	Keys      *KeyPool
+	Client    Transport
+	Endpoints Endpoints
+	// Limits every request waits here for its turn. See rate_limit.go
+	Limits *Scheduler
+	// Retry how transient failures are retried. See retry.go
+	Retry RetryPolicy
+	// PriceHistory in-memory price history (ours or NEU's), see price_history_store.go
+	PriceHistory *PriceHistoryStore
+	// LocalHistory our own recorded price history. Preferred over NEU when set (see UseLocalHistory). LocalHistorySpan how much
+	// of it the PriceHistory keeps per product
+	LocalHistory     PriceHistorySource
+	LocalHistorySpan time.Duration
+	// CallTimeout deadline for a single attempt (not counting time spent waiting for the rate limiter)
+	CallTimeout time.Duration
+	// breakers one per upstream (see breaker.go). only written during Init
+	breakers map[string]*CircuitBreaker
+}
+
+// ClientOption changes how Init builds the client.
+type ClientOption func(cl *HypixelApiClient)
+
+// WithEndpoints overrides the upstream urls. Empty urls keep their defaults.
+func WithEndpoints(endpoints Endpoints) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.Endpoints = endpoints.withDefaults()
+	}
+}
+
+// WithCallTimeout changes the per-attempt deadline.
+func WithCallTimeout(timeout time.Duration) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.CallTimeout = timeout
+	}
+}
+
+// WithPriceHistoryTtl changes how long price history stays in memory before it's refetched.
+func WithPriceHistoryTtl(ttl time.Duration) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.PriceHistory = NewPriceHistoryStore(cl, ttl)
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.Retry = policy
+	}
+}
+
+// WithCircuitBreaker changes when an upstream's breaker opens (`threshold` failures in a row) and for how long.
+func WithCircuitBreaker(upstream string, threshold int, cooldown time.Duration) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.breakers[upstream] = NewCircuitBreaker(upstream, threshold, cooldown)
+	}
+}
+
+// WithTransport replaces the default fasthttp client.
+func WithTransport(transport Transport) ClientOption {
+	return func(cl *HypixelApiClient) {
+		cl.Client = transport
+	}
 }
 
-func Init(apiKey string) *HypixelApiClient {
+func Init(apiKeys []string, opts ...ClientOption) *HypixelApiClient {
 	client := &fasthttp.Client{
 		MaxConnsPerHost: 1000, // LIVE connections per host. 10 is arbitrary for now
 	}
-	// Per Host also means Per API Key here since we're creating a new client for EVERY Api Key
-	return &HypixelApiClient{
-		ApiKey: apiKey,
-		Client: client,
+	// one client shared by every key. the keys are rate limited separately by the scheduler anyway
+	cl := &HypixelApiClient{
+		Keys:        NewKeyPool(apiKeys),
+		Client:      client,
+		Endpoints:   DefaultEndpoints(),
+		Limits:      NewScheduler(),
+		Retry:       DefaultRetryPolicy(),
+		CallTimeout: 15 * time.Second,
+		breakers:    make(map[string]*CircuitBreaker),
+	}
+	for _, upstream := range []string{UpstreamHypixel, UpstreamMojang, UpstreamPriceTracker, UpstreamMoulberry, ""} {
+		cl.breakers[upstream] = NewCircuitBreaker(upstream, 5, 30*time.Second)
 	}
-	// every API Key is... well, one API key since for now we're only using the internal API Key without support for user API Keys so yeah.
+	cl.PriceHistory = NewPriceHistoryStore(cl, 5*time.Minute)
+	for _, opt := range opts {
+		opt(cl)
+	}
+	return cl
 }
 
 // Get is used to send requests efficiently (and without boilerplate) to (theoretically) ANY url. It sets the API key header, and if successful with the request, uses `dst` to unmarshall the data so you can handle any further errors yourself.
+// Every request waits for the rate limiter of its upstream first, and 429s are waited out (a few times) instead of failing straight away.
+// Network errors and 5xx are retried with backoff (see retry.go) unless the upstream's circuit breaker is open.
 func (cl *HypixelApiClient) Get(url string, dst any) error {
+	return cl.GetCtx(context.Background(), url, dst)
+}
+
+// GetCtx is Get, but gives up (waiting, retrying or mid-request) as soon as ctx is done.
+func (cl *HypixelApiClient) GetCtx(ctx context.Context, url string, dst any) error {
+	return cl.getWithKey(ctx, url, "", dst)
+}
+
+// getWithKey is GetCtx but always with `key` instead of one from the pool (if not empty).
+func (cl *HypixelApiClient) getWithKey(ctx context.Context, url string, key string, dst any) error {
+	upstream := cl.upstreamOf(url)
+	return cl.call(ctx, url, key, nil, decodeInto(upstream, url, dst))
+}
+
+// PostCtx sends `body` as json and decodes the (200) response into dst. Same rate limiting/retries as GetCtx.
+func (cl *HypixelApiClient) PostCtx(ctx context.Context, url string, body any, dst any) error {
+	payload, err := sonic.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return cl.call(ctx, url, "", payload, decodeInto(cl.upstreamOf(url), url, dst))
+}
+
+// decodeInto is the response handler for Get/Post: anything but a 200 is an error, a 200 gets unmarshalled into dst.
+func decodeInto(upstream string, url string, dst any) func(resp *fasthttp.Response) error {
+	return func(resp *fasthttp.Response) error {
+		if resp.StatusCode() >= 500 {
+			log.Println("Encountered status code " + strconv.Itoa(resp.StatusCode()) + " for url " + url)
+		}
+
+		if resp.StatusCode() != 200 { // might need to change in future; 200 is a bit too general but works for pricechecker & hypixel api for now.
+			return newStatusError(upstream, url, resp)
+		}
+
+		// sonic is MUCH faster. uses SIMD.
+		if err := sonic.Unmarshal(resp.Body(), dst); err != nil {
+			return newDecodeError(upstream, url, resp.StatusCode(), err)
+		}
+		return nil
+	}
+}
+
+// do sends a GET (or a json POST if body isn't nil) to url and hands the response to `handle` (the response is pooled so don't keep it around).
+// Hypixel requests use `fixedKey` if given, otherwise a key from the pool; a rejected or rate-limited pool key is taken out of rotation and the request moves on to the next one.
+func (cl *HypixelApiClient) do(ctx context.Context, url string, fixedKey string, body []byte, handle func(resp *fasthttp.Response) error) error {
 	// fast http performance thing. request/responses pool to prevent GC usage basically
 	req := fasthttp.AcquireRequest()
 	resp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(resp)
-	defer fasthttp.ReleaseRequest(req)
+	// owned false once an abandoned request still holds req/resp. send() releases them when it's done with them instead
+	owned := true
+	defer func() {
+		if owned {
+			releaseExchange(req, resp)
+		}
+	}()
 	req.SetRequestURI(url)
-	req.Header.Set("API-Key", cl.ApiKey)
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Keep-Alive", "timeout=30, max=100")
+	if body != nil {
+		req.Header.SetMethod(fasthttp.MethodPost)
+		req.Header.SetContentType("application/json")
+		req.SetBody(body)
+	}
 
-	if err := cl.Client.Do(req, resp); err != nil {
-		return err
+	upstream := cl.upstreamOf(url)
+	rateLimitedAttempts := 0
+	for {
+		key := fixedKey
+		if upstream == UpstreamHypixel {
+			if key == "" {
+				picked, err := cl.Keys.Pick(func(k string) int {
+					return cl.limiterFor(upstream, k).Remaining()
+				})
+				if errors.Is(err, ErrRateLimited) && rateLimitedAttempts < maxRateLimitRetries {
+					// every key is cooling down. wait for the first one instead of failing
+					rateLimitedAttempts++
+					if err := sleepCtx(ctx, cl.Keys.NextRecovery()); err != nil {
+						return err
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				key = picked
+			}
+			// only hypixel gets the key. mojang & NEU have no business seeing it
+			req.Header.Set("API-Key", key)
+		}
+
+		limiter := cl.limiterFor(upstream, key)
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		resp.Reset()
+		abandoned, err := cl.send(ctx, req, resp)
+		if abandoned {
+			owned = false
+		}
+		if ctx.Err() != nil {
+			// caller gave up. not the upstream's fault
+			return ctx.Err()
+		}
+		if err != nil {
+			return newNetworkError(upstream, url, err)
+		}
+		observeHeaders(limiter, resp)
+
+		switch {
+		case resp.StatusCode() == fasthttp.StatusTooManyRequests:
+			wait := retryAfter(resp)
+			limiter.Throttle(wait)
+			if upstream == UpstreamHypixel && fixedKey == "" {
+				cl.Keys.MarkRateLimited(key, wait)
+			}
+			log.Println("Rate limited on " + url + ". Waiting " + wait.String() + " (attempt " + strconv.Itoa(rateLimitedAttempts+1) + ").")
+			if rateLimitedAttempts >= maxRateLimitRetries {
+				return newStatusError(upstream, url, resp)
+			}
+			rateLimitedAttempts++
+		case resp.StatusCode() == fasthttp.StatusForbidden && upstream == UpstreamHypixel && fixedKey == "":
+			// key got revoked/is invalid. next loop picks another one, or errors if this was the last
+			log.Println("API key " + keyLabel(key) + " was rejected by Hypixel. Taking it out of rotation.")
+			cl.Keys.MarkInvalid(key)
+		default:
+			return handle(resp)
+		}
 	}
-	if resp.StatusCode() == 500 {
-		log.Println("Encountered rate-limit status code " + strconv.Itoa(resp.StatusCode()) + " for url " + url)
+}
+
+// send runs one request with the per-call deadline. If ctx is done first we stop waiting for it; `abandoned` then means
+// the request is still running and will release req/resp itself once it finishes.
+func (cl *HypixelApiClient) send(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) (abandoned bool, err error) {
+	callCtx, cancel := context.WithTimeout(ctx, cl.CallTimeout)
+	defer cancel()
+	if deadline, ok := callCtx.Deadline(); ok {
+		req.SetTimeout(time.Until(deadline))
 	}
-	
-	if resp.StatusCode() != 200 { // might need to change in future; 200 is a bit too general but works for pricechecker & hypixel api for now.
-		return fmt.Errorf("invalid status code; " + resp.String())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.Client.Do(req, resp)
+	}()
+
+	select {
+	case err = <-done:
+		return false, err
+	case <-callCtx.Done():
+		go func() {
+			<-done
+			releaseExchange(req, resp)
+		}()
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		return true, errors.New("timed out after " + cl.CallTimeout.String())
 	}
+}
 
-	// sonic is MUCH faster. uses SIMD.
-	return sonic.Unmarshal(resp.Body(), dst)
+func releaseExchange(req *fasthttp.Request, resp *fasthttp.Response) {
+	fasthttp.ReleaseResponse(resp)
+	fasthttp.ReleaseRequest(req)
+}
+
+// UseLocalHistory makes price history lookups prefer `source` for products it has recorded for the last `span`. Lookups over
+// longer spans than that won't see all of it. Call it before anything starts using the client.
+func (cl *HypixelApiClient) UseLocalHistory(source PriceHistorySource, span time.Duration) {
+	cl.LocalHistory, cl.LocalHistorySpan = source, span
+}
+
+// RemainingQuota how many requests we can still make per bucket before the scheduler starts holding them back.
+func (cl *HypixelApiClient) RemainingQuota() map[string]int {
+	return cl.Limits.Remaining()
+}
+
+// upstreamOf which upstream a url belongs to.
+func (cl *HypixelApiClient) upstreamOf(url string) string {
+	switch {
+	case strings.HasPrefix(url, cl.Endpoints.Hypixel), strings.HasPrefix(url, cl.Endpoints.Skyblock):
+		return UpstreamHypixel
+	case strings.HasPrefix(url, cl.Endpoints.MojangUuid), strings.HasPrefix(url, cl.Endpoints.MojangBulk), strings.HasPrefix(url, cl.Endpoints.MojangProfile):
+		return UpstreamMojang
+	case strings.HasPrefix(url, cl.Endpoints.PriceTracker):
+		return UpstreamPriceTracker
+	case strings.HasPrefix(url, cl.Endpoints.LowestBin):
+		return UpstreamMoulberry
+	}
+	return ""
+}
+
+// breakerFor the circuit breaker of an upstream.
+func (cl *HypixelApiClient) breakerFor(upstream string) *CircuitBreaker {
+	if b, ok := cl.breakers[upstream]; ok {
+		return b
+	}
+	return cl.breakers[""]
+}
+
+// limiterFor picks the bucket a request counts against. Hypixel counts per key.
+func (cl *HypixelApiClient) limiterFor(upstream string, key string) *RateLimiter {
+	switch upstream {
+	case UpstreamHypixel:
+		return cl.Limits.Limiter(upstream, upstream+":"+keyLabel(key))
+	case "":
+		return cl.Limits.Limiter(upstream, "other")
+	}
+	return cl.Limits.Limiter(upstream, upstream)
+}
+
+// keyLabel enough of the key to tell them apart in logs/quota maps without leaking it.
+func keyLabel(apiKey string) string {
+	if len(apiKey) > 8 {
+		return apiKey[:8]
+	}
+	return apiKey
 }
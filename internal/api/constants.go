@@ -6,8 +6,69 @@ const BaseApiUrl = "https://api.hypixel.net/v2/"
 // MojangUuidApi to get player uuid from the Mojang API
 const MojangUuidApi = "https://api.mojang.com/users/profiles/minecraft/"
 
+// MojangBulkApi to look up many usernames at once (max 10 per request)
+const MojangBulkApi = "https://api.minecraftservices.com/minecraft/profile/lookup/bulk/byname"
+
+// MojangProfileApi to get the current name of a uuid
+const MojangProfileApi = "https://sessionserver.mojang.com/session/minecraft/profile/"
+
 // SbApiUrl is the base skyblock API url
 const SbApiUrl = "https://api.hypixel.net/v2/skyblock/"
 
 // PriceTrackerUrl is the price history URL to prevent market manipulation. Shoutout NEU
 const PriceTrackerUrl = "https://pricehistory.notenoughupdates.org?item="
+
+// LowestBinUrl is the lowest BIN of every auctionable item, updated every minute. Shoutout Moulberry
+const LowestBinUrl = "https://moulberry.codes/lowestbin.json"
+
+// Endpoints are the base urls of every upstream we talk to. The constants above are the defaults, but these can be pointed
+// at a local mock (or anything that speaks the same api) so we can run without the real Hypixel/Mojang/NEU.
+type Endpoints struct {
+	Hypixel       string `json:"hypixel"`
+	Skyblock      string `json:"skyblock"`
+	MojangUuid    string `json:"mojangUuid"`
+	MojangBulk    string `json:"mojangBulk"`
+	MojangProfile string `json:"mojangProfile"`
+	PriceTracker  string `json:"priceTracker"`
+	LowestBin     string `json:"lowestBin"`
+}
+
+// DefaultEndpoints returns the real upstream urls.
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		Hypixel:       BaseApiUrl,
+		Skyblock:      SbApiUrl,
+		MojangUuid:    MojangUuidApi,
+		MojangBulk:    MojangBulkApi,
+		MojangProfile: MojangProfileApi,
+		PriceTracker:  PriceTrackerUrl,
+		LowestBin:     LowestBinUrl,
+	}
+}
+
+// withDefaults fills every empty url with its default so partial overrides (e.g. only mocking mojang) work.
+func (e Endpoints) withDefaults() Endpoints {
+	def := DefaultEndpoints()
+	if e.Hypixel == "" {
+		e.Hypixel = def.Hypixel
+	}
+	if e.Skyblock == "" {
+		e.Skyblock = def.Skyblock
+	}
+	if e.MojangUuid == "" {
+		e.MojangUuid = def.MojangUuid
+	}
+	if e.MojangBulk == "" {
+		e.MojangBulk = def.MojangBulk
+	}
+	if e.MojangProfile == "" {
+		e.MojangProfile = def.MojangProfile
+	}
+	if e.PriceTracker == "" {
+		e.PriceTracker = def.PriceTracker
+	}
+	if e.LowestBin == "" {
+		e.LowestBin = def.LowestBin
+	}
+	return e
+}
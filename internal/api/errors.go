@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"strconv"
+)
+
+// Every error coming out of this package can be checked with errors.Is against one of these.
+var (
+	ErrInvalidKey          = errors.New("invalid api key")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrNotFound            = errors.New("not found")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrDecode              = errors.New("could not decode response")
+)
+
+// maxErrorBody how much of a response body we keep in an error. Bazaar bodies are megabytes, nobody wants that in a log.
+const maxErrorBody = 512
+
+// UpstreamError is what a failed request turns into. Kind is one of the sentinels above (nil if the status is just weird),
+// Err is the underlying network/decoding error if there was one.
+type UpstreamError struct {
+	Kind     error
+	Upstream string
+	Url      string
+	Status   int
+	Body     string
+	Err      error
+}
+
+func (e *UpstreamError) Error() string {
+	msg := "request to " + e.Url + " failed"
+	if e.Kind != nil {
+		msg += ": " + e.Kind.Error()
+	}
+	if e.Status != 0 {
+		msg += " (status " + strconv.Itoa(e.Status) + ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Body != "" {
+		msg += "; " + e.Body
+	}
+	return msg
+}
+
+func (e *UpstreamError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// StatusOf the http status an error came with. 0 if it never got one (network errors etc.)
+func StatusOf(err error) int {
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) {
+		return upErr.Status
+	}
+	return 0
+}
+
+// newStatusError classifies a non-200 response.
+func newStatusError(upstream string, url string, resp *fasthttp.Response) *UpstreamError {
+	status := resp.StatusCode()
+	var kind error
+	switch {
+	case status == fasthttp.StatusForbidden && upstream == UpstreamHypixel:
+		kind = ErrInvalidKey
+	case status == fasthttp.StatusTooManyRequests:
+		kind = ErrRateLimited
+	case status == fasthttp.StatusNotFound || status == fasthttp.StatusNoContent: // mojang used to send 204 for unknown names
+		kind = ErrNotFound
+	case status >= 500:
+		kind = ErrUpstreamUnavailable
+	}
+
+	body := resp.Body()
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return &UpstreamError{
+		Kind:     kind,
+		Upstream: upstream,
+		Url:      url,
+		Status:   status,
+		Body:     string(body),
+	}
+}
+
+func newNetworkError(upstream string, url string, err error) *UpstreamError {
+	return &UpstreamError{Kind: ErrUpstreamUnavailable, Upstream: upstream, Url: url, Err: err}
+}
+
+func newDecodeError(upstream string, url string, status int, err error) *UpstreamError {
+	return &UpstreamError{Kind: ErrDecode, Upstream: upstream, Url: url, Status: status, Err: err}
+}
+
+// notFound for when the upstream said 200 but there's nothing in it (e.g. mojang sending an empty id).
+func notFound(what string) error {
+	return fmt.Errorf("%s: %w", what, ErrNotFound)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// SkyblockItem one entry of resources/skyblock/items. Only what we use, the real thing has a lot more.
+type SkyblockItem struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Material string `json:"material"`
+	Tier     string `json:"tier"`
+	Category string `json:"category"`
+	// NpcSellPrice what an NPC pays for one. 0 if NPCs don't buy it
+	NpcSellPrice float64 `json:"npc_sell_price"`
+}
+
+type itemsResponse struct {
+	Success     bool           `json:"success"`
+	LastUpdated int64          `json:"lastUpdated"`
+	Items       []SkyblockItem `json:"items"`
+}
+
+// GetItems the whole skyblock item catalog, by item id.
+func GetItems(cl *HypixelApiClient) (map[string]SkyblockItem, error) {
+	return GetItemsCtx(context.Background(), cl)
+}
+
+// GetItemsCtx is GetItems but cancellable.
+func GetItemsCtx(ctx context.Context, cl *HypixelApiClient) (map[string]SkyblockItem, error) {
+	var resp itemsResponse
+	if err := cl.GetCtx(ctx, cl.Endpoints.Hypixel+"resources/skyblock/items", &resp); err != nil {
+		return nil, fmt.Errorf("error while loading items: %w", err)
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("items not successful")
+	}
+
+	items := make(map[string]SkyblockItem, len(resp.Items))
+	for _, item := range resp.Items {
+		items[item.Id] = item
+	}
+	return items, nil
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type keyState int
+
+const (
+	keyHealthy keyState = iota
+	keyRateLimited
+	keyInvalid
+)
+
+type pooledKey struct {
+	key   string
+	state keyState
+	// until only for keyRateLimited. the key goes back into rotation after this
+	until time.Time
+}
+
+// KeyPool spreads Hypixel requests over every internal API key we have. Keys that turn invalid or get rate limited are
+// taken out of rotation, and put back once they recover (rate limits on their own, invalid keys via StartKeyRecovery).
+type KeyPool struct {
+	lock sync.Mutex
+	keys []*pooledKey
+	// next round-robin position, so equally good keys share the load
+	next int
+}
+
+var (
+	errAllKeysInvalid     = fmt.Errorf("no valid api keys left in the pool: %w", ErrInvalidKey)
+	errAllKeysRateLimited = fmt.Errorf("every api key is rate limited: %w", ErrRateLimited)
+)
+
+// NewKeyPool with every key healthy. Empty and duplicate keys are ignored.
+func NewKeyPool(keys []string) *KeyPool {
+	pool := &KeyPool{}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		pool.keys = append(pool.keys, &pooledKey{key: k, state: keyHealthy})
+	}
+	return pool
+}
+
+// Pick returns the healthy key with the highest score (e.g. remaining quota). Ties go round-robin.
+func (p *KeyPool) Pick(score func(key string) int) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	best, bestScore := -1, 0
+	rateLimited := false
+	for i := range p.keys {
+		idx := (p.next + i) % len(p.keys)
+		k := p.keys[idx]
+		if k.state == keyRateLimited && !now.Before(k.until) {
+			k.state = keyHealthy
+			log.Println("API key " + keyLabel(k.key) + " is back in rotation.")
+		}
+		if k.state != keyHealthy {
+			rateLimited = rateLimited || k.state == keyRateLimited
+			continue
+		}
+
+		s := score(k.key)
+		if best == -1 || s > bestScore {
+			best, bestScore = idx, s
+		}
+	}
+
+	if best == -1 {
+		if rateLimited {
+			return "", errAllKeysRateLimited
+		}
+		return "", errAllKeysInvalid
+	}
+	p.next = (best + 1) % len(p.keys)
+	return p.keys[best].key, nil
+}
+
+// MarkInvalid takes the key out of rotation until something marks it healthy again.
+func (p *KeyPool) MarkInvalid(key string) {
+	p.setState(key, keyInvalid, time.Time{})
+}
+
+// MarkRateLimited takes the key out of rotation for `d`.
+func (p *KeyPool) MarkRateLimited(key string, d time.Duration) {
+	p.setState(key, keyRateLimited, time.Now().Add(d))
+}
+
+// MarkHealthy puts the key back into rotation.
+func (p *KeyPool) MarkHealthy(key string) {
+	p.setState(key, keyHealthy, time.Time{})
+}
+
+func (p *KeyPool) setState(key string, state keyState, until time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, k := range p.keys {
+		if k.key != key {
+			continue
+		}
+		if k.state != state {
+			log.Printf("API key %s changed state %d -> %d.\n", keyLabel(key), k.state, state)
+		}
+		k.state, k.until = state, until
+		return
+	}
+}
+
+// NextRecovery how long until the first rate limited key is usable again. 0 if none are rate limited.
+func (p *KeyPool) NextRecovery() time.Duration {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var soonest time.Duration
+	for _, k := range p.keys {
+		if k.state != keyRateLimited {
+			continue
+		}
+		if wait := time.Until(k.until); soonest == 0 || wait < soonest {
+			soonest = max(wait, time.Millisecond)
+		}
+	}
+	return soonest
+}
+
+// Healthy how many keys are currently in rotation.
+func (p *KeyPool) Healthy() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, k := range p.keys {
+		if k.state == keyHealthy || (k.state == keyRateLimited && !now.Before(k.until)) {
+			count++
+		}
+	}
+	return count
+}
+
+// All returns every key regardless of state.
+func (p *KeyPool) All() []string {
+	return p.withState(func(*pooledKey) bool { return true })
+}
+
+// Invalid returns the keys that are out of rotation because they were rejected.
+func (p *KeyPool) Invalid() []string {
+	return p.withState(func(k *pooledKey) bool { return k.state == keyInvalid })
+}
+
+func (p *KeyPool) withState(match func(k *pooledKey) bool) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]string, 0, len(p.keys))
+	for _, k := range p.keys {
+		if match(k) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
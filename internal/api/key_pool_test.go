@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyPoolPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		prepare func(p *KeyPool)
+		scores  map[string]int
+		want    string
+		wantErr error
+	}{
+		{"most remaining quota wins", []string{"a", "b", "c"}, func(p *KeyPool) {}, map[string]int{"a": 10, "b": 200, "c": 50}, "b", nil},
+		{"invalid keys are skipped", []string{"a", "b"}, func(p *KeyPool) { p.MarkInvalid("b") }, map[string]int{"a": 1, "b": 300}, "a", nil},
+		{"rate limited keys are skipped", []string{"a", "b"}, func(p *KeyPool) { p.MarkRateLimited("b", time.Minute) }, map[string]int{"a": 1, "b": 300}, "a", nil},
+		{"rate limits run out on their own", []string{"a", "b"}, func(p *KeyPool) { p.MarkRateLimited("b", -time.Second) }, map[string]int{"a": 1, "b": 300}, "b", nil},
+		{"healthy again", []string{"a", "b"}, func(p *KeyPool) { p.MarkInvalid("b"); p.MarkHealthy("b") }, map[string]int{"a": 1, "b": 300}, "b", nil},
+		{"every key invalid", []string{"a", "b"}, func(p *KeyPool) { p.MarkInvalid("a"); p.MarkInvalid("b") }, nil, "", ErrInvalidKey},
+		{"rate limited beats invalid", []string{"a", "b"}, func(p *KeyPool) { p.MarkInvalid("a"); p.MarkRateLimited("b", time.Minute) }, nil, "", ErrRateLimited},
+		{"no keys at all", nil, func(p *KeyPool) {}, nil, "", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewKeyPool(tt.keys)
+			tt.prepare(pool)
+			got, err := pool.Pick(func(key string) int { return tt.scores[key] })
+			if got != tt.want || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Pick() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyPool(t *testing.T) {
+	t.Run("empty and duplicate keys are dropped", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "", "b", "a"})
+		expect(t, "len(All())", len(pool.All()), 2)
+	})
+
+	t.Run("ties go round-robin", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b", "c"})
+		seen := make(map[string]int)
+		for range 6 {
+			key, err := pool.Pick(func(string) int { return 1 })
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[key]++
+		}
+		for _, key := range []string{"a", "b", "c"} {
+			expect(t, "picks of "+key, seen[key], 2)
+		}
+	})
+
+	t.Run("next recovery is the soonest rate limit", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b", "c"})
+		expect(t, "NextRecovery() without rate limits", pool.NextRecovery(), time.Duration(0))
+		pool.MarkRateLimited("a", time.Minute)
+		pool.MarkRateLimited("b", time.Second)
+		if got := pool.NextRecovery(); got <= 0 || got > time.Second {
+			t.Errorf("NextRecovery() = %v, want at most a second", got)
+		}
+		expect(t, "Healthy()", pool.Healthy(), 1)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		pool := NewKeyPool([]string{"a", "b", "c"})
+		var wg sync.WaitGroup
+		for i := range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key, err := pool.Pick(func(string) int { return 1 })
+				if err != nil {
+					return
+				}
+				switch i % 3 {
+				case 0:
+					pool.MarkRateLimited(key, time.Millisecond)
+				case 1:
+					pool.MarkInvalid(key)
+				default:
+					pool.MarkHealthy(key)
+				}
+				_ = pool.Healthy()
+				_ = pool.NextRecovery()
+			}()
+		}
+		wg.Wait()
+		expect(t, "len(All())", len(pool.All()), 3)
+	})
+}
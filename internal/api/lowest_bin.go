@@ -0,0 +1,20 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// GetLowestBins the lowest BIN of every item on the auction house, by item id.
+func GetLowestBins(cl *HypixelApiClient) (map[string]float64, error) {
+	return GetLowestBinsCtx(context.Background(), cl)
+}
+
+// GetLowestBinsCtx is GetLowestBins but cancellable.
+func GetLowestBinsCtx(ctx context.Context, cl *HypixelApiClient) (map[string]float64, error) {
+	var bins map[string]float64
+	if err := cl.GetCtx(ctx, cl.Endpoints.LowestBin, &bins); err != nil {
+		return nil, fmt.Errorf("error while loading lowest bins: %w", err)
+	}
+	return bins, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a size-bounded cache where every entry also expires. Safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	lock     sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	entries  map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func newLruCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element),
+	}
+}
+
+// get returns the value if it's there and not expired.
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var zero V
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := el.Value.(*lruEntry[K, V])
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// put adds/replaces the value for `ttl`, evicting the least recently used entry if we're full.
+func (c *lruCache[K, V]) put(key K, value V, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		entry.value, entry.expires = value, time.Now().Add(ttl)
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: time.Now().Add(ttl)})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mojangBulkLimit how many names mojang accepts per bulk lookup.
+const mojangBulkLimit = 10
+
+// MojangProfile is a uuid and the name that currently belongs to it.
+type MojangProfile struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// profileEntry a cached lookup. found false = negative cache, mojang said this doesn't exist
+type profileEntry struct {
+	profile MojangProfile
+	found   bool
+}
+
+// MojangResolver resolves usernames <-> uuids with an LRU+TTL cache in front of mojang. Unknown names are cached too (for
+// a shorter time) so spamming a bad username doesn't spam mojang. Point the client's endpoints at a stand-in for tests.
+type MojangResolver struct {
+	cl          *HypixelApiClient
+	byName      *lruCache[string, profileEntry] // lowercase name -> profile
+	byUuid      *lruCache[string, profileEntry] // uuid without dashes -> profile
+	ttl         time.Duration
+	negativeTtl time.Duration
+}
+
+// NewMojangResolver keeps up to `capacity` names (and as many uuids). Names can change every 30 days so ttl should stay well below that.
+func NewMojangResolver(cl *HypixelApiClient, capacity int, ttl time.Duration, negativeTtl time.Duration) *MojangResolver {
+	return &MojangResolver{
+		cl:          cl,
+		byName:      newLruCache[string, profileEntry](capacity),
+		byUuid:      newLruCache[string, profileEntry](capacity),
+		ttl:         ttl,
+		negativeTtl: negativeTtl,
+	}
+}
+
+// Uuid of a username. Unknown names are ErrNotFound.
+func (r *MojangResolver) Uuid(ctx context.Context, username string) (string, error) {
+	key := strings.ToLower(username)
+	if entry, ok := r.byName.get(key); ok {
+		if !entry.found {
+			return "", notFound("no id found for " + username + " (cached)")
+		}
+		return entry.profile.Id, nil
+	}
+
+	profile, err := getMojangProfile(ctx, r.cl, username)
+	if errors.Is(err, ErrNotFound) {
+		r.byName.put(key, profileEntry{}, r.negativeTtl)
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	r.remember(profile)
+	return profile.Id, nil
+}
+
+// Uuids resolves many usernames at once, batching whatever isn't cached into bulk lookups.
+// The result only has the names that exist (keyed by the name as given), unknown ones are simply missing.
+func (r *MojangResolver) Uuids(ctx context.Context, usernames []string) (map[string]string, error) {
+	result := make(map[string]string, len(usernames))
+	// lowercase -> every spelling asked for, so the result uses the caller's spelling
+	missing := make(map[string][]string)
+	for _, name := range usernames {
+		key := strings.ToLower(name)
+		if entry, ok := r.byName.get(key); ok {
+			if entry.found {
+				result[name] = entry.profile.Id
+			}
+			continue
+		}
+		missing[key] = append(missing[key], name)
+	}
+
+	batch := make([]string, 0, mojangBulkLimit)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var profiles []MojangProfile
+		if err := r.cl.PostCtx(ctx, r.cl.Endpoints.MojangBulk, batch, &profiles); err != nil {
+			return fmt.Errorf("failed bulk mojang lookup: %w", err)
+		}
+
+		found := make(map[string]bool, len(profiles))
+		for _, p := range profiles {
+			key := strings.ToLower(p.Name)
+			found[key] = true
+			r.remember(p)
+			for _, asked := range missing[key] {
+				result[asked] = p.Id
+			}
+		}
+		for _, name := range batch {
+			if !found[name] {
+				r.byName.put(name, profileEntry{}, r.negativeTtl)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for key := range missing {
+		batch = append(batch, key)
+		if len(batch) == mojangBulkLimit {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	return result, flush()
+}
+
+// Name is the reverse lookup: the name that currently belongs to a uuid. Unknown uuids are ErrNotFound.
+func (r *MojangResolver) Name(ctx context.Context, uuid string) (string, error) {
+	key := strings.ReplaceAll(strings.ToLower(uuid), "-", "")
+	if entry, ok := r.byUuid.get(key); ok {
+		if !entry.found {
+			return "", notFound("no profile found for " + uuid + " (cached)")
+		}
+		return entry.profile.Name, nil
+	}
+
+	var profile MojangProfile
+	err := r.cl.GetCtx(ctx, r.cl.Endpoints.MojangProfile+key, &profile)
+	if err == nil && profile.Name == "" {
+		err = notFound("no profile found for " + uuid)
+	}
+	if errors.Is(err, ErrNotFound) {
+		r.byUuid.put(key, profileEntry{}, r.negativeTtl)
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get mojang profile: %w", err)
+	}
+
+	r.remember(profile)
+	return profile.Name, nil
+}
+
+// Renamed checks whether the player behind `uuid` still goes by `knownName`. Returns their current name either way.
+func (r *MojangResolver) Renamed(ctx context.Context, uuid string, knownName string) (string, bool, error) {
+	current, err := r.Name(ctx, uuid)
+	if err != nil {
+		return "", false, err
+	}
+	return current, !strings.EqualFold(current, knownName), nil
+}
+
+// remember caches a profile both ways.
+func (r *MojangResolver) remember(p MojangProfile) {
+	entry := profileEntry{profile: p, found: true}
+	r.byName.put(strings.ToLower(p.Name), entry, r.ttl)
+	r.byUuid.put(strings.ReplaceAll(strings.ToLower(p.Id), "-", ""), entry, r.ttl)
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMojang serves the three mojang endpoints from a fixed set of players and counts what it was asked.
+type fakeMojang struct {
+	players map[string]string // uuid -> current name
+
+	lock     sync.Mutex
+	lookups  int // single name lookups
+	profiles int // uuid lookups
+	batches  [][]string
+}
+
+func newFakeMojang(t *testing.T) (*fakeMojang, *HypixelApiClient) {
+	t.Helper()
+	fake := &fakeMojang{players: map[string]string{
+		"b876ec32e396476ba1158438d83c67d4": "Technoblade",
+		"069a79f444e94726a5befca90e38aaf5": "Notch",
+		"61699b2ed3274a019f1e0ea8c3f06bc6": "Dinnerbone",
+		"853c80ef3c3749fdaa49938b674adae6": "jeb_",
+	}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cl := Init(nil,
+		WithEndpoints(Endpoints{
+			MojangUuid:    srv.URL + "/uuid/",
+			MojangBulk:    srv.URL + "/bulk",
+			MojangProfile: srv.URL + "/profile/",
+		}),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+	return fake, cl
+}
+
+func (f *fakeMojang) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/uuid/"):
+		f.lookups++
+		name := strings.TrimPrefix(r.URL.Path, "/uuid/")
+		if name == "boom" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if p, ok := f.byName(name); ok {
+			_ = json.NewEncoder(w).Encode(p)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.URL.Path == "/bulk":
+		var names []string
+		_ = json.NewDecoder(r.Body).Decode(&names)
+		f.batches = append(f.batches, names)
+		found := make([]MojangProfile, 0, len(names))
+		for _, name := range names {
+			if p, ok := f.byName(name); ok {
+				found = append(found, p)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(found)
+	case strings.HasPrefix(r.URL.Path, "/profile/"):
+		f.profiles++
+		id := strings.TrimPrefix(r.URL.Path, "/profile/")
+		if name, ok := f.players[id]; ok {
+			_ = json.NewEncoder(w).Encode(MojangProfile{Id: id, Name: name})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeMojang) byName(name string) (MojangProfile, bool) {
+	for id, n := range f.players {
+		if strings.EqualFold(n, name) {
+			return MojangProfile{Id: id, Name: n}, true
+		}
+	}
+	return MojangProfile{}, false
+}
+
+func (f *fakeMojang) rename(id string, name string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.players[id] = name
+}
+
+func (f *fakeMojang) counts() (lookups int, profiles int, batches [][]string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.lookups, f.profiles, append([][]string(nil), f.batches...)
+}
+
+func TestResolverUuid(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		negativeTtl time.Duration
+		pause       time.Duration // between the two lookups
+		username    string
+		wantId      string
+		wantErr     error
+		wantLookups int
+	}{
+		{"second lookup is cached", time.Hour, time.Hour, 0, "Technoblade", "b876ec32e396476ba1158438d83c67d4", nil, 1},
+		{"cache ignores capitalisation", time.Hour, time.Hour, 0, "tEcHnObLaDe", "b876ec32e396476ba1158438d83c67d4", nil, 1},
+		{"expired entries are looked up again", 20 * time.Millisecond, time.Hour, 50 * time.Millisecond, "Notch", "069a79f444e94726a5befca90e38aaf5", nil, 2},
+		{"unknown names are cached too", time.Hour, time.Hour, 0, "NotARealPlayer123", "", ErrNotFound, 1},
+		{"unknown names expire on their own ttl", time.Hour, 20 * time.Millisecond, 50 * time.Millisecond, "NotARealPlayer123", "", ErrNotFound, 2},
+		{"mojang being down isn't cached", time.Hour, time.Hour, 0, "boom", "", ErrUpstreamUnavailable, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cl := newFakeMojang(t)
+			resolver := NewMojangResolver(cl, 10, tt.ttl, tt.negativeTtl)
+			for i := range 2 {
+				if i == 1 {
+					time.Sleep(tt.pause)
+				}
+				id, err := resolver.Uuid(ctx, tt.username)
+				if id != tt.wantId || !errors.Is(err, tt.wantErr) {
+					t.Errorf("lookup %d: Uuid() = %q, %v, want %q, %v", i+1, id, err, tt.wantId, tt.wantErr)
+				}
+			}
+			if lookups, _, _ := fake.counts(); lookups != tt.wantLookups {
+				t.Errorf("mojang asked %d times, want %d", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestResolverEviction(t *testing.T) {
+	ctx := context.Background()
+	fake, cl := newFakeMojang(t)
+	resolver := NewMojangResolver(cl, 2, time.Hour, time.Hour)
+
+	// Notch gets used again before jeb_ comes in, so Technoblade is the least recently used one
+	for _, name := range []string{"Technoblade", "Notch", "Technoblade", "jeb_"} {
+		if _, err := resolver.Uuid(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookups, _, _ := fake.counts(); lookups != 3 {
+		t.Fatalf("mojang asked %d times, want 3", lookups)
+	}
+
+	tests := []struct {
+		username string
+		cached   bool
+	}{
+		{"Technoblade", true},
+		{"jeb_", true},
+		{"Notch", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			before, _, _ := fake.counts()
+			if _, err := resolver.Uuid(ctx, tt.username); err != nil {
+				t.Fatal(err)
+			}
+			after, _, _ := fake.counts()
+			if cached := after == before; cached != tt.cached {
+				t.Errorf("cached = %v, want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestResolverUuids(t *testing.T) {
+	ctx := context.Background()
+	fake, cl := newFakeMojang(t)
+	resolver := NewMojangResolver(cl, 100, time.Hour, time.Hour)
+
+	// cached before the bulk lookup, so it isn't asked for again
+	if _, err := resolver.Uuid(ctx, "Technoblade"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"Technoblade", "notch", "NOTCH", "Dinnerbone", "jeb_"}
+	for i := range 20 {
+		names = append(names, "unknown"+string(rune('a'+i)))
+	}
+	got, err := resolver.Uuids(ctx, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Technoblade": "b876ec32e396476ba1158438d83c67d4",
+		"notch":       "069a79f444e94726a5befca90e38aaf5",
+		"NOTCH":       "069a79f444e94726a5befca90e38aaf5",
+		"Dinnerbone":  "61699b2ed3274a019f1e0ea8c3f06bc6",
+		"jeb_":        "853c80ef3c3749fdaa49938b674adae6",
+	}
+	if len(got) != len(want) {
+		t.Errorf("Uuids() = %v, want %v", got, want)
+	}
+	for name, id := range want {
+		expect(t, "Uuids()["+name+"]", got[name], id)
+	}
+
+	_, _, batches := fake.counts()
+	asked := 0
+	for _, batch := range batches {
+		if len(batch) > mojangBulkLimit {
+			t.Errorf("batch of %d names, mojang only takes %d", len(batch), mojangBulkLimit)
+		}
+		asked += len(batch)
+	}
+	// notch once, technoblade not at all
+	expect(t, "names asked for", asked, 23)
+	expect(t, "batches", len(batches), 3)
+
+	// everything asked for is cached now, found or not
+	if again, err := resolver.Uuids(ctx, names); err != nil || len(again) != len(want) {
+		t.Errorf("second Uuids() = %v, %v", again, err)
+	}
+	if id, err := resolver.Uuid(ctx, "Dinnerbone"); err != nil || id != want["Dinnerbone"] {
+		t.Errorf("Uuid() = %q, %v", id, err)
+	}
+	if _, err := resolver.Uuid(ctx, "unknowna"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Uuid() err = %v, want ErrNotFound", err)
+	}
+	lookups, _, batches := fake.counts()
+	expect(t, "lookups after the bulk", lookups, 1)
+	expect(t, "batches after the bulk", len(batches), 3)
+}
+
+func TestResolverRenamed(t *testing.T) {
+	ctx := context.Background()
+	const id = "853c80ef3c3749fdaa49938b674adae6"
+	tests := []struct {
+		name         string
+		uuid         string
+		knownName    string
+		renameTo     string
+		wantName     string
+		wantRenamed  bool
+		wantErr      error
+		wantProfiles int
+	}{
+		{"same name", id, "jeb_", "", "jeb_", false, nil, 1},
+		{"capitalisation isn't a rename", id, "JEB_", "", "jeb_", false, nil, 1},
+		{"dashed uuid", "853c80ef-3c37-49fd-aa49-938b674adae6", "jeb_", "", "jeb_", false, nil, 1},
+		{"renamed", id, "jeb_", "jeb", "jeb", true, nil, 1},
+		{"unknown uuid is cached", "00000000000000000000000000000000", "nobody", "", "", false, ErrNotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, cl := newFakeMojang(t)
+			if tt.renameTo != "" {
+				fake.rename(id, tt.renameTo)
+			}
+			resolver := NewMojangResolver(cl, 10, time.Hour, time.Hour)
+			for range 2 {
+				name, renamed, err := resolver.Renamed(ctx, tt.uuid, tt.knownName)
+				if name != tt.wantName || renamed != tt.wantRenamed || !errors.Is(err, tt.wantErr) {
+					t.Errorf("Renamed() = %q, %v, %v, want %q, %v, %v", name, renamed, err, tt.wantName, tt.wantRenamed, tt.wantErr)
+				}
+			}
+			if _, profiles, _ := fake.counts(); profiles != tt.wantProfiles {
+				t.Errorf("mojang asked %d times, want %d", profiles, tt.wantProfiles)
+			}
+		})
+	}
+
+	t.Run("name lookups fill the uuid side of the cache", func(t *testing.T) {
+		fake, cl := newFakeMojang(t)
+		resolver := NewMojangResolver(cl, 10, time.Hour, time.Hour)
+		if _, err := resolver.Uuid(ctx, "jeb_"); err != nil {
+			t.Fatal(err)
+		}
+		if _, renamed, err := resolver.Renamed(ctx, id, "jeb_"); renamed || err != nil {
+			t.Errorf("Renamed() = %v, %v", renamed, err)
+		}
+		if _, profiles, _ := fake.counts(); profiles != 0 {
+			t.Errorf("mojang asked %d times, want 0", profiles)
+		}
+	})
+}
+
+func expect[T comparable](t *testing.T, field string, got T, want T) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
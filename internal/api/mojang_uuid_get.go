@@ -1,24 +1,45 @@
 package api
 
 import (
-	"errors"
+	"context"
+	"fmt"
 )
 
 type mojangRequest struct {
 	Id       string `json:"id"`
+	Name     string `json:"name"`
 	ErrorMsg string `json:"errorMsg"`
 }
 
 // GetMojangUuid returns a player uuid from the username. Funny that we're using `HypixelApiClient` for it lol
+// Unknown usernames come back as ErrNotFound, mojang being down as ErrUpstreamUnavailable/ErrRateLimited.
+// Doesn't cache anything, use MojangResolver for that.
 func GetMojangUuid(cl *HypixelApiClient, username string) (string, error) {
+	return GetMojangUuidCtx(context.Background(), cl, username)
+}
+
+// GetMojangUuidCtx is GetMojangUuid but cancellable.
+func GetMojangUuidCtx(ctx context.Context, cl *HypixelApiClient, username string) (string, error) {
+	profile, err := getMojangProfile(ctx, cl, username)
+	if err != nil {
+		return "", err
+	}
+	return profile.Id, nil
+}
+
+// getMojangProfile is the uuid and the properly capitalised name of a username.
+func getMojangProfile(ctx context.Context, cl *HypixelApiClient, username string) (MojangProfile, error) {
 	var id mojangRequest
-	if err := cl.Get(MojangUuidApi+username, &id); err != nil {
-		return "", errors.New("failed to get mojang uuid") // might be some other error but who cares. we gotta do this because cl already json marshals to `dst` and i dont wanna bother rewriting the entire code without cl
+	if err := cl.GetCtx(ctx, cl.Endpoints.MojangUuid+username, &id); err != nil {
+		return MojangProfile{}, fmt.Errorf("failed to get mojang uuid: %w", err)
 	}
 
 	if id.Id == "" {
-		return "", errors.New("no id found")
+		return MojangProfile{}, notFound("no id found for " + username)
+	}
+	if id.Name == "" {
+		id.Name = username
 	}
 
-	return id.Id, nil
+	return MojangProfile{Id: id.Id, Name: id.Name}, nil
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"time"
@@ -22,69 +23,62 @@ type PriceHistoryProduct struct {
 	BuyMovingWeek  int     `json:"buyMovingWeek"`
 }
 
-const VolumeAverageCheck = 8
-const MaxSwingPercentage = 40
+// PriceHistorySource is a local price history (our own recordings, see storage.BazaarHistoryTable). `covered` false means the
+// recordings of the product don't reach back to `from` (or don't exist), in which case NEU is asked instead.
+type PriceHistorySource interface {
+	History(ctx context.Context, itemId string, from time.Time, to time.Time) (points []TimedPricePoint, covered bool, err error)
+}
 
-// GetPriceHistory of a product. timeSpan is in minutes.
-func GetPriceHistory(cl *HypixelApiClient, itemId string, timeSpan int) ([]PricePoint, error) {
-	// timestamp -> PricePoint
-	var history map[string]PricePoint
-	err := cl.Get(PriceTrackerUrl+itemId, &history)
+// GetPriceHistory of a product over the last `timeSpan`.
+func GetPriceHistory(cl *HypixelApiClient, itemId string, timeSpan time.Duration) ([]PricePoint, error) {
+	return GetPriceHistoryCtx(context.Background(), cl, itemId, timeSpan)
+}
+
+// GetPriceHistoryCtx is GetPriceHistory but cancellable. Goes through the client's PriceHistoryStore, so only the first call
+// for a product per ttl actually reads our recordings or hits NEU.
+func GetPriceHistoryCtx(ctx context.Context, cl *HypixelApiClient, itemId string, timeSpan time.Duration) ([]PricePoint, error) {
+	to := time.Now()
+	from := to.Add(-timeSpan)
+
+	history, err := cl.PriceHistory.Get(ctx, itemId)
 	if err != nil {
-		return nil, fmt.Errorf("error while loading price history: " + err.Error())
+		return nil, err
 	}
-	// Extract keys and sort timestamps chronologically. Ugh
-	timestamps := make([]string, 0, len(history))
-	for ts := range history {
-		timestamps = append(timestamps, ts)
-	}
-	sort.Strings(timestamps)
 
 	relevantPoints := make([]PricePoint, 0)
-	for _, ts := range timestamps {
-		timestamp, err := time.Parse(time.RFC3339, ts)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse pricehistory time")
-		}
-
-		relevantPoints = append(relevantPoints, history[ts])
-		if time.Since(timestamp) > time.Duration(timeSpan)*time.Minute {
-			break
+	for _, point := range history {
+		if point.At.Before(from) || point.At.After(to) {
+			continue
 		}
+		relevantPoints = append(relevantPoints, point.PricePoint)
 	}
 
 	if len(relevantPoints) == 0 {
-		return nil, fmt.Errorf("could not find relevant price points")
+		return nil, notFound("could not find relevant price points")
 	}
 	return relevantPoints, nil
 }
 
-// IsManipulatedBazaarProduct checks for suspiciously sharp price changes with weak volume.
-func IsManipulatedBazaarProduct(cl *HypixelApiClient, p *PriceHistoryProduct, timeSpan int) (bool, error) {
-	points, err := GetPriceHistory(cl, p.ProductID, timeSpan)
+// fetchPriceHistory downloads the whole history of a product from NEU, oldest first.
+func fetchPriceHistory(ctx context.Context, cl *HypixelApiClient, itemId string) ([]TimedPricePoint, error) {
+	// timestamp -> PricePoint
+	var history map[string]PricePoint
+	err := cl.GetCtx(ctx, cl.Endpoints.PriceTracker+itemId, &history)
 	if err != nil {
-		return false, err
+		return nil, fmt.Errorf("error while loading price history: %w", err)
 	}
 
-	// Find min and max sell prices in the history of the product
-	minimum, maximum := p.SellPrice, p.SellPrice
-	for _, pt := range points {
-		if pt.Sell < minimum {
-			minimum = pt.Sell
-		}
-		if pt.Sell > maximum {
-			maximum = pt.Sell
+	points := make([]TimedPricePoint, 0, len(history))
+	for ts, point := range history {
+		timestamp, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse pricehistory time")
 		}
+		points = append(points, TimedPricePoint{At: timestamp, PricePoint: point})
 	}
-
-	priceSwing := (maximum - minimum) / ((maximum + minimum) / 2) * 100
-	// Check if volumes are abnormally low compared to daily price according weekly moving averages
-	lowSellVolume := p.SellVolume < p.SellMovingWeek/VolumeAverageCheck
-	lowBuyVolume := p.BuyVolume < p.BuyMovingWeek/VolumeAverageCheck
-
-	// Large swing (40% is arbitrary atm) + low volume = likely manipulation
-	if priceSwing > MaxSwingPercentage && (lowSellVolume || lowBuyVolume) {
-		return true, nil
-	}
-	return false, nil
+	// sort chronologically. Ugh
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].At.Before(points[j].At)
+	})
+	return points, nil
 }
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// TimedPricePoint is a PricePoint and when it was recorded.
+type TimedPricePoint struct {
+	At time.Time
+	PricePoint
+}
+
+type historyEntry struct {
+	points   []TimedPricePoint // oldest first
+	fetched  time.Time
+	lastUsed time.Time
+}
+
+// historyCall one in-flight fetch. everyone asking for the same product while it runs waits on `done` instead of fetching again
+type historyCall struct {
+	done   chan struct{}
+	points []TimedPricePoint
+	err    error
+}
+
+// PriceHistoryStore keeps the price history of every product we've been asked about in memory for `ttl`, so a bazaar refresh
+// doesn't download the same NEU history (or read the same recordings) hundreds of times every 20 seconds. Concurrent fetches of
+// the same product are coalesced into one request, and StartRefresher keeps the entries warm in the background.
+type PriceHistoryStore struct {
+	cl  *HypixelApiClient
+	ttl time.Duration
+	// idleAfter entries nobody asked for in this long are dropped instead of refreshed
+	idleAfter time.Duration
+
+	lock     sync.Mutex
+	entries  map[string]*historyEntry
+	inflight map[string]*historyCall
+}
+
+func NewPriceHistoryStore(cl *HypixelApiClient, ttl time.Duration) *PriceHistoryStore {
+	return &PriceHistoryStore{
+		cl:        cl,
+		ttl:       ttl,
+		idleAfter: 6 * ttl,
+		entries:   make(map[string]*historyEntry),
+		inflight:  make(map[string]*historyCall),
+	}
+}
+
+// Get the full history of a product, from memory if it's fresh enough. If a refetch fails but we still have older data, the
+// older data is returned instead of the error (the history changes slowly, stale beats nothing).
+func (s *PriceHistoryStore) Get(ctx context.Context, itemId string) ([]TimedPricePoint, error) {
+	s.lock.Lock()
+	entry, ok := s.entries[itemId]
+	var stale []TimedPricePoint // read under the lock, a finished fetch swaps entry.points
+	if ok {
+		entry.lastUsed = time.Now()
+		stale = entry.points
+		if time.Since(entry.fetched) < s.ttl {
+			s.lock.Unlock()
+			return stale, nil
+		}
+	}
+	call := s.startFetch(itemId)
+	s.lock.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil && ok {
+		return stale, nil
+	}
+	return call.points, call.err
+}
+
+// startFetch joins the in-flight fetch for itemId or starts one. Must hold s.lock.
+func (s *PriceHistoryStore) startFetch(itemId string) *historyCall {
+	if call, ok := s.inflight[itemId]; ok {
+		return call
+	}
+
+	call := &historyCall{done: make(chan struct{})}
+	s.inflight[itemId] = call
+	go func() {
+		// not tied to whoever asked first; if they give up the others still want the result
+		ctx, cancel := context.WithTimeout(context.Background(), s.cl.CallTimeout*time.Duration(max(s.cl.Retry.MaxAttempts, 1)))
+		defer cancel()
+		call.points, call.err = s.fetch(ctx, itemId)
+
+		s.lock.Lock()
+		delete(s.inflight, itemId)
+		if call.err == nil {
+			now := time.Now()
+			if entry, ok := s.entries[itemId]; ok {
+				entry.points, entry.fetched = call.points, now
+			} else {
+				s.entries[itemId] = &historyEntry{points: call.points, fetched: now, lastUsed: now}
+			}
+		}
+		s.lock.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// fetch the history of a product: the client's LocalHistorySpan of our own recordings if they reach back that far, otherwise
+// the whole NEU history.
+func (s *PriceHistoryStore) fetch(ctx context.Context, itemId string) ([]TimedPricePoint, error) {
+	if s.cl.LocalHistory != nil {
+		to := time.Now()
+		points, covered, err := s.cl.LocalHistory.History(ctx, itemId, to.Add(-s.cl.LocalHistorySpan), to)
+		if err != nil {
+			// db trouble shouldn't take manipulation checks down with it, NEU is still there
+			log.Println("Could not read local price history of " + itemId + ". Falling back to NEU. Error: " + err.Error())
+		} else if covered {
+			return points, nil
+		}
+	}
+	return fetchPriceHistory(ctx, s.cl, itemId)
+}
+
+// StartRefresher refetches entries that are about to expire every `interval` (at most `workers` at once), and drops the ones
+// nobody has used in a while. Stops when ctx is done.
+func (s *PriceHistoryStore) StartRefresher(ctx context.Context, interval time.Duration, workers int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			due := s.dueForRefresh()
+			sem := make(chan struct{}, workers)
+			for _, itemId := range due {
+				sem <- struct{}{}
+				s.lock.Lock()
+				call := s.startFetch(itemId)
+				s.lock.Unlock()
+				go func() {
+					<-call.done
+					<-sem
+				}()
+			}
+			if len(due) > 0 {
+				log.Printf("Refreshing price history of %d products in the background.\n", len(due))
+			}
+		}
+	}()
+}
+
+// dueForRefresh evicts idle entries and returns the ones that expire within the next quarter ttl.
+func (s *PriceHistoryStore) dueForRefresh() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	due := make([]string, 0)
+	for itemId, entry := range s.entries {
+		if time.Since(entry.lastUsed) > s.idleAfter {
+			delete(s.entries, itemId)
+			continue
+		}
+		if time.Since(entry.fetched) > s.ttl*3/4 {
+			due = append(due, itemId)
+		}
+	}
+	return due
+}
+
+// Len how many products are in memory.
+func (s *PriceHistoryStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.entries)
+}
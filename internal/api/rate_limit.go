@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Upstream names, used as scheduler keys. Hypixel gets one bucket per API key since that's how they count.
+const (
+	UpstreamHypixel      = "hypixel"
+	UpstreamMojang       = "mojang"
+	UpstreamPriceTracker = "pricetracker"
+	UpstreamMoulberry    = "moulberry"
+)
+
+// lowBudgetFraction is the point (fraction of capacity) where we stop bursting and start spreading the remaining requests until reset.
+const lowBudgetFraction = 0.1
+
+// maxRateLimitRetries is how many times a 429 gets waited out before we give up on the request.
+const maxRateLimitRetries = 3
+
+// RateLimiter is a token bucket for one upstream. It refills on its own, but whatever the upstream tells us in its headers wins.
+type RateLimiter struct {
+	lock         sync.Mutex
+	capacity     float64
+	tokens       float64
+	refillPerSec float64
+	lastRefill   time.Time
+	// pausedUntil nobody gets a token before this. set when we run out according to the upstream (or get a 429)
+	pausedUntil time.Time
+	// nextAllowed used to space out requests when the budget is low
+	nextAllowed time.Time
+	// resetAt when the upstream said our window resets. zero if it never told us
+	resetAt time.Time
+}
+
+// NewRateLimiter allows `capacity` requests per `window`.
+func NewRateLimiter(capacity int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		capacity:     float64(capacity),
+		tokens:       float64(capacity),
+		refillPerSec: float64(capacity) / window.Seconds(),
+		lastRefill:   time.Now(),
+	}
+}
+
+// Wait blocks until we're allowed to send one request (and takes the token for it), or until ctx is done.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		wait := r.reserve()
+		if wait <= 0 {
+			return nil
+		}
+		if err := sleepCtx(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token if one is available right now, otherwise returns how long to wait before trying again.
+func (r *RateLimiter) reserve() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.refill(now)
+	if now.Before(r.pausedUntil) {
+		return r.pausedUntil.Sub(now)
+	}
+	if now.Before(r.nextAllowed) {
+		return r.nextAllowed.Sub(now)
+	}
+	if r.tokens < 1 {
+		return time.Duration((1 - r.tokens) / r.refillPerSec * float64(time.Second))
+	}
+
+	r.tokens--
+	// running low: don't burn the rest in one burst, spread it over what's left of the window
+	if r.tokens < r.capacity*lowBudgetFraction && now.Before(r.resetAt) {
+		r.nextAllowed = now.Add(r.resetAt.Sub(now) / time.Duration(r.tokens+1))
+	}
+	return 0
+}
+
+func (r *RateLimiter) refill(now time.Time) {
+	if !r.resetAt.IsZero() && !now.Before(r.resetAt) {
+		// upstream window is over so we get our full budget back
+		r.tokens = r.capacity
+		r.resetAt = time.Time{}
+	} else {
+		r.tokens += now.Sub(r.lastRefill).Seconds() * r.refillPerSec
+		if r.tokens > r.capacity {
+			r.tokens = r.capacity
+		}
+	}
+	r.lastRefill = now
+}
+
+// Observe syncs the bucket with the upstream's `RateLimit-Remaining`/`RateLimit-Reset` (seconds) headers.
+func (r *RateLimiter) Observe(remaining int, reset time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.refill(now)
+	r.resetAt = now.Add(reset)
+	// the upstream knows better than our estimate, but requests already in flight took tokens we can't see here yet
+	if float64(remaining) < r.tokens {
+		r.tokens = float64(remaining)
+	}
+	if remaining <= 0 {
+		r.pausedUntil = r.resetAt
+	}
+}
+
+// Throttle stops everyone for `d` (i.e. we got a 429).
+func (r *RateLimiter) Throttle(d time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(r.pausedUntil) {
+		r.pausedUntil = until
+	}
+	r.tokens = 0
+}
+
+// Remaining is how many requests we think we can still send right now.
+func (r *RateLimiter) Remaining() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.refill(now)
+	if now.Before(r.pausedUntil) {
+		return 0
+	}
+	return int(r.tokens)
+}
+
+// Scheduler keeps one RateLimiter per upstream (per key for Hypixel). Every request in HypixelApiClient goes through it.
+type Scheduler struct {
+	lock     sync.Mutex
+	limiters map[string]*RateLimiter
+	// defaults for limiters created on demand (new api keys)
+	limits map[string]rateLimit
+}
+
+type rateLimit struct {
+	capacity int
+	window   time.Duration
+}
+
+// NewScheduler with the known limits of every upstream. Hypixel: 300/5min for a normal key. Mojang: 600/10min.
+// NEU and Moulberry don't document one so we're just being polite.
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		limiters: make(map[string]*RateLimiter),
+		limits: map[string]rateLimit{
+			UpstreamHypixel:      {capacity: 300, window: 5 * time.Minute},
+			UpstreamMojang:       {capacity: 600, window: 10 * time.Minute},
+			UpstreamPriceTracker: {capacity: 600, window: time.Minute},
+			UpstreamMoulberry:    {capacity: 60, window: time.Minute},
+		},
+	}
+}
+
+// SetLimit changes the limit for an upstream. Only affects limiters created after this call.
+func (s *Scheduler) SetLimit(upstream string, capacity int, window time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.limits[upstream] = rateLimit{capacity: capacity, window: window}
+}
+
+// Limiter returns (and creates if needed) the limiter for a bucket. bucket is either the upstream name or "hypixel:<key>".
+func (s *Scheduler) Limiter(upstream string, bucket string) *RateLimiter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if l, ok := s.limiters[bucket]; ok {
+		return l
+	}
+	limit, ok := s.limits[upstream]
+	if !ok {
+		limit = rateLimit{capacity: 600, window: time.Minute}
+	}
+	l := NewRateLimiter(limit.capacity, limit.window)
+	s.limiters[bucket] = l
+	return l
+}
+
+// Remaining is the quota left in every bucket we've used so far.
+func (s *Scheduler) Remaining() map[string]int {
+	s.lock.Lock()
+	limiters := make(map[string]*RateLimiter, len(s.limiters))
+	for k, v := range s.limiters {
+		limiters[k] = v
+	}
+	s.lock.Unlock()
+
+	remaining := make(map[string]int, len(limiters))
+	for k, l := range limiters {
+		remaining[k] = l.Remaining()
+	}
+	return remaining
+}
+
+// observeHeaders feeds the rate limit headers (if the upstream sent any) back into the limiter.
+func observeHeaders(l *RateLimiter, resp *fasthttp.Response) {
+	remaining, err := strconv.Atoi(string(resp.Header.Peek("RateLimit-Remaining")))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.Atoi(string(resp.Header.Peek("RateLimit-Reset")))
+	if err != nil {
+		reset = 0
+	}
+	l.Observe(remaining, time.Duration(reset)*time.Second)
+}
+
+// retryAfter how long a 429 wants us to wait. Hypixel sends RateLimit-Reset, most others Retry-After.
+func retryAfter(resp *fasthttp.Response) time.Duration {
+	for _, name := range []string{"Retry-After", "RateLimit-Reset"} {
+		if secs, err := strconv.Atoi(string(resp.Header.Peek(name))); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return 10 * time.Second // arbitrary. better than hammering
+}
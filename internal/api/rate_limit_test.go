@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedTransport answers hypixel requests per API key: every key has a list of statuses it goes through, the last one repeats.
+// Safe for concurrent use.
+type scriptedTransport struct {
+	lock       sync.Mutex
+	scripts    map[string][]int
+	retryAfter int // seconds, sent with every 429
+	calls      map[string]int
+}
+
+func newScriptedTransport(scripts map[string][]int) *scriptedTransport {
+	return &scriptedTransport{scripts: scripts, calls: make(map[string]int)}
+}
+
+func (s *scriptedTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := string(req.Header.Peek("API-Key"))
+	script := s.scripts[key]
+	status := fasthttp.StatusNotFound
+	if len(script) > 0 {
+		status = script[min(s.calls[key], len(script)-1)]
+	}
+	s.calls[key]++
+
+	resp.SetStatusCode(status)
+	if status == fasthttp.StatusTooManyRequests && s.retryAfter > 0 {
+		resp.Header.Set("Retry-After", strconv.Itoa(s.retryAfter))
+	}
+	resp.SetBodyString(`{"success":true}`)
+	return nil
+}
+
+func (s *scriptedTransport) callsOf(key string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[key]
+}
+
+func (s *scriptedTransport) set(key string, script ...int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.scripts[key] = script
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		capacity      int
+		prepare       func(r *RateLimiter)
+		wantRemaining int
+		wantWait      bool // whether the next request has to wait
+	}{
+		{"fresh bucket is full", 5, func(r *RateLimiter) {}, 5, false},
+		{"requests take tokens", 5, func(r *RateLimiter) {
+			for range 3 {
+				r.reserve()
+			}
+		}, 2, false},
+		{"empty bucket waits", 2, func(r *RateLimiter) {
+			r.reserve()
+			r.reserve()
+		}, 0, true},
+		{"upstream knows better", 100, func(r *RateLimiter) { r.Observe(10, time.Minute) }, 10, false},
+		{"upstream saying 0 pauses until its reset", 100, func(r *RateLimiter) { r.Observe(0, time.Minute) }, 0, true},
+		{"a 429 pauses everyone", 100, func(r *RateLimiter) { r.Throttle(time.Minute) }, 0, true},
+		{"reset gives the whole budget back", 100, func(r *RateLimiter) {
+			r.Observe(0, 0)
+			time.Sleep(time.Millisecond)
+		}, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// refills so slowly it doesn't matter during the test
+			r := NewRateLimiter(tt.capacity, 1000*time.Hour)
+			tt.prepare(r)
+			expect(t, "Remaining()", r.Remaining(), tt.wantRemaining)
+			expect(t, "waits", r.reserve() > 0, tt.wantWait)
+		})
+	}
+
+	t.Run("low budget is spread until the reset", func(t *testing.T) {
+		r := NewRateLimiter(100, 1000*time.Hour)
+		r.Observe(5, time.Minute)
+		if wait := r.reserve(); wait != 0 {
+			t.Fatalf("first reserve() = %v, want 0", wait)
+		}
+		// 4 left for the rest of the minute
+		if wait := r.reserve(); wait < 10*time.Second || wait > 15*time.Second {
+			t.Errorf("second reserve() = %v, want about a quarter of the window", wait)
+		}
+	})
+
+	t.Run("wait gives up with the ctx", func(t *testing.T) {
+		r := NewRateLimiter(100, 1000*time.Hour)
+		r.Throttle(time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := r.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Wait() = %v, want the deadline", err)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Duration
+	}{
+		{"retry after", map[string]string{"Retry-After": "3"}, 3 * time.Second},
+		{"hypixel's reset", map[string]string{"RateLimit-Reset": "42"}, 42 * time.Second},
+		{"retry after wins", map[string]string{"Retry-After": "3", "RateLimit-Reset": "42"}, 3 * time.Second},
+		{"garbage", map[string]string{"Retry-After": "soon"}, 10 * time.Second},
+		{"nothing", nil, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+			for k, v := range tt.headers {
+				resp.Header.Set(k, v)
+			}
+			expect(t, "retryAfter()", retryAfter(resp), tt.want)
+		})
+	}
+}
+
+// hypixelClient a client whose hypixel requests go to `transport`, with retries off so only the key handling is tested.
+func hypixelClient(keys []string, transport Transport) *HypixelApiClient {
+	return Init(keys,
+		WithEndpoints(Endpoints{Hypixel: "http://hypixel.test/", Skyblock: "http://hypixel.test/skyblock/"}),
+		WithTransport(transport),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	)
+}
+
+func TestHypixelStatuses(t *testing.T) {
+	tests := []struct {
+		name        string
+		scripts     map[string][]int
+		wantErr     error
+		wantHealthy int
+		wantCalls   map[string]int
+	}{
+		{"healthy key", map[string][]int{"a": {200}}, nil, 1, map[string]int{"a": 1}},
+		{"rejected key moves on to the next one", map[string][]int{"a": {403}, "b": {200}}, nil, 1, map[string]int{"a": 1, "b": 1}},
+		{"rate limited key moves on to the next one", map[string][]int{"a": {429}, "b": {200}}, nil, 1, map[string]int{"a": 1, "b": 1}},
+		{"every key rejected", map[string][]int{"a": {403}, "b": {403}}, ErrInvalidKey, 0, map[string]int{"a": 1, "b": 1}},
+		{"404 says nothing about the key", map[string][]int{"a": {404}}, ErrNotFound, 1, map[string]int{"a": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newScriptedTransport(tt.scripts)
+			transport.retryAfter = 60
+			var keys []string
+			for key := range tt.scripts {
+				keys = append(keys, key)
+			}
+			// a first, so the failing key is the one picked first
+			slices.Sort(keys)
+			cl := hypixelClient(keys, transport)
+
+			var dst map[string]any
+			err := cl.Get(cl.Endpoints.Skyblock+"bazaar", &dst)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Get() = %v, want %v", err, tt.wantErr)
+			}
+			expect(t, "Healthy()", cl.Keys.Healthy(), tt.wantHealthy)
+			for key, want := range tt.wantCalls {
+				expect(t, "calls with "+key, transport.callsOf(key), want)
+			}
+		})
+	}
+
+	t.Run("a lone rate limited key is waited out", func(t *testing.T) {
+		transport := newScriptedTransport(map[string][]int{"a": {429, 200}})
+		transport.retryAfter = 1
+		cl := hypixelClient([]string{"a"}, transport)
+
+		start := time.Now()
+		var dst map[string]any
+		if err := cl.Get(cl.Endpoints.Skyblock+"bazaar", &dst); err != nil {
+			t.Fatalf("Get() = %v", err)
+		}
+		if waited := time.Since(start); waited < time.Second {
+			t.Errorf("waited %v, want at least the Retry-After", waited)
+		}
+		expect(t, "calls", transport.callsOf("a"), 2)
+	})
+}
+
+func TestKeyRecovery(t *testing.T) {
+	transport := newScriptedTransport(map[string][]int{"a": {404}, "b": {403}})
+	cl := hypixelClient([]string{"a", "b"}, transport)
+
+	ok, err := CheckApiKey(cl)
+	if !ok || err != nil {
+		t.Fatalf("CheckApiKey() = %v, %v", ok, err)
+	}
+	expect(t, "Healthy()", cl.Keys.Healthy(), 1)
+	if invalid := cl.Keys.Invalid(); len(invalid) != 1 || invalid[0] != "b" {
+		t.Fatalf("Invalid() = %v, want [b]", invalid)
+	}
+
+	// until hypixel takes b back, requests only ever use a
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dst map[string]any
+			_ = cl.Get(cl.Endpoints.Skyblock+"bazaar", &dst)
+		}()
+	}
+	wg.Wait()
+	expect(t, "calls with b", transport.callsOf("b"), 1)
+
+	transport.set("b", 404)
+	StartKeyRecovery(cl, 5*time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for cl.Keys.Healthy() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	expect(t, "Healthy() after recovery", cl.Keys.Healthy(), 2)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy how often (and how patiently) failed requests are retried. Only transient failures (network errors, 5xx) are retried,
+// a 404 won't magically become a 200.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first one. 1 = no retries
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration
+	Multiplier  float64 // delay grows by this much every retry
+	Jitter      float64 // 0-1. how much of the delay is randomised so every worker doesn't retry at the exact same moment
+}
+
+// DefaultRetryPolicy 3 attempts over ~1s. Enough to survive a hiccup without holding up a bazaar refresh for long.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   250 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Multiplier:  2,
+		Jitter:      0.5,
+	}
+}
+
+// backoff is the delay before retry number `retry` (0 based).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(retry))
+	if d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	// keep (1-jitter) of the delay, randomise the rest
+	d = d*(1-p.Jitter) + rand.Float64()*d*p.Jitter
+	return time.Duration(d)
+}
+
+// isTransient something that might work if we just try again. An open breaker is "unavailable" too but retrying it is pointless.
+func isTransient(err error) bool {
+	return errors.Is(err, ErrUpstreamUnavailable) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// call is do() with retries and the circuit breaker of the upstream around it.
+func (cl *HypixelApiClient) call(ctx context.Context, url string, fixedKey string, body []byte, handle func(resp *fasthttp.Response) error) error {
+	breaker := cl.breakerFor(cl.upstreamOf(url))
+	var err error
+	for attempt := 0; attempt < max(cl.Retry.MaxAttempts, 1); attempt++ {
+		if attempt > 0 {
+			if err := sleepCtx(ctx, cl.Retry.backoff(attempt-1)); err != nil {
+				return err
+			}
+		}
+		if err = breaker.Allow(); err != nil {
+			return err
+		}
+
+		err = cl.do(ctx, url, fixedKey, body, handle)
+		if ctx.Err() != nil {
+			// we gave up, says nothing about the upstream's health. a half-open probe has to be let go though, or nobody probes again
+			breaker.Cancel()
+			return err
+		}
+		if !isTransient(err) {
+			// even an error here means the upstream answered, so it's alive
+			breaker.Success()
+			return err
+		}
+		breaker.Failure()
+	}
+	return err
+}
+
+// sleepCtx sleeps for d unless ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transportFunc lets a plain function be the client's transport.
+type transportFunc func(req *fasthttp.Request, resp *fasthttp.Response) error
+
+func (f transportFunc) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return f(req, resp)
+}
+
+// quickRetries retries without making the tests wait.
+var quickRetries = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Multiplier: 2}
+
+// otherUrl belongs to no known upstream, so it has no api key and the catch-all breaker.
+const otherUrl = "http://other.test/thing"
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	tests := []struct {
+		name   string
+		jitter float64
+		retry  int
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"first retry is the base delay", 0, 0, 100 * time.Millisecond, 100 * time.Millisecond},
+		{"grows every retry", 0, 2, 400 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", 0, 10, time.Second, time.Second},
+		{"jitter only takes away", 0.5, 1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{"jitter on the cap", 0.5, 10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy.Jitter = tt.jitter
+			for range 20 {
+				if got := policy.backoff(tt.retry); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %v, want %v-%v", tt.retry, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestCallRetries(t *testing.T) {
+	networkErr := errors.New("connection reset")
+	tests := []struct {
+		name      string
+		statuses  []int // 0 = network error
+		threshold int   // of the breaker
+		wantErr   error
+		wantCalls int
+	}{
+		{"success", []int{200}, 5, nil, 1},
+		{"5xx is retried", []int{500, 502, 200}, 5, nil, 3},
+		{"network errors are retried", []int{0, 200}, 5, nil, 2},
+		{"gives up after the last attempt", []int{503}, 5, ErrUpstreamUnavailable, 3},
+		{"404 is not retried", []int{404}, 5, ErrNotFound, 1},
+		{"open breaker stops the retries", []int{500}, 2, ErrCircuitOpen, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			transport := transportFunc(func(req *fasthttp.Request, resp *fasthttp.Response) error {
+				status := tt.statuses[min(calls, len(tt.statuses)-1)]
+				calls++
+				if status == 0 {
+					return networkErr
+				}
+				resp.SetStatusCode(status)
+				resp.SetBodyString(`{}`)
+				return nil
+			})
+			cl := Init(nil, WithTransport(transport), WithRetryPolicy(quickRetries), WithCircuitBreaker("", tt.threshold, time.Minute))
+
+			var dst map[string]any
+			err := cl.Get(otherUrl, &dst)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Get() = %v, want %v", err, tt.wantErr)
+			}
+			expect(t, "calls", calls, tt.wantCalls)
+		})
+	}
+}
+
+// TestCallCancelledProbe a probe that's given up on mustn't keep the breaker half-open (and refusing everything) forever.
+func TestCallCancelledProbe(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		healthy bool
+	)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	transport := transportFunc(func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		lock.Lock()
+		ok := healthy
+		lock.Unlock()
+		if ok {
+			resp.SetStatusCode(200)
+			resp.SetBodyString(`{}`)
+			return nil
+		}
+		// hangs until the test is over
+		<-release
+		return errors.New("too late")
+	})
+	cl := Init(nil, WithTransport(transport), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}), WithCircuitBreaker("", 1, 10*time.Millisecond))
+	breaker := cl.breakerFor("")
+	breaker.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	// the probe hangs and its caller gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var dst map[string]any
+	if err := cl.GetCtx(ctx, otherUrl, &dst); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetCtx() = %v, want the deadline", err)
+	}
+
+	lock.Lock()
+	healthy = true
+	lock.Unlock()
+	if err := cl.Get(otherUrl, &dst); err != nil {
+		t.Fatalf("Get() after the cancelled probe = %v, want it to probe again", err)
+	}
+	expect(t, "Open()", breaker.Open(), false)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"Hyflip-Server/internal/env"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fixture is one saved response. Stored as plain json so they can be hand-edited for tests.
+type fixture struct {
+	Method      string            `json:"method"`
+	Url         string            `json:"url"`
+	Status      int               `json:"status"`
+	ContentType string            `json:"contentType"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body"`
+}
+
+// RecordingTransport sends requests through Inner and saves every response in Dir, so they can be served later by ReplayTransport.
+type RecordingTransport struct {
+	Inner Transport
+	Dir   string
+
+	lock sync.Mutex // two workers recording the same url at once would write garbage otherwise
+}
+
+// ReplayTransport serves responses saved by RecordingTransport. Never touches the network.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *RecordingTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	if err := t.Inner.Do(req, resp); err != nil {
+		return err
+	}
+
+	f := fixture{
+		Method:      string(req.Header.Method()),
+		Url:         string(req.URI().FullURI()),
+		Status:      resp.StatusCode(),
+		ContentType: string(resp.Header.ContentType()),
+		Headers:     make(map[string]string),
+		Body:        string(resp.Body()),
+	}
+	// only the headers we actually care about. the rest is noise in the fixture files
+	for _, name := range []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"} {
+		if v := resp.Header.Peek(name); len(v) > 0 {
+			f.Headers[name] = string(v)
+		}
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := os.MkdirAll(t.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	// recording failing shouldn't break the actual request, just complain about it
+	if err := os.WriteFile(fixturePath(t.Dir, f.Method, f.Url, req.Body()), data, 0666); err != nil {
+		log.Println("Could not record fixture for " + f.Url + ". Error: " + err.Error())
+	}
+	return nil
+}
+
+func (t *ReplayTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	url := string(req.URI().FullURI())
+	method := string(req.Header.Method())
+	data, err := os.ReadFile(fixturePath(t.Dir, method, url, req.Body()))
+	if err != nil {
+		return errors.New("no fixture recorded for " + method + " " + url)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return errors.New("corrupt fixture for " + url + ": " + err.Error())
+	}
+
+	resp.SetStatusCode(f.Status)
+	resp.Header.SetContentType(f.ContentType)
+	for k, v := range f.Headers {
+		resp.Header.Set(k, v)
+	}
+	resp.SetBodyString(f.Body)
+	return nil
+}
+
+// fixturePath turns a request (method, url and the body, for POSTs) into a readable-ish, unique file name. The API key is a
+// header so it never ends up in here.
+func fixturePath(dir string, method string, url string, body []byte) string {
+	sum := sha1.Sum([]byte(method + " " + url + "\n" + string(body)))
+	name := url
+	name = strings.TrimPrefix(name, "https://")
+	name = strings.TrimPrefix(name, "http://")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return filepath.Join(dir, method+"_"+name+"_"+hex.EncodeToString(sum[:4])+".json")
+}
+
+// OptionsFromEnv builds the client options from the .env (upstream overrides and record/replay mode). Returns nothing if nothing is set.
+func OptionsFromEnv() []ClientOption {
+	var opts []ClientOption
+
+	endpoints := Endpoints{
+		Hypixel:       os.Getenv(env.HYPIXEL_API_URL),
+		Skyblock:      os.Getenv(env.SKYBLOCK_API_URL),
+		MojangUuid:    os.Getenv(env.MOJANG_UUID_URL),
+		MojangBulk:    os.Getenv(env.MOJANG_BULK_URL),
+		MojangProfile: os.Getenv(env.MOJANG_PROFILE_URL),
+		PriceTracker:  os.Getenv(env.PRICE_TRACKER_URL),
+		LowestBin:     os.Getenv(env.LOWEST_BIN_URL),
+	}
+	if endpoints != (Endpoints{}) {
+		opts = append(opts, WithEndpoints(endpoints))
+	}
+
+	dir := os.Getenv(env.FIXTURES_DIR)
+	if dir == "" {
+		dir = "fixtures"
+	}
+	switch os.Getenv(env.TRANSPORT_MODE) {
+	case "record":
+		log.Println("Recording every upstream response to " + dir + ".")
+		opts = append(opts, WithTransport(&RecordingTransport{
+			Inner: &fasthttp.Client{MaxConnsPerHost: 1000},
+			Dir:   dir,
+		}))
+	case "replay":
+		log.Println("Replaying upstream responses from " + dir + ". No real requests will be made.")
+		opts = append(opts, WithTransport(&ReplayTransport{Dir: dir}))
+	}
+	return opts
+}
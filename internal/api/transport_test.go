@@ -0,0 +1,170 @@
+package api
+
+import (
+	"Hyflip-Server/internal/env"
+	"context"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cannedTransport answers every request with the same response and remembers what it was asked.
+type cannedTransport struct {
+	status  int
+	headers map[string]string
+	body    string
+	calls   int
+}
+
+func (c *cannedTransport) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	c.calls++
+	resp.SetStatusCode(c.status)
+	resp.Header.SetContentType("application/json")
+	for k, v := range c.headers {
+		resp.Header.Set(k, v)
+	}
+	resp.SetBodyString(c.body)
+	return nil
+}
+
+// fixtureDir the recorded set at the root of the repo.
+const fixtureDir = "../../fixtures"
+
+func TestFixturePath(t *testing.T) {
+	base := fixturePath("dir", "GET", "https://api.mojang.com/users/profiles/minecraft/Technoblade", nil)
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		same   bool
+	}{
+		{"same request, same file", "GET", "https://api.mojang.com/users/profiles/minecraft/Technoblade", "", true},
+		{"method is part of the key", "POST", "https://api.mojang.com/users/profiles/minecraft/Technoblade", "", false},
+		{"body is part of the key", "GET", "https://api.mojang.com/users/profiles/minecraft/Technoblade", `["technoblade"]`, false},
+		{"url is part of the key", "GET", "https://api.mojang.com/users/profiles/minecraft/Dream", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fixturePath("dir", tt.method, tt.url, []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("fixturePath() = %s, base %s, want same = %v", got, base, tt.same)
+			}
+		})
+	}
+
+	t.Run("readable and bounded", func(t *testing.T) {
+		if name := filepath.Base(base); !strings.HasPrefix(name, "GET_api_mojang_com_users_profiles_minecraft_Technoblade_") {
+			t.Errorf("fixturePath() = %s, want the method and url in the name", name)
+		}
+		long := fixturePath("dir", "GET", "https://example.com/"+strings.Repeat("a", 500), nil)
+		if name := filepath.Base(long); len(name) > 100 {
+			t.Errorf("fixturePath() = %d chars long, want the url cut short", len(name))
+		}
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	inner := &cannedTransport{status: 429, headers: map[string]string{"Retry-After": "7"}, body: `{"success":false}`}
+	recorder := &RecordingTransport{Inner: inner, Dir: dir}
+	replay := &ReplayTransport{Dir: dir}
+
+	exchange := func(transport Transport, method string, body string) (*fasthttp.Response, error) {
+		req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		req.SetRequestURI("https://api.hypixel.net/v2/skyblock/bazaar")
+		req.Header.SetMethod(method)
+		req.SetBodyString(body)
+		return resp, transport.Do(req, resp)
+	}
+
+	if _, err := exchange(recorder, "POST", "a"); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	resp, err := exchange(replay, "POST", "a")
+	if err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	defer fasthttp.ReleaseResponse(resp)
+	if resp.StatusCode() != 429 || string(resp.Header.Peek("Retry-After")) != "7" || string(resp.Body()) != `{"success":false}` {
+		t.Errorf("replayed %d %q %q, want what was recorded", resp.StatusCode(), resp.Header.Peek("Retry-After"), resp.Body())
+	}
+
+	for _, tt := range []struct{ method, body string }{{"GET", "a"}, {"POST", "b"}} {
+		if _, err := exchange(replay, tt.method, tt.body); err == nil || !strings.Contains(err.Error(), "no fixture recorded") {
+			t.Errorf("replaying an unrecorded %s %q: err = %v, want no fixture", tt.method, tt.body, err)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("inner transport called %d times, want 1", inner.calls)
+	}
+}
+
+func TestReplayFixtures(t *testing.T) {
+	cl := Init([]string{"test-key"}, WithTransport(&ReplayTransport{Dir: fixtureDir}))
+
+	t.Run("api key check", func(t *testing.T) {
+		ok, err := CheckApiKey(cl)
+		if !ok || err != nil {
+			t.Fatalf("CheckApiKey() = %v, %v, want true", ok, err)
+		}
+		if cl.Keys.Healthy() != 1 {
+			t.Errorf("Healthy() = %d, want 1", cl.Keys.Healthy())
+		}
+	})
+
+	t.Run("uuid of an account", func(t *testing.T) {
+		id, err := GetMojangUuid(cl, "Technoblade")
+		if err != nil || id != "b876ec32e396476ba1158438d83c67d4" {
+			t.Errorf("GetMojangUuid() = %q, %v", id, err)
+		}
+	})
+
+	t.Run("uuid of an unknown account", func(t *testing.T) {
+		// the path account creation takes, unknown names are cached so the second lookup has no fixture to hit
+		resolver := NewMojangResolver(cl, 10, 0, time.Hour)
+		for range 2 {
+			if _, err := resolver.Uuid(context.Background(), "NotARealPlayer123"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Uuid() err = %v, want ErrNotFound", err)
+			}
+		}
+	})
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		transport func(Transport) bool
+	}{
+		{"default is the real client", "", func(tr Transport) bool { _, ok := tr.(*fasthttp.Client); return ok }},
+		{"record", "record", func(tr Transport) bool {
+			r, ok := tr.(*RecordingTransport)
+			return ok && r.Dir == "somewhere"
+		}},
+		{"replay", "replay", func(tr Transport) bool {
+			r, ok := tr.(*ReplayTransport)
+			return ok && r.Dir == "somewhere"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(env.TRANSPORT_MODE, tt.mode)
+			t.Setenv(env.FIXTURES_DIR, "somewhere")
+			t.Setenv(env.MOJANG_UUID_URL, "http://localhost:1234/uuid/")
+
+			cl := Init(nil, OptionsFromEnv()...)
+			if !tt.transport(cl.Client) {
+				t.Errorf("transport = %T", cl.Client)
+			}
+			if cl.Endpoints.MojangUuid != "http://localhost:1234/uuid/" || cl.Endpoints.Hypixel != DefaultEndpoints().Hypixel {
+				t.Errorf("endpoints = %+v, want only the mojang uuid one overridden", cl.Endpoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/portfolio"
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxRange the longest range one backtest replays. bazaar_history only keeps 30 days anyway
+	MaxRange = 31 * 24 * time.Hour
+	// DefaultStepMinutes default for Request.StepMinutes
+	DefaultStepMinutes = 5
+	// DefaultMaxOrderHours default for Request.MaxOrderHours
+	DefaultMaxOrderHours = 24
+	// DefaultFillShare default for Request.FillShare
+	DefaultFillShare = 0.5
+)
+
+// ErrNoSnapshots nothing was recorded in the range.
+var ErrNoSnapshots = errors.New("no recorded bazaar snapshots in that range")
+
+// Source replays recorded bazaar polls, oldest first (storage.BazaarHistoryTable).
+type Source interface {
+	ReplayBazaar(ctx context.Context, from time.Time, to time.Time, fn func(at time.Time, products map[string]flippers.Product) error) error
+}
+
+// Request what to backtest a config over.
+type Request struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Purse coins we start with
+	Purse float64 `json:"purse"`
+	// Slots bazaar order slots. every flip takes one until it's sold
+	Slots int `json:"slots"`
+	// StepMinutes how often new flips are picked. Fills are simulated on every snapshot
+	StepMinutes float64 `json:"stepMinutes"`
+	// MaxOrderHours buy orders that haven't filled by then are cancelled (what did fill gets sold), sell offers get relisted at the current price
+	MaxOrderHours float64 `json:"maxOrderHours"`
+	// FillShare share (0-1) of what the market trades that goes to our order while it's on top of the book
+	FillShare float64 `json:"fillShare"`
+}
+
+// Validate rejects requests that can't be run. 0 for StepMinutes, MaxOrderHours or FillShare means the default.
+func (r *Request) Validate() error {
+	var errs []error
+	if !r.To.After(r.From) {
+		errs = append(errs, errors.New("to has to be after from"))
+	} else if r.To.Sub(r.From) > MaxRange {
+		errs = append(errs, errors.New("the range can be 31 days at most"))
+	}
+	if r.Purse <= 0 {
+		errs = append(errs, errors.New("purse has to be positive"))
+	}
+	if r.Slots <= 0 || r.Slots > portfolio.MaxSlots {
+		errs = append(errs, errors.New("slots has to be between 1 and 35"))
+	}
+	if r.StepMinutes < 0 || r.MaxOrderHours < 0 {
+		errs = append(errs, errors.New("stepMinutes and maxOrderHours can't be negative"))
+	}
+	if r.FillShare < 0 || r.FillShare > 1 {
+		errs = append(errs, errors.New("fillShare is a share, it has to be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
+
+func (r Request) withDefaults() Request {
+	if r.StepMinutes == 0 {
+		r.StepMinutes = DefaultStepMinutes
+	}
+	if r.MaxOrderHours == 0 {
+		r.MaxOrderHours = DefaultMaxOrderHours
+	}
+	if r.FillShare == 0 {
+		r.FillShare = DefaultFillShare
+	}
+	return r
+}
+
+// Report how a config would have done.
+type Report struct {
+	Request   Request   `json:"request"`
+	Snapshots int       `json:"snapshots"`
+	FirstAt   time.Time `json:"firstAt"`
+	LastAt    time.Time `json:"lastAt"`
+
+	FinalEquity float64 `json:"finalEquity"`
+	// PnL FinalEquity minus the purse. RealizedPnL is the part from closed trades, UnrealizedPnL whatever is still open at
+	// its liquidation value (insta-selling it)
+	PnL              float64 `json:"pnl"`
+	RealizedPnL      float64 `json:"realizedPnl"`
+	UnrealizedPnL    float64 `json:"unrealizedPnl"`
+	ReturnPercentage float64 `json:"returnPercentage"`
+	// ProfitPerHour PnL over the replayed time
+	ProfitPerHour float64 `json:"profitPerHour"`
+
+	// Trades flips that were bought and sold completely. HitRatePercentage how many of them made money
+	Trades            int     `json:"trades"`
+	Wins              int     `json:"wins"`
+	HitRatePercentage float64 `json:"hitRatePercentage"`
+	// Cancelled buy orders that never filled at all
+	Cancelled int `json:"cancelled"`
+	// Relisted sell offers that had to follow the price down
+	Relisted      int `json:"relisted"`
+	OpenPositions int `json:"openPositions"`
+	// FlipsPerCycle how many flips the config was sent per pick on average, MaxFlipsPerCycle at most
+	FlipsPerCycle    float64 `json:"flipsPerCycle"`
+	MaxFlipsPerCycle int     `json:"maxFlipsPerCycle"`
+	// ManipulationRejections how often the manipulation check stopped a flip that passed everything else
+	ManipulationRejections int `json:"manipulationRejections"`
+
+	// PeakCapital most coins in orders and unsold items at once, AverageCapital the same averaged over time (0 if the range
+	// only had one snapshot, there's no time to average over)
+	PeakCapital          float64 `json:"peakCapital"`
+	AverageCapital       float64 `json:"averageCapital"`
+	CapitalUsePercentage float64 `json:"capitalUsePercentage"`
+	// MaxDrawdown biggest fall of equity (marked at liquidation value) from an earlier peak
+	MaxDrawdown           float64 `json:"maxDrawdown"`
+	MaxDrawdownPercentage float64 `json:"maxDrawdownPercentage"`
+
+	// Products every product that was traded, best PnL first
+	Products []ProductResult `json:"products"`
+}
+
+// ProductResult the closed trades of one product.
+type ProductResult struct {
+	ProductID string  `json:"productId"`
+	Trades    int     `json:"trades"`
+	Wins      int     `json:"wins"`
+	PnL       float64 `json:"pnl"`
+}
+
+// Run replays the recorded polls between req.From and req.To through conf, trading the flips it would have been sent.
+func Run(ctx context.Context, src Source, conf *config.BZConfig, req Request) (*Report, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	req = req.withDefaults()
+
+	m := newMarket()
+	sim := newSimulation(conf, req, m)
+	if err := replay(ctx, src, req, m, []*simulation{sim}); err != nil {
+		return nil, err
+	}
+	return sim.report(), nil
+}
+
+// replay feeds every poll of the range to every simulation. They're independent of each other, so each poll is stepped
+// through by a few workers at once.
+func replay(ctx context.Context, src Source, req Request, m *market, sims []*simulation) error {
+	workers := min(len(sims), runtime.GOMAXPROCS(0))
+	snapshots := 0
+	var lastAt time.Time
+	err := src.ReplayBazaar(ctx, req.From, req.To, func(at time.Time, products map[string]flippers.Product) error {
+		if snapshots > 0 && !at.After(lastAt) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.observe(at, products)
+
+		var (
+			wg   sync.WaitGroup
+			next atomic.Int32
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := int(next.Add(1)) - 1; j < len(sims); j = int(next.Add(1)) - 1 {
+					sims[j].step(at, products)
+				}
+			}()
+		}
+		wg.Wait()
+
+		m.prev, lastAt = products, at
+		snapshots++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if snapshots == 0 {
+		return ErrNoSnapshots
+	}
+	return nil
+}
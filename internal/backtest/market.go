@@ -0,0 +1,84 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/manipulation"
+	"sync"
+	"time"
+)
+
+// historyStep sell prices are kept at most this often per product for the manipulation check. every poll would be a lot of
+// memory for a week of history and the detectors don't need it
+const historyStep = 10 * time.Minute
+
+// market is what every simulation of a replay sees: the polls so far and what was learned from them. None of it depends on
+// a config, so a sweep over a hundred configs still only tracks the bazaar once.
+type market struct {
+	tracker *flippers.SnapshotTracker
+	history map[string]*priceHistory
+	// prev the previous poll, traded volumes are the difference to it
+	prev map[string]flippers.Product
+
+	// measured manipulation measurements of the current poll, filled as simulations ask for them
+	lock     sync.Mutex
+	measured map[string]manipulation.Measurements
+}
+
+// priceHistory recorded sell prices of one product, oldest first.
+type priceHistory struct {
+	times  []time.Time
+	prices []float64
+}
+
+func newMarket() *market {
+	return &market{
+		tracker:  flippers.NewSnapshotTracker(),
+		history:  make(map[string]*priceHistory),
+		measured: make(map[string]manipulation.Measurements),
+	}
+}
+
+// observe a new poll, before the simulations step through it.
+func (m *market) observe(at time.Time, products map[string]flippers.Product) {
+	m.tracker.Observe(at, products)
+	m.measured = make(map[string]manipulation.Measurements)
+
+	cutoff := at.Add(-flippers.PriceHistoryTimeSpan)
+	for id, product := range products {
+		h, ok := m.history[id]
+		if !ok {
+			h = &priceHistory{}
+			m.history[id] = h
+		}
+		if n := len(h.times); n > 0 && at.Sub(h.times[n-1]) < historyStep {
+			continue
+		}
+
+		drop := 0
+		for drop < len(h.times) && h.times[drop].Before(cutoff) {
+			drop++
+		}
+		h.times = append(h.times[drop:], at)
+		h.prices = append(h.prices[drop:], product.QuickStatus.SellPrice)
+	}
+}
+
+// measure the manipulation measurements of a product of the current poll, only computed once per poll.
+func (m *market) measure(product *flippers.Product) manipulation.Measurements {
+	m.lock.Lock()
+	measurements, ok := m.measured[product.ProductID]
+	m.lock.Unlock()
+	if ok {
+		return measurements
+	}
+
+	var history []float64
+	if h := m.history[product.ProductID]; h != nil {
+		history = h.prices
+	}
+	measurements = flippers.MeasureReplay(product, history)
+	m.lock.Lock()
+	m.measured[product.ProductID] = measurements
+	m.lock.Unlock()
+	return measurements
+}
@@ -0,0 +1,341 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/manipulation"
+	"Hyflip-Server/internal/portfolio"
+	"sort"
+	"time"
+)
+
+const (
+	// taxFactor what's left of a sale after the bazaar tax
+	taxFactor    = 1 - flippers.BazaarTax/100.0
+	hoursPerWeek = 7 * 24
+)
+
+type orderState int
+
+const (
+	buying orderState = iota
+	selling
+)
+
+// position one flip in progress: a buy order, then a sell offer for whatever it bought.
+type position struct {
+	productId string
+	state     orderState
+	volume    int
+	buyPrice  float64
+	sellPrice float64
+	listedAt  time.Time
+	bought    int
+	sold      int
+	// buyFill/sellFill units traded our way so far that aren't whole units yet
+	buyFill  float64
+	sellFill float64
+	spent    float64
+	proceeds float64
+	// mark what one unit goes for right now (insta-selling it, taxed)
+	mark float64
+}
+
+// escrow coins still sitting in the buy order.
+func (p *position) escrow() float64 {
+	if p.state != buying {
+		return 0
+	}
+	return float64(p.volume-p.bought) * p.buyPrice
+}
+
+// inventory units bought and not sold yet.
+func (p *position) inventory() int {
+	return p.bought - p.sold
+}
+
+// simulation is one config being backtested. step is fed every poll in order, after the market observed it.
+type simulation struct {
+	conf        *config.BZConfig
+	req         Request
+	market      *market
+	scorer      flippers.Scorer
+	pickEvery   time.Duration
+	maxOrderAge time.Duration
+
+	positions map[string]*position
+	results   map[string]*ProductResult
+	cash      float64
+
+	snapshots int
+	firstAt   time.Time
+	lastAt    time.Time
+	lastPick  time.Time
+
+	equity                 float64
+	peakEquity             float64
+	maxDrawdown            float64
+	maxDrawdownPercentage  float64
+	capital                float64
+	peakCapital            float64
+	capitalHours           float64
+	realized               float64
+	trades                 int
+	wins                   int
+	cancelled              int
+	relisted               int
+	manipulationRejections int
+	// cycles picks made, flipsSent flips the config was sent over all of them
+	cycles           int
+	flipsSent        int
+	maxFlipsPerCycle int
+}
+
+func newSimulation(conf *config.BZConfig, req Request, m *market) *simulation {
+	return &simulation{
+		conf:        conf,
+		req:         req,
+		market:      m,
+		scorer:      flippers.ScorerFor(conf),
+		pickEvery:   time.Duration(req.StepMinutes * float64(time.Minute)),
+		maxOrderAge: time.Duration(req.MaxOrderHours * float64(time.Hour)),
+		positions:   make(map[string]*position),
+		results:     make(map[string]*ProductResult),
+		cash:        req.Purse,
+		equity:      req.Purse,
+		peakEquity:  req.Purse,
+	}
+}
+
+// step one poll: fill what's open, pick new flips if it's time, then mark everything to market.
+func (s *simulation) step(at time.Time, products map[string]flippers.Product) {
+	if s.snapshots == 0 {
+		s.firstAt = at
+	} else {
+		// whatever was tied up since the last poll was tied up for that long
+		elapsed := at.Sub(s.lastAt)
+		s.capitalHours += s.capital * elapsed.Hours()
+		s.fill(at, elapsed, products)
+	}
+
+	if s.snapshots == 0 || at.Sub(s.lastPick) >= s.pickEvery {
+		s.pick(at, products)
+		s.lastPick = at
+	}
+	s.account(products)
+
+	s.lastAt = at
+	s.snapshots++
+}
+
+// fill gives every open order its share of what traded since the last poll, as long as it's still on top of the book.
+func (s *simulation) fill(at time.Time, elapsed time.Duration, products map[string]flippers.Product) {
+	for id, p := range s.positions {
+		product, ok := products[id]
+		prev, seen := s.market.prev[id]
+		if !ok || !seen {
+			continue
+		}
+		qs := product.QuickStatus
+
+		switch p.state {
+		case buying:
+			// insta-sells fill buy orders. outbid = nothing comes our way
+			if qs.SellPrice <= p.buyPrice {
+				p.buyFill += traded(qs.SellMovingWeek, prev.QuickStatus.SellMovingWeek, elapsed) * s.req.FillShare
+				units := min(int(p.buyFill), p.volume-p.bought)
+				p.buyFill -= float64(units)
+				p.bought += units
+				p.spent += float64(units) * p.buyPrice
+			}
+			if p.bought < p.volume && at.Sub(p.listedAt) < s.maxOrderAge {
+				continue
+			}
+			// filled or given up on, either way the rest of the escrow comes back and what we have gets sold
+			s.cash += p.escrow()
+			if p.bought == 0 {
+				s.cancelled++
+				delete(s.positions, id)
+				continue
+			}
+			p.state, p.sellPrice, p.listedAt = selling, qs.BuyPrice, at
+
+		case selling:
+			// insta-buys fill sell offers. undercut = nothing comes our way
+			if qs.BuyPrice >= p.sellPrice {
+				p.sellFill += traded(qs.BuyMovingWeek, prev.QuickStatus.BuyMovingWeek, elapsed) * s.req.FillShare
+				units := min(int(p.sellFill), p.inventory())
+				p.sellFill -= float64(units)
+				p.sold += units
+				proceeds := float64(units) * p.sellPrice * taxFactor
+				p.proceeds += proceeds
+				s.cash += proceeds
+			}
+			if p.inventory() == 0 {
+				s.close(p)
+				delete(s.positions, id)
+				continue
+			}
+			if at.Sub(p.listedAt) >= s.maxOrderAge && qs.BuyPrice < p.sellPrice {
+				p.sellPrice, p.listedAt = qs.BuyPrice, at
+				s.relisted++
+			}
+		}
+	}
+}
+
+// traded units the market traded between two polls. The moving week also loses what traded a week ago as it moves, so the
+// weekly average over the elapsed time is added back or a steady market would look like it traded nothing.
+func traded(movingWeek int, prevMovingWeek int, elapsed time.Duration) float64 {
+	return max(float64(movingWeek-prevMovingWeek)+float64(movingWeek)/hoursPerWeek*elapsed.Hours(), 0)
+}
+
+// close books a fully sold position.
+func (s *simulation) close(p *position) {
+	pnl := p.proceeds - p.spent
+	result, ok := s.results[p.productId]
+	if !ok {
+		result = &ProductResult{ProductID: p.productId}
+		s.results[p.productId] = result
+	}
+
+	s.trades++
+	result.Trades++
+	s.realized += pnl
+	result.PnL += pnl
+	if pnl > 0 {
+		s.wins++
+		result.Wins++
+	}
+}
+
+// pick places buy orders for the best flips the config would have been sent, while there are slots and coins for them.
+func (s *simulation) pick(at time.Time, products map[string]flippers.Product) {
+	free := s.req.Slots - len(s.positions)
+	flips := make([]flippers.BazaarFoundFlip, 0)
+	sent := 0
+	for id, product := range products {
+		flip, ok := flippers.ReplayFlip(&product, func() manipulation.Measurements {
+			return s.market.measure(&product)
+		}, s.market.tracker, s.conf)
+		if !ok {
+			if flip.ManipulationVerdict.Manipulated {
+				s.manipulationRejections++
+			}
+			continue
+		}
+		// the user would've been sent it either way, we just can't flip it twice
+		sent++
+		if _, held := s.positions[id]; held {
+			continue
+		}
+		flippers.ScoreFlip(&flip, s.scorer)
+		flips = append(flips, flip)
+	}
+	s.cycles++
+	s.flipsSent += sent
+	s.maxFlipsPerCycle = max(s.maxFlipsPerCycle, sent)
+	sort.Slice(flips, func(i, j int) bool {
+		if flips[i].Score != flips[j].Score {
+			return flips[i].Score > flips[j].Score
+		}
+		return flips[i].ProductID < flips[j].ProductID
+	})
+
+	// no flip gets more than its slot's share of what we have, like spreading the purse over the slots by hand
+	budget := s.equity / float64(s.req.Slots)
+	for _, flip := range flips {
+		if free == 0 {
+			break
+		}
+		if flip.SellPrice <= 0 {
+			continue
+		}
+		volume := min(flip.RecommendedFlipVolume, portfolio.MaxOrderAmount, int(min(budget, s.cash)/flip.SellPrice))
+		if volume < 1 {
+			continue
+		}
+
+		// we match the top buy order and later the top sell offer, same as the flip's prices
+		s.cash -= float64(volume) * flip.SellPrice
+		s.positions[flip.ProductID] = &position{
+			productId: flip.ProductID,
+			state:     buying,
+			volume:    volume,
+			buyPrice:  flip.SellPrice,
+			listedAt:  at,
+		}
+		free--
+	}
+}
+
+// account marks everything to market and updates the capital and drawdown stats.
+func (s *simulation) account(products map[string]flippers.Product) {
+	capital, held := 0.0, 0.0
+	for id, p := range s.positions {
+		if product, ok := products[id]; ok {
+			p.mark = product.QuickStatus.SellPrice * taxFactor
+		}
+		inventory := float64(p.inventory())
+		held += p.escrow() + inventory*p.mark
+		capital += p.escrow()
+		if p.bought > 0 {
+			capital += inventory * p.spent / float64(p.bought)
+		}
+	}
+
+	s.capital = capital
+	s.peakCapital = max(s.peakCapital, capital)
+	s.equity = s.cash + held
+	s.peakEquity = max(s.peakEquity, s.equity)
+	drawdown := s.peakEquity - s.equity
+	s.maxDrawdown = max(s.maxDrawdown, drawdown)
+	s.maxDrawdownPercentage = max(s.maxDrawdownPercentage, drawdown/s.peakEquity*100)
+}
+
+func (s *simulation) report() *Report {
+	report := &Report{
+		Request:                s.req,
+		Snapshots:              s.snapshots,
+		FirstAt:                s.firstAt,
+		LastAt:                 s.lastAt,
+		FinalEquity:            s.equity,
+		PnL:                    s.equity - s.req.Purse,
+		RealizedPnL:            s.realized,
+		Trades:                 s.trades,
+		Wins:                   s.wins,
+		Cancelled:              s.cancelled,
+		Relisted:               s.relisted,
+		OpenPositions:          len(s.positions),
+		ManipulationRejections: s.manipulationRejections,
+		MaxFlipsPerCycle:       s.maxFlipsPerCycle,
+		PeakCapital:            s.peakCapital,
+		MaxDrawdown:            s.maxDrawdown,
+		MaxDrawdownPercentage:  s.maxDrawdownPercentage,
+		Products:               make([]ProductResult, 0, len(s.results)),
+	}
+	report.UnrealizedPnL = report.PnL - report.RealizedPnL
+	report.ReturnPercentage = report.PnL / s.req.Purse * 100
+	if s.trades > 0 {
+		report.HitRatePercentage = float64(s.wins) / float64(s.trades) * 100
+	}
+	if s.cycles > 0 {
+		report.FlipsPerCycle = float64(s.flipsSent) / float64(s.cycles)
+	}
+	if hours := s.lastAt.Sub(s.firstAt).Hours(); hours > 0 {
+		report.AverageCapital = s.capitalHours / hours
+		report.ProfitPerHour = report.PnL / hours
+	}
+	report.CapitalUsePercentage = report.AverageCapital / s.req.Purse * 100
+
+	for _, result := range s.results {
+		report.Products = append(report.Products, *result)
+	}
+	sort.Slice(report.Products, func(i, j int) bool {
+		if report.Products[i].PnL != report.Products[j].PnL {
+			return report.Products[i].PnL > report.Products[j].PnL
+		}
+		return report.Products[i].ProductID < report.Products[j].ProductID
+	})
+	return report
+}
@@ -0,0 +1,159 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeSource replays hand-built polls, one hour apart.
+type fakeSource []map[string]flippers.Product
+
+func (f fakeSource) ReplayBazaar(ctx context.Context, from time.Time, to time.Time, fn func(at time.Time, products map[string]flippers.Product) error) error {
+	for i, products := range f {
+		if err := fn(from.Add(time.Duration(i)*time.Hour), products); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poll one product. sellPrice is where our buy order sits, buyPrice where our sell offer does.
+func poll(sellPrice float64, buyPrice float64, sellMovingWeek int, buyMovingWeek int) map[string]flippers.Product {
+	return map[string]flippers.Product{"A": {
+		ProductID: "A",
+		QuickStatus: flippers.QuickStatus{
+			ProductID:      "A",
+			SellPrice:      sellPrice,
+			SellMovingWeek: sellMovingWeek,
+			BuyPrice:       buyPrice,
+			BuyMovingWeek:  buyMovingWeek,
+		},
+	}}
+}
+
+func TestTraded(t *testing.T) {
+	tests := []struct {
+		name       string
+		movingWeek int
+		prev       int
+		elapsed    time.Duration
+		want       float64
+	}{
+		{"steady market still trades its weekly average", 16800, 16800, time.Hour, 100},
+		{"growth on top of the average", 16800, 16632, time.Hour, 268},
+		{"no time passed", 16900, 16800, 0, 100},
+		{"never negative", 1000, 5000, time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := traded(tt.movingWeek, tt.prev, tt.elapsed); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("traded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	// the first poll places one buy order of 100 (1% of buyMovingWeek/8) at 100, nothing is picked after it
+	conf := &config.BZConfig{
+		Scorer:       "profit",
+		Manipulation: config.ManipulationThresholds{Disabled: []string{"swing", "zscore", "volume_spike", "spoofing"}},
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	req := Request{From: from, To: from.Add(24 * time.Hour), Purse: 100_000, Slots: 1, StepMinutes: 24 * 60, MaxOrderHours: 1.5, FillShare: 0.5}
+
+	tests := []struct {
+		name  string
+		polls fakeSource
+		check func(t *testing.T, r *Report)
+	}{
+		{
+			name:  "single snapshot has no time to average capital over",
+			polls: fakeSource{poll(100, 200, 16800, 80000)},
+			check: func(t *testing.T, r *Report) {
+				expect(t, "OpenPositions", float64(r.OpenPositions), 1)
+				expect(t, "PeakCapital", r.PeakCapital, 10_000)
+				expect(t, "AverageCapital", r.AverageCapital, 0)
+				expect(t, "FinalEquity", r.FinalEquity, 100_000)
+			},
+		},
+		{
+			name: "partial fill turns into a sell offer and sells out",
+			polls: fakeSource{
+				poll(100, 200, 16800, 80000),
+				poll(100, 200, 16800, 80000), // 100 traded, half of it fills 50
+				poll(101, 200, 16800, 80000), // outbid and too old: the other 50 are refunded, the 50 get listed at 200
+				poll(100, 200, 16800, 80000), // 238 insta-bought, sells all 50
+			},
+			check: func(t *testing.T, r *Report) {
+				pnl := 50*200*taxFactor - 50*100
+				expect(t, "Trades", float64(r.Trades), 1)
+				expect(t, "Wins", float64(r.Wins), 1)
+				expect(t, "Cancelled", float64(r.Cancelled), 0)
+				expect(t, "OpenPositions", float64(r.OpenPositions), 0)
+				expect(t, "RealizedPnL", r.RealizedPnL, pnl)
+				expect(t, "FinalEquity", r.FinalEquity, 100_000+pnl)
+				expect(t, "UnrealizedPnL", r.UnrealizedPnL, 0)
+			},
+		},
+		{
+			name: "buy order that never fills is cancelled with its escrow refunded",
+			polls: fakeSource{
+				poll(100, 200, 16800, 80000),
+				poll(101, 200, 16800, 80000),
+				poll(101, 200, 16800, 80000),
+			},
+			check: func(t *testing.T, r *Report) {
+				expect(t, "Cancelled", float64(r.Cancelled), 1)
+				expect(t, "Trades", float64(r.Trades), 0)
+				expect(t, "OpenPositions", float64(r.OpenPositions), 0)
+				expect(t, "FinalEquity", r.FinalEquity, 100_000)
+				expect(t, "PnL", r.PnL, 0)
+			},
+		},
+		{
+			name: "drawdown of unsold items marked at liquidation value",
+			polls: fakeSource{
+				poll(100, 200, 16800, 80000),
+				poll(100, 200, 17000, 80000), // 301 traded, the whole 100 fill
+				poll(50, 150, 17000, 80000),  // undercut and crashed, marked at 50
+			},
+			check: func(t *testing.T, r *Report) {
+				drawdown := 100 * (100 - 50*taxFactor)
+				expect(t, "OpenPositions", float64(r.OpenPositions), 1)
+				expect(t, "MaxDrawdown", r.MaxDrawdown, drawdown)
+				expect(t, "MaxDrawdownPercentage", r.MaxDrawdownPercentage, drawdown/100_000*100)
+				expect(t, "UnrealizedPnL", r.UnrealizedPnL, -drawdown)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Run(context.Background(), tt.polls, conf, req)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			expect(t, "Snapshots", float64(report.Snapshots), float64(len(tt.polls)))
+			tt.check(t, report)
+		})
+	}
+}
+
+func TestRunNoSnapshots(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := Run(context.Background(), fakeSource{}, &config.BZConfig{}, Request{From: from, To: from.Add(time.Hour), Purse: 1, Slots: 1})
+	if err != ErrNoSnapshots {
+		t.Errorf("Run() error = %v, want ErrNoSnapshots", err)
+	}
+}
+
+func expect(t *testing.T, field string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
@@ -0,0 +1,335 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	SearchGrid   = "grid"
+	SearchRandom = "random"
+	// MaxCandidates most configs one sweep tries. each one is a simulation over the whole range
+	MaxCandidates = 200
+	// DefaultSamples default for TuneRequest.Samples
+	DefaultSamples = 50
+	// DefaultTop default for TuneRequest.Top
+	DefaultTop = 5
+	// DefaultTuneStepMinutes default for StepMinutes when tuning. picking every 5 minutes for 200 configs is a lot of filtering
+	DefaultTuneStepMinutes = 30
+	// maxParamValues most values one grid parameter can have
+	maxParamValues = 1000
+)
+
+// tunableFields the BZConfig fields a sweep can change, by their json name.
+var tunableFields = []struct {
+	name    string
+	integer bool
+	set     func(conf *config.BZConfig, v float64)
+}{
+	{"min_profit", true, func(c *config.BZConfig, v float64) { c.MinProfit = int(v) }},
+	{"min_profit_percentage", true, func(c *config.BZConfig, v float64) { c.MinProfitPercentage = int(v) }},
+	{"min_volume_diff", true, func(c *config.BZConfig, v float64) { c.MinVolumeDiff = int(v) }},
+	{"min_buy_volume", true, func(c *config.BZConfig, v float64) { c.MinBuyVolume = int(v) }},
+	{"buy_moving_week", true, func(c *config.BZConfig, v float64) { c.MinBuyMovingWeek = int(v) }},
+	{"sell_moving_week", true, func(c *config.BZConfig, v float64) { c.MinSellMovingWeek = int(v) }},
+	{"min_insta_buys", true, func(c *config.BZConfig, v float64) { c.MinInstaBuys = int(v) }},
+	{"min_insta_sells", true, func(c *config.BZConfig, v float64) { c.MaxInstaSells = int(v) }},
+	{"max_slippage_percentage", false, func(c *config.BZConfig, v float64) { c.MaxSlippagePercentage = v }},
+	{"max_competition_score", false, func(c *config.BZConfig, v float64) { c.MaxCompetitionScore = v }},
+}
+
+// DefaultParams what gets swept if a TuneRequest doesn't say: the profit minimums, the volume difference and the moving weeks.
+// The steps keep the grid at 162 combinations, random search ignores them.
+var DefaultParams = []Param{
+	{Field: "min_profit", Min: 0, Max: 2000, Step: 1000},
+	{Field: "min_profit_percentage", Min: 0, Max: 20, Step: 10},
+	{Field: "min_volume_diff", Min: 0, Max: 1000, Step: 1000},
+	{Field: "buy_moving_week", Min: 0, Max: 40000, Step: 20000},
+	{Field: "sell_moving_week", Min: 0, Max: 40000, Step: 20000},
+}
+
+// Param one BZConfig field to sweep.
+type Param struct {
+	// Field json name of the field (min_profit, buy_moving_week...)
+	Field string `json:"field"`
+	// Values to try. Without them it's Min to Max in steps of Step for grid search, anything between Min and Max for random search
+	Values []float64 `json:"values"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Step   float64   `json:"step"`
+}
+
+// TuneRequest a sweep over BZConfig fields. The embedded Request is the range and account every candidate is backtested with.
+type TuneRequest struct {
+	Request
+	// Params fields to sweep, DefaultParams if empty
+	Params []Param `json:"params"`
+	// Search grid (every combination) or random (Samples random ones). random by default
+	Search  string `json:"search"`
+	Samples int    `json:"samples"`
+	// Seed of the random search, 0 = a different one every time
+	Seed int64 `json:"seed"`
+	// Top how many configs to return
+	Top int `json:"top"`
+	// MaxFlipsPerCycle rules out configs that were ever sent more flips than this in one cycle. 0 = no limit
+	MaxFlipsPerCycle int `json:"maxFlipsPerCycle"`
+	// MinTrades rules out configs with fewer closed trades than this, so one lucky flip doesn't win
+	MinTrades int `json:"minTrades"`
+}
+
+// Validate rejects sweeps that can't be run.
+func (r *TuneRequest) Validate() error {
+	errs := []error{r.Request.Validate()}
+	if r.Search != "" && r.Search != SearchGrid && r.Search != SearchRandom {
+		errs = append(errs, fmt.Errorf("unknown search %q (grid or random)", r.Search))
+	}
+	if r.Samples < 0 || r.Samples > MaxCandidates {
+		errs = append(errs, fmt.Errorf("samples has to be between 0 (the default, %d) and %d", DefaultSamples, MaxCandidates))
+	}
+	if r.Top < 0 || r.MaxFlipsPerCycle < 0 || r.MinTrades < 0 {
+		errs = append(errs, errors.New("top, maxFlipsPerCycle and minTrades can't be negative"))
+	}
+
+	seen := make(map[string]bool)
+	paramsOk := true
+	for i, p := range r.Params {
+		if seen[p.Field] {
+			errs = append(errs, fmt.Errorf("params[%d]: %s is swept twice", i, p.Field))
+		}
+		seen[p.Field] = true
+		if err := p.validate(r.Search == SearchGrid); err != nil {
+			errs = append(errs, fmt.Errorf("params[%d]: %w", i, err))
+			paramsOk = false
+		}
+	}
+	if r.Search == SearchGrid && paramsOk {
+		params := r.Params
+		if len(params) == 0 {
+			params = DefaultParams
+		}
+		total := 1
+		for i := range params {
+			if total *= len(params[i].grid()); total > MaxCandidates {
+				errs = append(errs, fmt.Errorf("the grid has more than %d combinations, use fewer values or random search", MaxCandidates))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Param) validate(grid bool) error {
+	if tunableField(p.Field) < 0 {
+		names := make([]string, len(tunableFields))
+		for i, f := range tunableFields {
+			names[i] = f.name
+		}
+		return fmt.Errorf("%q can't be swept (one of %s)", p.Field, strings.Join(names, ", "))
+	}
+	if len(p.Values) > 0 {
+		if slices.ContainsFunc(p.Values, func(v float64) bool { return v < 0 || math.IsNaN(v) || math.IsInf(v, 0) }) {
+			return errors.New("values have to be positive numbers")
+		}
+		return nil
+	}
+	if p.Min < 0 || p.Max < p.Min || math.IsInf(p.Max, 0) {
+		return errors.New("min has to be positive and max at least min")
+	}
+	if grid && (p.Step <= 0 || (p.Max-p.Min)/p.Step+1 > maxParamValues) {
+		return fmt.Errorf("grid search needs a step that gives at most %d values", maxParamValues)
+	}
+	return nil
+}
+
+func (r TuneRequest) withDefaults() TuneRequest {
+	if r.StepMinutes == 0 {
+		r.StepMinutes = DefaultTuneStepMinutes
+	}
+	r.Request = r.Request.withDefaults()
+	if len(r.Params) == 0 {
+		r.Params = DefaultParams
+	}
+	if r.Search == "" {
+		r.Search = SearchRandom
+	}
+	if r.Samples == 0 {
+		r.Samples = DefaultSamples
+	}
+	if r.Top == 0 {
+		r.Top = DefaultTop
+	}
+	return r
+}
+
+// TuneResult one config of the sweep. Config is the whole config, ready for PUT /api/config/bz.
+type TuneResult struct {
+	Config config.BZConfig `json:"config"`
+	// Params the swept fields' values
+	Params map[string]float64 `json:"params"`
+	Report *Report            `json:"report"`
+	// RuledOut which constraint ruled it out, empty if none
+	RuledOut string `json:"ruledOut,omitempty"`
+}
+
+// Tuning what a sweep found.
+type Tuning struct {
+	// Results the best configs that met every constraint, best simulated profit per hour first
+	Results []TuneResult `json:"results"`
+	// Baseline the config the sweep started from, to compare against
+	Baseline   TuneResult `json:"baseline"`
+	Candidates int        `json:"candidates"`
+	RuledOut   int        `json:"ruledOut"`
+	// Seed of the random search, to run the same sweep again
+	Seed int64 `json:"seed,omitempty"`
+}
+
+// Tune backtests variations of `base` over the same range and returns the best ones by simulated profit per hour. Every
+// candidate shares one replay of the range.
+func Tune(ctx context.Context, src Source, base *config.BZConfig, req TuneRequest) (*Tuning, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	req = req.withDefaults()
+
+	if req.Search == SearchRandom && req.Seed == 0 {
+		req.Seed = rand.Int63()
+	}
+	candidates := sweep(base, &req)
+	m := newMarket()
+	baseline := newSimulation(base, req.Request, m)
+	sims := []*simulation{baseline}
+	for i := range candidates {
+		sims = append(sims, newSimulation(&candidates[i].Config, req.Request, m))
+	}
+	if err := replay(ctx, src, req.Request, m, sims); err != nil {
+		return nil, err
+	}
+
+	tuning := &Tuning{
+		Baseline:   TuneResult{Config: *base, Params: make(map[string]float64), Report: baseline.report()},
+		Candidates: len(candidates),
+		Seed:       req.Seed,
+	}
+	tuning.Baseline.RuledOut = req.ruleOut(tuning.Baseline.Report)
+	kept := make([]TuneResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		candidate.Report = sims[i+1].report()
+		if candidate.RuledOut = req.ruleOut(candidate.Report); candidate.RuledOut != "" {
+			tuning.RuledOut++
+			continue
+		}
+		kept = append(kept, candidate)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if kept[i].Report.ProfitPerHour != kept[j].Report.ProfitPerHour {
+			return kept[i].Report.ProfitPerHour > kept[j].Report.ProfitPerHour
+		}
+		return kept[i].Report.PnL > kept[j].Report.PnL
+	})
+	tuning.Results = kept[:min(len(kept), req.Top)]
+	return tuning, nil
+}
+
+// ruleOut the constraint a report breaks, "" if none.
+func (r *TuneRequest) ruleOut(report *Report) string {
+	switch {
+	case r.MaxFlipsPerCycle > 0 && report.MaxFlipsPerCycle > r.MaxFlipsPerCycle:
+		return "max_flips_per_cycle"
+	case report.Trades < r.MinTrades:
+		return "min_trades"
+	}
+	return ""
+}
+
+// sweep the candidate configs: every combination of the params' values (grid) or Samples random ones.
+func sweep(base *config.BZConfig, req *TuneRequest) []TuneResult {
+	if req.Search == SearchRandom {
+		rng := rand.New(rand.NewSource(req.Seed))
+		candidates := make([]TuneResult, req.Samples)
+		for i := range candidates {
+			values := make([]float64, len(req.Params))
+			for j := range req.Params {
+				values[j] = req.Params[j].sample(rng)
+			}
+			candidates[i] = candidate(base, req.Params, values)
+		}
+		return candidates
+	}
+
+	// Validate made sure there aren't too many
+	grids := make([][]float64, len(req.Params))
+	for i := range req.Params {
+		grids[i] = req.Params[i].grid()
+	}
+	candidates := make([]TuneResult, 0)
+	values := make([]float64, len(req.Params))
+	var walk func(i int)
+	walk = func(i int) {
+		if i == len(grids) {
+			candidates = append(candidates, candidate(base, req.Params, values))
+			return
+		}
+		for _, v := range grids[i] {
+			values[i] = v
+			walk(i + 1)
+		}
+	}
+	walk(0)
+	return candidates
+}
+
+// candidate base with the params set to values.
+func candidate(base *config.BZConfig, params []Param, values []float64) TuneResult {
+	result := TuneResult{Config: *base, Params: make(map[string]float64, len(params))}
+	for i, p := range params {
+		field := tunableFields[tunableField(p.Field)]
+		v := values[i]
+		if field.integer {
+			v = math.Round(v)
+		}
+		field.set(&result.Config, v)
+		result.Params[p.Field] = v
+	}
+	return result
+}
+
+// grid every value of the param.
+func (p *Param) grid() []float64 {
+	if len(p.Values) > 0 {
+		return p.Values
+	}
+	values := make([]float64, 0)
+	for i := 0; ; i++ {
+		v := p.Min + float64(i)*p.Step
+		if v > p.Max+p.Step*1e-9 { // float steps shouldn't lose the last value
+			break
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// sample one random value of the param.
+func (p *Param) sample(rng *rand.Rand) float64 {
+	if len(p.Values) > 0 {
+		return p.Values[rng.Intn(len(p.Values))]
+	}
+	return p.Min + rng.Float64()*(p.Max-p.Min)
+}
+
+// tunableField index of a field in tunableFields, -1 if it can't be swept.
+func tunableField(name string) int {
+	for i, f := range tunableFields {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
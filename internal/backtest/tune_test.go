@@ -0,0 +1,134 @@
+package backtest
+
+import (
+	"Hyflip-Server/internal/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParamGrid(t *testing.T) {
+	tests := []struct {
+		name  string
+		param Param
+		want  []float64
+	}{
+		{"integer steps include max", Param{Field: "min_profit", Min: 0, Max: 2000, Step: 1000}, []float64{0, 1000, 2000}},
+		{"float steps don't lose max", Param{Field: "max_slippage_percentage", Min: 0, Max: 0.3, Step: 0.1}, []float64{0, 0.1, 0.2, 0.30000000000000004}},
+		{"max between steps", Param{Field: "min_profit", Min: 10, Max: 25, Step: 10}, []float64{10, 20}},
+		{"single value", Param{Field: "min_profit", Min: 5, Max: 5, Step: 1}, []float64{5}},
+		{"values override the range", Param{Field: "min_profit", Values: []float64{7, 3}, Min: 0, Max: 100, Step: 1}, []float64{7, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.param.grid(); !slices.Equal(got, tt.want) {
+				t.Errorf("grid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTuneRequestValidate(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := Request{From: from, To: from.Add(time.Hour), Purse: 1_000_000, Slots: 5}
+	tests := []struct {
+		name    string
+		req     TuneRequest
+		wantErr bool
+	}{
+		{"default params fit the grid", TuneRequest{Request: base, Search: SearchGrid}, false},
+		{"exactly MaxCandidates combinations", TuneRequest{Request: base, Search: SearchGrid, Params: []Param{
+			{Field: "min_profit", Min: 0, Max: 99, Step: 1},
+			{Field: "min_buy_volume", Values: []float64{0, 10}},
+		}}, false},
+		{"one combination too many", TuneRequest{Request: base, Search: SearchGrid, Params: []Param{
+			{Field: "min_profit", Min: 0, Max: 200, Step: 1},
+		}}, true},
+		{"too many values don't matter for random search", TuneRequest{Request: base, Search: SearchRandom, Params: []Param{
+			{Field: "min_profit", Min: 0, Max: 200, Step: 1},
+		}}, false},
+		{"grid needs a step", TuneRequest{Request: base, Search: SearchGrid, Params: []Param{{Field: "min_profit", Max: 10}}}, true},
+		{"unknown field", TuneRequest{Request: base, Params: []Param{{Field: "score", Max: 10}}}, true},
+		{"field swept twice", TuneRequest{Request: base, Params: []Param{{Field: "min_profit", Max: 10}, {Field: "min_profit", Max: 20}}}, true},
+		{"0 samples is the default", TuneRequest{Request: base, Samples: 0}, false},
+		{"MaxCandidates samples", TuneRequest{Request: base, Samples: MaxCandidates}, false},
+		{"too many samples", TuneRequest{Request: base, Samples: MaxCandidates + 1}, true},
+		{"negative samples", TuneRequest{Request: base, Samples: -1}, true},
+		{"unknown search", TuneRequest{Request: base, Search: "annealing"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSweepGrid(t *testing.T) {
+	base := config.GenerateDefaultBZConfig()
+	req := (&TuneRequest{Search: SearchGrid}).withDefaults()
+	candidates := sweep(base, &req)
+	if len(candidates) != 162 {
+		t.Fatalf("sweep() over DefaultParams = %d candidates, want 162", len(candidates))
+	}
+
+	seen := make(map[[5]int]bool)
+	for _, c := range candidates {
+		key := [5]int{c.Config.MinProfit, c.Config.MinProfitPercentage, c.Config.MinVolumeDiff, c.Config.MinBuyMovingWeek, c.Config.MinSellMovingWeek}
+		if seen[key] {
+			t.Fatalf("sweep() repeated %v", key)
+		}
+		seen[key] = true
+		if c.Config.Scorer != base.Scorer || c.Config.MinBuyVolume != base.MinBuyVolume {
+			t.Fatalf("sweep() changed a field that isn't swept: %+v", c.Config)
+		}
+	}
+}
+
+func TestSweepValues(t *testing.T) {
+	base := config.GenerateDefaultBZConfig()
+	req := TuneRequest{Search: SearchGrid, Params: []Param{
+		{Field: "min_profit", Values: []float64{1.6, 300}, Min: 0, Max: 1000, Step: 1},
+		{Field: "max_slippage_percentage", Values: []float64{2.5}},
+	}}
+	candidates := sweep(base, &req)
+	if len(candidates) != 2 {
+		t.Fatalf("sweep() = %d candidates, want 2", len(candidates))
+	}
+	// integer fields are rounded, float ones kept
+	if c := candidates[0]; c.Config.MinProfit != 2 || c.Params["min_profit"] != 2 || c.Config.MaxSlippagePercentage != 2.5 {
+		t.Errorf("sweep()[0] = %+v, want min_profit 2 and max_slippage_percentage 2.5", c.Params)
+	}
+	if c := candidates[1]; c.Config.MinProfit != 300 {
+		t.Errorf("sweep()[1] min_profit = %d, want 300", c.Config.MinProfit)
+	}
+}
+
+func TestSweepRandom(t *testing.T) {
+	base := config.GenerateDefaultBZConfig()
+	req := TuneRequest{Search: SearchRandom, Samples: 20, Seed: 1, Params: []Param{
+		{Field: "min_profit", Min: 100, Max: 200},
+		{Field: "min_buy_volume", Values: []float64{3, 9}},
+	}}
+	candidates := sweep(base, &req)
+	if len(candidates) != req.Samples {
+		t.Fatalf("sweep() = %d candidates, want %d", len(candidates), req.Samples)
+	}
+	for _, c := range candidates {
+		if c.Config.MinProfit < 100 || c.Config.MinProfit > 200 {
+			t.Errorf("min_profit %d outside 100-200", c.Config.MinProfit)
+		}
+		if c.Config.MinBuyVolume != 3 && c.Config.MinBuyVolume != 9 {
+			t.Errorf("min_buy_volume %d isn't one of the values", c.Config.MinBuyVolume)
+		}
+	}
+
+	// same seed, same sweep
+	again := sweep(base, &req)
+	for i := range candidates {
+		if candidates[i].Config.MinProfit != again[i].Config.MinProfit {
+			t.Fatalf("sweep() with the same seed differs at %d", i)
+		}
+	}
+}
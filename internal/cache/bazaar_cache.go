@@ -2,169 +2,65 @@ package cache
 
 import (
 	"Hyflip-Server/internal/api"
-	"Hyflip-Server/internal/config"
 	"Hyflip-Server/internal/flippers"
-	"log"
-	"sync/atomic"
+	"context"
 	"time"
 )
 
-// subscriberList just a struct wrapper for our subscribers slice so we can compare them in CAS
-type subscriberList struct {
-	subscribers []chan flippers.BazaarFoundFlip
-}
-
 type BazaarCache struct {
-	// flipsSnapshot slice of flips updated every new flip found and reset every update. CAS'd so we don't have to lock for performance reasons
-	flipsSnapshot atomic.Value
-	// subscribers slice of subscriber channels. CAS'd so we don't have to lock for performance reasons
-	subscribers atomic.Value
-
-	api        *api.HypixelApiClient
-	expiryTime time.Duration
-	lastUpdate atomic.Int64
-	isUpdating atomic.Bool
-}
+	*FlipCache[flippers.BazaarFoundFlip]
 
-// NewBazaarCache returns a new BazaarCache. Keep only one of these per program lifecycle. It also starts the update goroutine automatically
-func NewBazaarCache(apiClient *api.HypixelApiClient, expiryTime time.Duration) *BazaarCache {
-	bzCache := &BazaarCache{
-		api:        apiClient,
-		expiryTime: expiryTime,
-	}
+	// Manipulated products the last update flagged as manipulated
+	Manipulated *ManipulationFeed
 
-	// empty collections to prevent nil panics. yes, we do not handle nils like real alphas
-	bzCache.flipsSnapshot.Store(make(map[int]flippers.BazaarFoundFlip))
-	bzCache.subscribers.Store(&subscriberList{
-		subscribers: make([]chan flippers.BazaarFoundFlip, 0),
-	})
+	api     *api.HypixelApiClient
+	flipper *flippers.BzFlipper
 
-	go bzCache.startUpdateGoroutine()
-	return bzCache
+	// ctx cancelled by Stop. every update cycle runs under it
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// Get returns a snapshot of the most recent bazaar flips. Resets every new update
-func (c *BazaarCache) Get() map[int]flippers.BazaarFoundFlip {
-	return c.flipsSnapshot.Load().(map[int]flippers.BazaarFoundFlip)
-}
-
-// Subscribe adds your channel to the subscribers list so you can receive live updates. compare-and-swap loop
-func (c *BazaarCache) Subscribe() chan flippers.BazaarFoundFlip {
-	newSubChan := make(chan flippers.BazaarFoundFlip, 100)
-	for {
-		// read our current slice
-		oldListPtr := c.subscribers.Load().(*subscriberList)
-		oldSlice := oldListPtr.subscribers
+// CacheOption changes how a BazaarCache updates. See NewBazaarCache.
+type CacheOption func(c *BazaarCache)
 
-		// make a copy, modify the copy with our new channel/subscriber
-		newSlice := make([]chan flippers.BazaarFoundFlip, len(oldSlice)+1)
-		copy(newSlice, oldSlice)
-		newSlice[len(oldSlice)] = newSubChan
-
-		// CAS the newslice. retry in case some other goroutine also does this. using struct so we can CAS as you cannot compare slices.
-		newListPtr := &subscriberList{subscribers: newSlice}
-		if c.subscribers.CompareAndSwap(oldListPtr, newListPtr) {
-			log.Println("New subscriber added. Total subscribers:", len(newSlice))
-			return newSubChan
-		}
+// WithRecorder saves every bazaar poll the cache makes (e.g. into storage.BazaarHistoryTable).
+func WithRecorder(recorder flippers.SnapshotRecorder) CacheOption {
+	return func(c *BazaarCache) {
+		c.flipper.Recorder = recorder
 	}
 }
 
-// Unsubscribe removes a subscriber's channel (if it exists).  compare-and-swap loop. for ref: we can directly look for the channels as they are reference types and point to distinct objects in memory
-func (c *BazaarCache) Unsubscribe(subChan chan flippers.BazaarFoundFlip) {
-	for {
-		oldListPtr := c.subscribers.Load().(*subscriberList)
-		oldSlice := oldListPtr.subscribers
-		foundIndex := -1
-		for i, ch := range oldSlice {
-			if ch == subChan {
-				foundIndex = i
-				break
-			}
-		}
-
-		// channel is not in the list
-		if foundIndex == -1 {
-			return
-		}
-
-		// create a new slice excluding the removed channel
-		newSlice := make([]chan flippers.BazaarFoundFlip, 0, len(oldSlice)-1)
-		newSlice = append(newSlice, oldSlice[:foundIndex]...)
-		newSlice = append(newSlice, oldSlice[foundIndex+1:]...)
-
-		// CAS the newslice. if swap fails, that means another CAS happened at the same time. so we retry (hopefully not forever). i should prob add a 'retries' mechanism lmao
-		newListPtr := &subscriberList{subscribers: newSlice}
-		if c.subscribers.CompareAndSwap(oldListPtr, newListPtr) {
-			log.Println("Subscriber removed. Total subscribers:", len(newSlice))
-			return
-		}
+// NewBazaarCache returns a new BazaarCache. Keep only one of these per program lifecycle. It also starts the update goroutine automatically
+func NewBazaarCache(apiClient *api.HypixelApiClient, expiryTime time.Duration, opts ...CacheOption) *BazaarCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	bzCache := &BazaarCache{
+		api:     apiClient,
+		flipper: &flippers.BzFlipper{Api: apiClient, Tracker: flippers.NewSnapshotTracker()},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for _, opt := range opts {
+		opt(bzCache)
 	}
-}
-
-// startUpdateGoroutine is the background goroutine to keep updating our cache. "BUT ISNT THIS AGAINST THE PHILOSOPHY OF CACHE??" I DONT CARE
-func (c *BazaarCache) startUpdateGoroutine() {
-	ticker := time.NewTicker(c.expiryTime / 4)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		if c.isExpired() {
-			if !c.isUpdating.CompareAndSwap(false, true) {
-				continue
-			}
-
-			func() {
-				defer c.isUpdating.Store(false)
-				c.lastUpdate.Store(time.Now().Unix())
-
-				// get the current list of subscribers and reset it. atomic swap makes it efficient asf, better than locking
-				newEmptyList := &subscriberList{subscribers: make([]chan flippers.BazaarFoundFlip, 0)}
-				oldList := c.subscribers.Swap(newEmptyList).(*subscriberList)
-				subscribersForThisUpdate := oldList.subscribers
-
-				chn, err := flippers.BzFlip(c.api, config.GenerateDefaultBZConfig())
-				if err != nil {
-					log.Println("Error updating bazaar cache. Err: " + err.Error())
-					// Ensure channels are closed even on failure.
-					for _, subChan := range subscribersForThisUpdate {
-						close(subChan)
-					}
-					return
-				}
-
-				newSnapshot := make(map[int]flippers.BazaarFoundFlip)
-				counter := 0
-				for foundFlip := range chn {
-					// live broadcast the updates to our subscribers
-					for _, subChan := range subscribersForThisUpdate {
-						select {
-						case subChan <- foundFlip:
-						default:
-							// subscriber channel buffer is full so we just drop it.
-						}
-					}
-
-					newSnapshot[counter] = foundFlip
-					counter++
-				}
 
-				c.flipsSnapshot.Store(newSnapshot) // we store the snapshot in case the next update is delayed (like the 1-4s delay of bzflip)
+	// keep the price history of our candidates warm so updates only do the math
+	apiClient.PriceHistory.StartRefresher(ctx, expiryTime, 10)
+	bzCache.FlipCache = newFlipCache(ctx, bzCache.flipper, expiryTime)
+	bzCache.Manipulated = newManipulationFeed(ctx, bzCache, expiryTime)
+	return bzCache
+}
 
-				// end of flips. close channels for subscribers
-				for _, subChan := range subscribersForThisUpdate {
-					close(subChan)
-				}
+// Products every bazaar product as of the latest poll (flip or not). nil until the first poll is done.
+func (c *BazaarCache) Products() map[string]flippers.Product {
+	return c.flipper.Latest()
+}
 
-			}()
-		}
-	}
+func (c *BazaarCache) flipCache() *FlipCache[flippers.BazaarFoundFlip] {
+	return c.FlipCache
 }
 
-// isExpired checks if the cache is expired based on the configured expiry time.
-func (c *BazaarCache) isExpired() bool {
-	last := c.lastUpdate.Load()
-	if last == 0 {
-		return true // Never updated, so it's expired.
-	}
-	return time.Since(time.Unix(last, 0)) >= c.expiryTime
+// Stop cancels the running update (if any) and stops updating. Subscribers of the current update get their channels closed.
+func (c *BazaarCache) Stop() {
+	c.cancel()
 }
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// subscriberList just a struct wrapper for our subscribers slice so we can compare them in CAS
+type subscriberList[T any] struct {
+	subscribers []chan T
+}
+
+// Producer runs one update cycle: everything it sends is broadcast live, and becomes the new snapshot once the channel closes.
+type Producer[T any] func(ctx context.Context) (<-chan T, error)
+
+// Broadcaster keeps the latest snapshot of something that's recomputed periodically (flips) and streams every update cycle live
+// to its subscribers. Subscribers only get one cycle: their channel is closed at the end of it.
+type Broadcaster[T any] struct {
+	// name for logs
+	name string
+	// snapshot slice of items updated every new item found and reset every update. CAS'd so we don't have to lock for performance reasons
+	snapshot atomic.Value
+	// subscribers slice of subscriber channels. CAS'd so we don't have to lock for performance reasons
+	subscribers atomic.Value
+
+	expiryTime time.Duration
+	lastUpdate atomic.Int64
+	isUpdating atomic.Bool
+}
+
+// NewBroadcaster with an empty snapshot. Nothing happens until Run.
+func NewBroadcaster[T any](name string, expiryTime time.Duration) *Broadcaster[T] {
+	b := &Broadcaster[T]{name: name, expiryTime: expiryTime}
+	// empty collections to prevent nil panics. yes, we do not handle nils like real alphas
+	b.snapshot.Store(make(map[int]T))
+	b.subscribers.Store(&subscriberList[T]{subscribers: make([]chan T, 0)})
+	return b
+}
+
+// Get returns a snapshot of the most recent items. Resets every new update
+func (b *Broadcaster[T]) Get() map[int]T {
+	return b.snapshot.Load().(map[int]T)
+}
+
+// Subscribe adds your channel to the subscribers list so you can receive live updates. compare-and-swap loop
+func (b *Broadcaster[T]) Subscribe() chan T {
+	newSubChan := make(chan T, 100)
+	for {
+		// read our current slice
+		oldListPtr := b.subscribers.Load().(*subscriberList[T])
+		oldSlice := oldListPtr.subscribers
+
+		// make a copy, modify the copy with our new channel/subscriber
+		newSlice := make([]chan T, len(oldSlice)+1)
+		copy(newSlice, oldSlice)
+		newSlice[len(oldSlice)] = newSubChan
+
+		// CAS the newslice. retry in case some other goroutine also does this. using struct so we can CAS as you cannot compare slices.
+		newListPtr := &subscriberList[T]{subscribers: newSlice}
+		if b.subscribers.CompareAndSwap(oldListPtr, newListPtr) {
+			log.Println("New "+b.name+" subscriber added. Total subscribers:", len(newSlice))
+			return newSubChan
+		}
+	}
+}
+
+// Unsubscribe removes a subscriber's channel (if it exists).  compare-and-swap loop. for ref: we can directly look for the channels as they are reference types and point to distinct objects in memory
+func (b *Broadcaster[T]) Unsubscribe(subChan chan T) {
+	for {
+		oldListPtr := b.subscribers.Load().(*subscriberList[T])
+		oldSlice := oldListPtr.subscribers
+		foundIndex := -1
+		for i, ch := range oldSlice {
+			if ch == subChan {
+				foundIndex = i
+				break
+			}
+		}
+
+		// channel is not in the list
+		if foundIndex == -1 {
+			return
+		}
+
+		// create a new slice excluding the removed channel
+		newSlice := make([]chan T, 0, len(oldSlice)-1)
+		newSlice = append(newSlice, oldSlice[:foundIndex]...)
+		newSlice = append(newSlice, oldSlice[foundIndex+1:]...)
+
+		// CAS the newslice. if swap fails, that means another CAS happened at the same time. so we retry (hopefully not forever). i should prob add a 'retries' mechanism lmao
+		newListPtr := &subscriberList[T]{subscribers: newSlice}
+		if b.subscribers.CompareAndSwap(oldListPtr, newListPtr) {
+			log.Println(b.name+" subscriber removed. Total subscribers:", len(newSlice))
+			return
+		}
+	}
+}
+
+// Run keeps running update cycles every expiryTime until ctx is done. Blocks, so run it in its own goroutine. "BUT ISNT THIS AGAINST THE PHILOSOPHY OF CACHE??" I DONT CARE
+func (b *Broadcaster[T]) Run(ctx context.Context, produce Producer[T]) {
+	ticker := time.NewTicker(b.expiryTime / 4)
+	defer ticker.Stop()
+
+	for {
+		if b.isExpired() && b.isUpdating.CompareAndSwap(false, true) {
+			b.cycle(ctx, produce)
+			b.isUpdating.Store(false)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cycle is one update: fresh subscriber list, broadcast everything produced, swap the snapshot in.
+func (b *Broadcaster[T]) cycle(parent context.Context, produce Producer[T]) {
+	b.lastUpdate.Store(time.Now().Unix())
+
+	// get the current list of subscribers and reset it. atomic swap makes it efficient asf, better than locking
+	newEmptyList := &subscriberList[T]{subscribers: make([]chan T, 0)}
+	oldList := b.subscribers.Swap(newEmptyList).(*subscriberList[T])
+	subscribersForThisUpdate := oldList.subscribers
+	// end of items (or failure). close channels for subscribers
+	defer func() {
+		for _, subChan := range subscribersForThisUpdate {
+			close(subChan)
+		}
+	}()
+
+	// a cycle that takes longer than expiryTime is already stale, so it gets abandoned and the old snapshot stays
+	ctx, cancel := context.WithTimeout(parent, b.expiryTime)
+	defer cancel()
+
+	chn, err := produce(ctx)
+	if err != nil {
+		log.Println("Error updating " + b.name + " cache. Err: " + err.Error())
+		return
+	}
+
+	newSnapshot := make(map[int]T)
+	counter := 0
+	for item := range chn {
+		// live broadcast the updates to our subscribers
+		for _, subChan := range subscribersForThisUpdate {
+			select {
+			case subChan <- item:
+			default:
+				// subscriber channel buffer is full so we just drop it.
+			}
+		}
+
+		newSnapshot[counter] = item
+		counter++
+	}
+
+	if ctx.Err() != nil {
+		log.Println(b.name + " cache update abandoned (" + ctx.Err().Error() + "). Keeping the previous snapshot.")
+		return
+	}
+	b.snapshot.Store(newSnapshot) // we store the snapshot in case the next update is delayed (like the 1-4s delay of bzflip)
+}
+
+// isExpired checks if the cache is expired based on the configured expiry time.
+func (b *Broadcaster[T]) isExpired() bool {
+	last := b.lastUpdate.Load()
+	if last == 0 {
+		return true // Never updated, so it's expired.
+	}
+	return time.Since(time.Unix(last, 0)) >= b.expiryTime
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"context"
+	"time"
+)
+
+// FlipCache runs a Flipper every expiryTime and broadcasts its flips. Everything that's the same for every flip type lives
+// here, so a new flip type is just a Flipper.
+type FlipCache[T any] struct {
+	*Broadcaster[T]
+
+	name   string
+	keep   func(flip *T, conf *config.UserConfig) bool
+	ranker func(conf *config.UserConfig) func(flip *T) float64
+
+	cancel context.CancelFunc
+}
+
+// NewFlipCache starts updating right away.
+func NewFlipCache[T any, C any](f flippers.Flipper[T, C], expiryTime time.Duration) *FlipCache[T] {
+	return newFlipCache(context.Background(), f, expiryTime)
+}
+
+// newFlipCache is NewFlipCache under a parent ctx, for caches that run more than the flipper (BazaarCache).
+func newFlipCache[T any, C any](parent context.Context, f flippers.Flipper[T, C], expiryTime time.Duration) *FlipCache[T] {
+	ctx, cancel := context.WithCancel(parent)
+	c := &FlipCache[T]{
+		Broadcaster: NewBroadcaster[T](f.Name(), expiryTime),
+		name:        f.Name(),
+		keep: func(flip *T, conf *config.UserConfig) bool {
+			return f.Filter(flip, f.UserConfig(conf))
+		},
+		cancel: cancel,
+	}
+	if r, ok := f.(flippers.Ranker[T, C]); ok {
+		c.ranker = func(conf *config.UserConfig) func(flip *T) float64 {
+			return r.Ranker(f.UserConfig(conf))
+		}
+	}
+
+	go c.Run(ctx, func(ctx context.Context) (<-chan T, error) {
+		return f.Flip(ctx, f.DefaultConfig())
+	})
+	return c
+}
+
+// Name of the flipper.
+func (c *FlipCache[T]) Name() string {
+	return c.name
+}
+
+// Keep whether a flip passes a user's config (see Flipper.Filter).
+func (c *FlipCache[T]) Keep(flip *T, conf *config.UserConfig) bool {
+	return c.keep(flip, conf)
+}
+
+// Stream sends a user their flips: the snapshot (best first if the flipper ranks them), then the live ones of the current
+// update until it's done or ctx is.
+func (c *FlipCache[T]) Stream(ctx context.Context, conf *config.UserConfig, send func(flip any)) error {
+	var score func(flip *T) float64
+	if c.ranker != nil {
+		score = c.ranker(conf)
+	}
+	return Stream(ctx, c.Broadcaster, func(flip *T) bool {
+		return c.keep(flip, conf)
+	}, score, func(flip *T) {
+		send(flip)
+	})
+}
+
+// Stop stops updating.
+func (c *FlipCache[T]) Stop() {
+	c.cancel()
+}
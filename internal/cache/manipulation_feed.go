@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/manipulation"
+	"context"
+	"time"
+)
+
+// FlaggedProduct a bazaar product the default manipulation thresholds currently flag.
+type FlaggedProduct struct {
+	ProductID string  `json:"productId"`
+	SellPrice float64 `json:"sellPrice"`
+	BuyPrice  float64 `json:"buyPrice"`
+	// SwingPercentage, SellVolumeRatio, BuyVolumeRatio see manipulation.Measurements
+	SwingPercentage float64 `json:"swingPercentage"`
+	SellVolumeRatio float64 `json:"sellVolumeRatio"`
+	BuyVolumeRatio  float64 `json:"buyVolumeRatio"`
+	// WindowHours and HistoryPoints the price history the verdict was made on
+	WindowHours   float64                   `json:"windowHours"`
+	HistoryPoints int                       `json:"historyPoints"`
+	Measurements  manipulation.Measurements `json:"measurements"`
+	Reasons       []manipulation.Reason     `json:"reasons"`
+	// FirstFlagged when it got flagged, since it's been flagged without a break. LastFlagged the latest cycle that flagged it
+	FirstFlagged time.Time `json:"firstFlagged"`
+	LastFlagged  time.Time `json:"lastFlagged"`
+}
+
+// ManipulationFeed every product the bazaar cache's last cycle flagged as manipulated. It's a Broadcaster like the flip
+// caches, so it has a snapshot (currently flagged) and a live stream of every refresh.
+type ManipulationFeed struct {
+	*Broadcaster[FlaggedProduct]
+
+	// firstFlagged product id -> since when. only touched by the update cycle
+	firstFlagged map[string]time.Time
+}
+
+func newManipulationFeed(ctx context.Context, bzCache *BazaarCache, expiryTime time.Duration) *ManipulationFeed {
+	feed := &ManipulationFeed{
+		Broadcaster:  NewBroadcaster[FlaggedProduct]("manipulation", expiryTime),
+		firstFlagged: make(map[string]time.Time),
+	}
+	go feed.Run(ctx, func(ctx context.Context) (<-chan FlaggedProduct, error) {
+		return feed.refresh(bzCache.flipper.Rejections()), nil
+	})
+	return feed
+}
+
+// refresh turns the latest rejections into flagged products. Products that aren't rejected anymore lose their first flagged
+// time, so flagging them again starts over.
+func (f *ManipulationFeed) refresh(rejections []flippers.Rejection) <-chan FlaggedProduct {
+	flagged := make(chan FlaggedProduct, len(rejections))
+	defer close(flagged)
+
+	stillFlagged := make(map[string]time.Time, len(rejections))
+	for _, r := range rejections {
+		first, ok := f.firstFlagged[r.ProductID]
+		if !ok {
+			first = r.At
+		}
+		stillFlagged[r.ProductID] = first
+
+		m := r.Measurements
+		flagged <- FlaggedProduct{
+			ProductID:       r.ProductID,
+			SellPrice:       r.SellPrice,
+			BuyPrice:        r.BuyPrice,
+			SwingPercentage: m.SwingPercentage,
+			SellVolumeRatio: m.SellVolumeRatio,
+			BuyVolumeRatio:  m.BuyVolumeRatio,
+			WindowHours:     m.WindowHours,
+			HistoryPoints:   m.HistoryPoints,
+			Measurements:    m,
+			Reasons:         r.Verdict.Reasons,
+			FirstFlagged:    first,
+			LastFlagged:     r.At,
+		}
+	}
+	f.firstFlagged = stillFlagged
+	return flagged
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"Hyflip-Server/internal/config"
+	"context"
+	"log"
+	"sync"
+)
+
+// Streamer is a FlipCache without its flip type, so caches of every type can sit in one Registry.
+type Streamer interface {
+	Name() string
+	Stream(ctx context.Context, conf *config.UserConfig, send func(flip any)) error
+	Stop()
+}
+
+// Registry every flip cache the server runs. Each one gets its /api/<name>flips route.
+type Registry struct {
+	mu        sync.RWMutex
+	streamers []Streamer
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add a cache. Names have to be unique, a duplicate replaces (and stops) the old one.
+func (r *Registry) Add(s Streamer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.streamers {
+		if existing.Name() == s.Name() {
+			log.Println("Replacing flip cache " + s.Name() + ".")
+			existing.Stop()
+			r.streamers[i] = s
+			return
+		}
+	}
+	r.streamers = append(r.streamers, s)
+}
+
+// All registered caches, in the order they were added. nil-safe so tools without caches can pass a nil Registry.
+func (r *Registry) All() []Streamer {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Streamer(nil), r.streamers...)
+}
+
+// Get a cache by name. nil if there's none.
+func (r *Registry) Get(name string) Streamer {
+	for _, s := range r.All() {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Lookup a cache by name with its flip type, for handlers that need the flips themselves. nil if there's none (or it's
+// not a cache of T).
+func Lookup[T any](r *Registry, name string) *FlipCache[T] {
+	switch s := r.Get(name).(type) {
+	case *FlipCache[T]:
+		return s
+	case interface{ flipCache() *FlipCache[T] }:
+		return s.flipCache()
+	}
+	return nil
+}
+
+// StopAll stops every cache.
+func (r *Registry) StopAll() {
+	for _, s := range r.All() {
+		s.Stop()
+	}
+}
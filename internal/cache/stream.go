@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// Stream sends the snapshot of a broadcaster and then every live item of the current update, until the update is done or ctx
+// is. `keep` is the user's filter. `score` (optional) scores an item, storing the score on it: the snapshot is sent best
+// first, live items go out as they come.
+func Stream[T any](ctx context.Context, b *Broadcaster[T], keep func(*T) bool, score func(*T) float64, send func(*T)) error {
+	start := time.Now()
+	// previous flips in the update in case we joined mid-update
+	snapshot := b.Get()
+	// subscribe to get live updates now that we've joined the update stream
+	liveUpdatesChan := b.Subscribe()
+	defer func() {
+		b.Unsubscribe(liveUpdatesChan)
+		log.Println("SSE client disconnected. Unsubscribed from live updates.")
+	}()
+
+	// send the previous flips first
+	kept := make([]T, 0, len(snapshot))
+	for _, flip := range snapshot {
+		if keep(&flip) { // check for user config filter too
+			kept = append(kept, flip)
+		}
+	}
+	if score != nil {
+		scores := make([]float64, len(kept))
+		for i := range kept {
+			scores[i] = score(&kept[i])
+		}
+		sort.Sort(byScore[T]{items: kept, scores: scores})
+	}
+	for i := range kept {
+		send(&kept[i])
+	}
+
+	log.Printf("Sent %d flips in initial snapshot.", len(snapshot))
+
+	// waits for: either cache manager to say "updates done" by closing channel, client to disconnect or for a new flip to arrive via the channel we get when we subscribe
+	for {
+		select {
+		// client connection closed
+		case <-ctx.Done():
+			log.Println("Took " + time.Since(start).String() + " to complete flipping request.")
+			return nil
+
+		// new flip OR channel closed
+		case flip, ok := <-liveUpdatesChan:
+			// channel closed
+			if !ok {
+				log.Println("Took " + time.Since(start).String() + " to complete flipping request.")
+				return nil
+			}
+
+			// new flip
+			if keep(&flip) { // check for user config filter too
+				if score != nil {
+					score(&flip)
+				}
+				send(&flip)
+			}
+		}
+	}
+}
+
+// byScore sorts flips and their scores together, best first
+type byScore[T any] struct {
+	items  []T
+	scores []float64
+}
+
+func (s byScore[T]) Len() int           { return len(s.items) }
+func (s byScore[T]) Less(i, j int) bool { return s.scores[i] > s.scores[j] }
+func (s byScore[T]) Swap(i, j int) {
+	s.items[i], s.items[j] = s.items[j], s.items[i]
+	s.scores[i], s.scores[j] = s.scores[j], s.scores[i]
+}
@@ -6,8 +6,12 @@ import (
 )
 
 type UserConfig struct {
-	AhConfig AHConfig
-	BzConfig BZConfig
+	AhConfig     AHConfig
+	BzConfig     BZConfig
+	CraftConfig  CraftConfig
+	NpcConfig    NPCConfig
+	ForgeConfig  ForgeConfig
+	MinionConfig MinionConfig
 }
 
 type AHConfig struct {
@@ -15,23 +19,121 @@ type AHConfig struct {
 	MinProfit           int      `json:"min_profit"`
 	MinProfitPercentage int      `json:"min_profit_percentage"`
 	ExcludeItems        []string `json:"exclude_items"`
-	IncludeCraftCost    bool     `json:"include_craft_cost"`
 	MinVolume           int      `json:"min_volume"`
 	MaxVolume           int      `json:"max_volume"`
 }
 
 type BZConfig struct {
-	ConfigVersion       string   `json:"config_version"`
+	ConfigVersion       string `json:"config_version"`
+	MinProfit           int    `json:"min_profit"`
+	MinProfitPercentage int    `json:"min_profit_percentage"`
+	// ExcludeItems/IncludeItems patterns, see flippers.ItemRules for the syntax
+	ExcludeItems []string `json:"exclude_items"`
+	IncludeItems []string `json:"include_items"`
+	// AllowlistOnly only products matching IncludeItems are flipped
+	AllowlistOnly     bool `json:"allowlist_only"`
+	MinVolumeDiff     int  `json:"min_volume_diff"`
+	MinBuyVolume      int  `json:"min_buy_volume"`
+	MinSellMovingWeek int  `json:"sell_moving_week"`
+	MinBuyMovingWeek  int  `json:"buy_moving_week"`
+	MinInstaBuys      int  `json:"min_insta_buys"`
+	MaxInstaSells     int  `json:"min_insta_sells"`
+	// MaxSlippagePercentage flips whose order book fills are this much worse than the top of the book are dropped. 0 = no limit
+	MaxSlippagePercentage float64 `json:"max_slippage_percentage"`
+	// MaxCompetitionScore flips on products with a competition score (0-100, how often the top order gets outbid) above this are dropped. 0 = no limit
+	MaxCompetitionScore float64 `json:"max_competition_score"`
+	// FilterExpression extra condition over the flip's json fields, e.g. `profit > 2000 && !(productId ~ "ENCHANTED_*")`. See internal/expr.
+	// Every field but score, flips are only scored after they passed the filter
+	FilterExpression string `json:"filter_expression"`
+	// Scorer how flips are ranked: profit, profit_percentage, profit_per_hour, volatility_adjusted or blend
+	Scorer string `json:"scorer"`
+	// ScorerWeights for the blend scorer, weight by scorer name
+	ScorerWeights map[string]float64 `json:"scorer_weights"`
+	// Manipulation when a product counts as manipulated, see internal/manipulation
+	Manipulation ManipulationThresholds `json:"manipulation"`
+}
+
+// ManipulationThresholds per-user thresholds of the manipulation detectors. 0 = the detector's default.
+type ManipulationThresholds struct {
+	// Disabled detector names that don't apply: swing, zscore, volume_spike, spoofing
+	Disabled           []string `json:"disabled"`
+	MaxSwingPercentage float64  `json:"max_swing_percentage"`
+	// MaxZScore how many standard deviations from its history the current price may be
+	MaxZScore float64 `json:"max_z_score"`
+	// MaxVolumeSpike how many times the normal volume may sit in the books
+	MaxVolumeSpike float64 `json:"max_volume_spike"`
+	// MaxSingleOrderShare how much of the top of a book one order may be (0-1)...
+	MaxSingleOrderShare float64 `json:"max_single_order_share"`
+	// MinSpoofDays ...when that order is at least this many days of trading
+	MinSpoofDays float64 `json:"min_spoof_days"`
+}
+
+type CraftConfig struct {
+	ConfigVersion       string `json:"config_version"`
+	MinProfit           int    `json:"min_profit"`
+	MinProfitPercentage int    `json:"min_profit_percentage"`
+	// MinAuctionProfitPercentage margin needed when the craft is sold on the AH instead. BINs move more than the bazaar
+	MinAuctionProfitPercentage int `json:"min_auction_profit_percentage"`
+	// ExcludeItems patterns like BZConfig.ExcludeItems, matched against the crafted item
+	ExcludeItems []string `json:"exclude_items"`
+	// IncludeAuction also craft things that only sell on the AH (priced at their lowest BIN)
+	IncludeAuction bool `json:"include_auction"`
+	// BuyOrderIngredients price ingredients at buy order prices (cheaper, slower) instead of insta-buying them
+	BuyOrderIngredients bool `json:"buy_order_ingredients"`
+	// MinOutputMovingWeek bazaar crafts need at least this many insta-buys a week so they actually sell
+	MinOutputMovingWeek int `json:"min_output_moving_week"`
+}
+
+type ForgeConfig struct {
+	ConfigVersion string `json:"config_version"`
+	// QuickForgeLevel heart of the mountain perk, 0-20. makes everything forge faster
+	QuickForgeLevel     int      `json:"quick_forge_level"`
 	MinProfit           int      `json:"min_profit"`
-	MinProfitPercentage int      `json:"min_profit_percentage"`
+	MinProfitPerHour    int      `json:"min_profit_per_hour"`
 	ExcludeItems        []string `json:"exclude_items"`
-	IncludeCraftCost    bool     `json:"include_craft_cost"`
-	MinVolumeDiff       int      `json:"min_volume_diff"`
-	MinBuyVolume        int      `json:"min_buy_volume"`
-	MinSellMovingWeek   int      `json:"sell_moving_week"`
-	MinBuyMovingWeek    int      `json:"buy_moving_week"`
-	MinInstaBuys        int      `json:"min_insta_buys"`
-	MaxInstaSells       int      `json:"min_insta_sells"`
+	IncludeAuction      bool     `json:"include_auction"`
+	BuyOrderIngredients bool     `json:"buy_order_ingredients"`
+	MinOutputMovingWeek int      `json:"min_output_moving_week"`
+}
+
+type MinionConfig struct {
+	ConfigVersion string `json:"config_version"`
+	// Tier 0 = each minion's highest tier
+	Tier int `json:"tier"`
+	// Fuel, Upgrades, Storage item ids from the minion definitions. empty = none
+	Fuel     string   `json:"fuel"`
+	Upgrades []string `json:"upgrades"`
+	Storage  string   `json:"storage"`
+	// CollectEveryHours how often the user empties their minions. 0 = never fills up (hopper, or just assume it)
+	CollectEveryHours float64 `json:"collect_every_hours"`
+	// SellMode sell_offer, insta_sell, npc or best
+	SellMode     string   `json:"sell_mode"`
+	ExcludeItems []string `json:"exclude_items"`
+}
+
+type NPCConfig struct {
+	ConfigVersion       string  `json:"config_version"`
+	MinProfitPerItem    float64 `json:"min_profit_per_item"`
+	MinProfitPercentage int     `json:"min_profit_percentage"`
+	// MinDailyProfit what the flip makes per day, with the daily cap and the bazaar supply taken into account
+	MinDailyProfit int      `json:"min_daily_profit"`
+	ExcludeItems   []string `json:"exclude_items"`
+	// BuyOrders buy with buy orders (cheaper, slower) instead of insta-buying
+	BuyOrders bool `json:"buy_orders"`
+	// DailySellCap coins a profile can make selling to NPCs per day
+	DailySellCap int64 `json:"daily_sell_cap"`
+}
+
+// GenerateDefaultUserConfig every flipper's default config.
+func GenerateDefaultUserConfig() *UserConfig {
+	return &UserConfig{
+		AhConfig:     *GenerateDefaultAHConfig(),
+		BzConfig:     *GenerateDefaultBZConfig(),
+		CraftConfig:  *GenerateDefaultCraftConfig(),
+		NpcConfig:    *GenerateDefaultNPCConfig(),
+		ForgeConfig:  *GenerateDefaultForgeConfig(),
+		MinionConfig: *GenerateDefaultMinionConfig(),
+	}
 }
 
 func GenerateDefaultAHConfig() *AHConfig {
@@ -40,7 +142,6 @@ func GenerateDefaultAHConfig() *AHConfig {
 		MinProfit:           1000000,
 		MinProfitPercentage: 20,
 		ExcludeItems:        nil,
-		IncludeCraftCost:    false,
 		MinVolume:           20,
 		MaxVolume:           20,
 	}
@@ -48,15 +149,73 @@ func GenerateDefaultAHConfig() *AHConfig {
 
 func GenerateDefaultBZConfig() *BZConfig {
 	return &BZConfig{ // very lenient as this is also used for caching so we need as many flips as possible
+		ConfigVersion:         "1.0.0",
+		MinProfit:             50,
+		MinProfitPercentage:   10,
+		ExcludeItems:          nil,
+		IncludeItems:          nil,
+		AllowlistOnly:         false,
+		MinBuyVolume:          5,
+		MinVolumeDiff:         10,
+		MinSellMovingWeek:     30,
+		MinBuyMovingWeek:      30,
+		MaxSlippagePercentage: 0, // no limit, thin books still show up with their slippage
+		MaxCompetitionScore:   0, // same, users decide how much of an order war they're up for
+		FilterExpression:      "",
+		Scorer:                "profit",
+		ScorerWeights:         nil,
+		Manipulation:          ManipulationThresholds{}, // detector defaults
+	}
+}
+
+func GenerateDefaultCraftConfig() *CraftConfig {
+	return &CraftConfig{ // lenient for the same reason as the BZ one
+		ConfigVersion:              "1.0.0",
+		MinProfit:                  1000,
+		MinProfitPercentage:        5,
+		MinAuctionProfitPercentage: 10,
+		ExcludeItems:               nil,
+		IncludeAuction:             true,
+		BuyOrderIngredients:        false,
+		MinOutputMovingWeek:        100,
+	}
+}
+
+func GenerateDefaultForgeConfig() *ForgeConfig {
+	return &ForgeConfig{
+		ConfigVersion:       "1.0.0",
+		QuickForgeLevel:     0,
+		MinProfit:           1000,
+		MinProfitPerHour:    100,
+		ExcludeItems:        nil,
+		IncludeAuction:      true,
+		BuyOrderIngredients: false,
+		MinOutputMovingWeek: 10,
+	}
+}
+
+func GenerateDefaultMinionConfig() *MinionConfig {
+	return &MinionConfig{
+		ConfigVersion:     "1.0.0",
+		Tier:              0,
+		Fuel:              "",
+		Upgrades:          nil,
+		Storage:           "",
+		CollectEveryHours: 0,
+		SellMode:          "best",
+		ExcludeItems:      nil,
+	}
+}
+
+func GenerateDefaultNPCConfig() *NPCConfig {
+	return &NPCConfig{ // lenient, same as the others
 		ConfigVersion:       "1.0.0",
-		MinProfit:           50,
-		MinProfitPercentage: 10,
+		MinProfitPerItem:    0.1,
+		MinProfitPercentage: 1,
+		MinDailyProfit:      10000,
 		ExcludeItems:        nil,
-		IncludeCraftCost:    false, // TODO
-		MinBuyVolume:        5,
-		MinVolumeDiff:       10,
-		MinSellMovingWeek:   30,
-		MinBuyMovingWeek:    30,
+		BuyOrders:           false,
+		DailySellCap:        200_000_000,
 	}
 }
 
@@ -89,3 +248,63 @@ func (b *BZConfig) Scan(src interface{}) error {
 
 	return json.Unmarshal(data, b)
 }
+
+func (c *CraftConfig) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("CraftConfig: expected []byte or string, got %T", src)
+	}
+
+	return json.Unmarshal(data, c)
+}
+
+func (n *NPCConfig) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("NPCConfig: expected []byte or string, got %T", src)
+	}
+
+	return json.Unmarshal(data, n)
+}
+
+func (f *ForgeConfig) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("ForgeConfig: expected []byte or string, got %T", src)
+	}
+
+	return json.Unmarshal(data, f)
+}
+
+func (m *MinionConfig) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("MinionConfig: expected []byte or string, got %T", src)
+	}
+
+	return json.Unmarshal(data, m)
+}
@@ -1,10 +1,43 @@
 package env
 
-import "github.com/joho/godotenv"
+import (
+	"github.com/joho/godotenv"
+	"os"
+	"strings"
+)
 
 // INTERNAL_HYPIXEL_API_KEY - anything for the autocomplete huh
 const INTERNAL_HYPIXEL_API_KEY = "INTERNAL_HYPIXEL_API_KEY"
 
+// INTERNAL_HYPIXEL_API_KEYS - more internal keys, comma separated. Used together with INTERNAL_HYPIXEL_API_KEY.
+const INTERNAL_HYPIXEL_API_KEYS = "INTERNAL_HYPIXEL_API_KEYS"
+
+// Upstream overrides. Leave empty to use the real APIs.
+const (
+	HYPIXEL_API_URL    = "HYPIXEL_API_URL"
+	SKYBLOCK_API_URL   = "SKYBLOCK_API_URL"
+	MOJANG_UUID_URL    = "MOJANG_UUID_URL"
+	MOJANG_BULK_URL    = "MOJANG_BULK_URL"
+	MOJANG_PROFILE_URL = "MOJANG_PROFILE_URL"
+	PRICE_TRACKER_URL  = "PRICE_TRACKER_URL"
+	LOWEST_BIN_URL     = "LOWEST_BIN_URL"
+)
+
+// TRANSPORT_MODE is either empty (live), "record" (live + save every response as a fixture) or "replay" (only serve fixtures).
+const TRANSPORT_MODE = "TRANSPORT_MODE"
+
+// FIXTURES_DIR is where record/replay fixtures live.
+const FIXTURES_DIR = "FIXTURES_DIR"
+
+// NEU_REPO_DIR is a checkout of the NEU repo, for recipes. Defaults to recipes.DefaultRepoDir.
+const NEU_REPO_DIR = "NEU_REPO_DIR"
+
+// FORGE_RECIPES_FILE the forge recipes. Defaults to recipes.DefaultForgeFile.
+const FORGE_RECIPES_FILE = "FORGE_RECIPES_FILE"
+
+// MINIONS_FILE the minion definitions. Defaults to minions.DefaultDefinitionsFile.
+const MINIONS_FILE = "MINIONS_FILE"
+
 // InitEnv - Load the .env... what else?
 func InitEnv() {
 	env := godotenv.Load()
@@ -12,3 +45,17 @@ func InitEnv() {
 		panic(".env file not found")
 	}
 }
+
+// HypixelApiKeys every internal API key found in the env.
+func HypixelApiKeys() []string {
+	var keys []string
+	if key := strings.TrimSpace(os.Getenv(INTERNAL_HYPIXEL_API_KEY)); key != "" {
+		keys = append(keys, key)
+	}
+	for _, key := range strings.Split(os.Getenv(INTERNAL_HYPIXEL_API_KEYS), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
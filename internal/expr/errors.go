@@ -0,0 +1,32 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a compile or runtime error in an expression. Pos is the byte offset in the source it points at.
+type Error struct {
+	Pos    int
+	Msg    string
+	Source string
+}
+
+func errorAt(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Pointer is the source with a caret under the position of the error, for showing to whoever wrote the expression:
+//
+//	profit > 2000 && proft < 5
+//	                 ^
+func (e *Error) Pointer() string {
+	if e.Source == "" {
+		return ""
+	}
+	return e.Source + "\n" + strings.Repeat(" ", e.Pos) + "^"
+}
@@ -0,0 +1,179 @@
+package expr
+
+import (
+	"math"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// MaxSteps nodes one evaluation may visit. the node limit already bounds this, it's here so nothing added later can loop forever
+const MaxSteps = 4 * MaxNodes
+
+// maxGlobLength patterns longer than this don't match anything. globs can come from fields, not just literals
+const maxGlobLength = 256
+
+// Program is a compiled, type checked boolean expression over the fields of a T.
+type Program[T any] struct {
+	source string
+	root   *node
+}
+
+// Compile parses and type checks `src` against the json fields of T. The expression has to be a condition (bool).
+func Compile[T any](src string) (*Program[T], error) {
+	root, err := parse(src, schemaOf(reflect.TypeFor[T]()))
+	if err == nil && root.typ != TypeBool {
+		err = errorAt(root.pos, "expression has to be a condition (true/false), this is a %s", root.typ)
+	}
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.Source = src
+		}
+		return nil, err
+	}
+	return &Program[T]{source: src, root: root}, nil
+}
+
+// Source the expression as it was written.
+func (p *Program[T]) Source() string {
+	return p.source
+}
+
+type value struct {
+	num float64
+	str string
+	b   bool
+}
+
+type evaluation struct {
+	target reflect.Value
+	steps  int
+}
+
+// Eval runs the expression against v. Errors (dividing by zero, too many steps) mean it couldn't be decided, not false.
+func (p *Program[T]) Eval(v *T) (bool, error) {
+	ev := &evaluation{target: reflect.ValueOf(v).Elem()}
+	result, err := ev.eval(p.root)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.Source = p.source
+		}
+		return false, err
+	}
+	return result.b, nil
+}
+
+func (ev *evaluation) eval(n *node) (value, error) {
+	ev.steps++
+	if ev.steps > MaxSteps {
+		return value{}, errorAt(n.pos, "evaluation took more than %d steps", MaxSteps)
+	}
+
+	switch n.kind {
+	case nodeNumber:
+		return value{num: n.num}, nil
+	case nodeString:
+		return value{str: n.str}, nil
+	case nodeBool:
+		return value{b: n.b}, nil
+	case nodeField:
+		return ev.field(n.field), nil
+	case nodeUnary:
+		operand, err := ev.eval(n.left)
+		if err != nil {
+			return value{}, err
+		}
+		if n.op == "!" {
+			return value{b: !operand.b}, nil
+		}
+		return value{num: -operand.num}, nil
+	}
+
+	left, err := ev.eval(n.left)
+	if err != nil {
+		return value{}, err
+	}
+	// short circuit, so `sellVolume > 0 && buyVolume / sellVolume > 2` is safe
+	switch {
+	case n.op == "&&" && !left.b:
+		return value{b: false}, nil
+	case n.op == "||" && left.b:
+		return value{b: true}, nil
+	}
+	right, err := ev.eval(n.right)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return value{b: right.b}, nil
+	case "==":
+		return value{b: equal(n.left.typ, left, right)}, nil
+	case "!=":
+		return value{b: !equal(n.left.typ, left, right)}, nil
+	case "~":
+		return value{b: glob(right.str, left.str)}, nil
+	case "<":
+		return value{b: left.num < right.num}, nil
+	case "<=":
+		return value{b: left.num <= right.num}, nil
+	case ">":
+		return value{b: left.num > right.num}, nil
+	case ">=":
+		return value{b: left.num >= right.num}, nil
+	case "+":
+		return value{num: left.num + right.num}, nil
+	case "-":
+		return value{num: left.num - right.num}, nil
+	case "*":
+		return value{num: left.num * right.num}, nil
+	case "/":
+		if right.num == 0 {
+			return value{}, errorAt(n.pos, "division by zero")
+		}
+		return value{num: left.num / right.num}, nil
+	case "%":
+		if right.num == 0 {
+			return value{}, errorAt(n.pos, "division by zero")
+		}
+		return value{num: math.Mod(left.num, right.num)}, nil
+	}
+	return value{}, errorAt(n.pos, "unknown operator %s", n.op)
+}
+
+func (ev *evaluation) field(f field) value {
+	v := ev.target.FieldByIndex(f.index)
+	switch f.typ {
+	case TypeString:
+		return value{str: v.String()}
+	case TypeBool:
+		return value{b: v.Bool()}
+	}
+	switch {
+	case v.CanInt():
+		return value{num: float64(v.Int())}
+	case v.CanUint():
+		return value{num: float64(v.Uint())}
+	}
+	return value{num: v.Float()}
+}
+
+func equal(t Type, a value, b value) bool {
+	switch t {
+	case TypeNumber:
+		return a.num == b.num
+	case TypeString:
+		return a.str == b.str
+	}
+	return a.b == b.b
+}
+
+// glob matches case-insensitively, like the item rules do (ids are upper case, users type whatever).
+func glob(pattern string, s string) bool {
+	if len(pattern) > maxGlobLength {
+		return false
+	}
+	ok, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(s))
+	return ok
+}
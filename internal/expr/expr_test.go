@@ -0,0 +1,167 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+type testFlip struct {
+	ProductID   string  `json:"productId"`
+	Profit      int     `json:"profit"`
+	Margin      float64 `json:"margin"`
+	Manipulated bool    `json:"manipulated"`
+	Competition struct {
+		Score float64 `json:"score"`
+	} `json:"competition"`
+	Score float64 `json:"score" expr:"-"`
+}
+
+func newTestFlip() *testFlip {
+	f := &testFlip{ProductID: "ENCHANTED_DIAMOND", Profit: 2500, Margin: 0}
+	f.Competition.Score = 60
+	return f
+}
+
+func eval(t *testing.T, src string) bool {
+	t.Helper()
+	program, err := Compile[testFlip](src)
+	if err != nil {
+		t.Fatalf("Compile(%q) error = %v", src, err)
+	}
+	got, err := program.Eval(newTestFlip())
+	if err != nil {
+		t.Fatalf("Eval(%q) error = %v", src, err)
+	}
+	return got
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 4 - 3 == 3", true}, // left to right
+		{"2 * 3 % 4 == 2", true},
+		{"-2 * 3 == -6", true},
+		{"- -2 == 2", true},
+		{"true || false && false", true}, // && binds tighter
+		{"(true || false) && false", false},
+		{"!false && false", false}, // ! only takes the false
+		{"!(false && false)", true},
+		{"profit > 2000 == true", true}, // comparisons bind tighter than ==
+		{"profit / 2 > 1000 && productId ~ \"ENCHANTED_*\"", true},
+		{"competition.score >= 50 && !manipulated", true},
+		{"false && profit / margin > 0", false}, // short circuit, margin is 0
+		{"true || profit % margin > 0", true},
+		{"1_000 * 2.5 == profit", true},
+		{"1e3 < profit", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			if got := eval(t, tt.src); got != tt.want {
+				t.Errorf("%q = %v, want %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"ENCHANTED_*", true},
+		{"enchanted_*", true}, // case-insensitive
+		{"*DIAMOND", true},
+		{"*_*", true},
+		{"ENCHANTED_DIAMOND", true},
+		{"DIAMOND", false}, // has to match all of it
+		{"ENCHANTED_?", false},
+		{"ENCHANTED_DIAMON?", true},
+		{"[A-E]*", true},
+		{"[F-Z]*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			src := "productId ~ \"" + tt.pattern + "\""
+			if got := eval(t, src); got != tt.want {
+				t.Errorf("%q = %v, want %v", src, got, tt.want)
+			}
+		})
+	}
+
+	if glob(strings.Repeat("*", maxGlobLength+1), "A") {
+		t.Errorf("glob() matched a pattern longer than %d", maxGlobLength)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		// types
+		{`profit > "a"`, 7, "> needs two numbers, got number and string"},
+		{`productId ~ 5`, 10, "~ needs a string and a glob pattern"},
+		{`profit == true`, 7, "== needs two values of the same type"},
+		{`profit && true`, 7, "&& needs two bools"},
+		{`productId + 1 > 2`, 10, "+ needs two numbers"},
+		{`!profit`, 1, "! needs a bool, got a number"},
+		{`-manipulated`, 1, "- needs a number, got a bool"},
+		{`profit + 1`, 7, "expression has to be a condition"},
+		{`productId ~ "[A-"`, 12, "invalid glob pattern"},
+		// unknown fields
+		{`profit > 2000 && proft < 5`, 17, `unknown field "proft", did you mean "profit"?`},
+		{`competition.scor > 5`, 0, `did you mean "competition.score"?`},
+		{`volume > 5`, 0, `unknown field "volume"`},
+		{`score > 5`, 0, `unknown field "score"`}, // tagged expr:"-"
+		// syntax
+		{``, 0, "empty expression"},
+		{`(profit > 5`, 11, "expected ) to close the ( at column 1"},
+		{`profit > 5 5`, 11, "unexpected number 5"},
+		{`profit >`, 8, "expected a value, got the end of the expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile[testFlip](tt.src)
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Compile(%q) error = %v, want an *Error", tt.src, err)
+			}
+			if e.Pos != tt.pos || !strings.Contains(e.Msg, tt.msg) {
+				t.Errorf("Compile(%q) error = %d %q, want %d %q", tt.src, e.Pos, e.Msg, tt.pos, tt.msg)
+			}
+			if tt.src != "" && e.Source != tt.src {
+				t.Errorf("Compile(%q) error source = %q", tt.src, e.Source)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, src := range []string{"profit / margin > 0", "profit % margin > 0"} {
+		program, err := Compile[testFlip](src)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", src, err)
+		}
+		if _, err := program.Eval(newTestFlip()); err == nil || !strings.Contains(err.Error(), "division by zero") {
+			t.Errorf("Eval(%q) error = %v, want division by zero", src, err)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	fields := Fields[testFlip]()
+	want := map[string]Type{"productId": TypeString, "profit": TypeNumber, "margin": TypeNumber, "manipulated": TypeBool, "competition.score": TypeNumber}
+	if len(fields) != len(want) {
+		t.Errorf("Fields() = %v, want %v", fields, want)
+	}
+	for name, typ := range want {
+		if fields[name] != typ {
+			t.Errorf("Fields()[%q] = %v, want %v", name, fields[name], typ)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package expr
+
+import (
+	"path"
+	"strings"
+)
+
+// limits on what we accept. expressions come from users so they get to be small
+const (
+	MaxLength = 1024
+	MaxNodes  = 256
+	MaxDepth  = 32
+)
+
+type nodeKind int
+
+const (
+	nodeNumber nodeKind = iota
+	nodeString
+	nodeBool
+	nodeField
+	nodeUnary
+	nodeBinary
+)
+
+// node of the parsed expression. one struct for every kind, the tree is tiny anyway
+type node struct {
+	kind nodeKind
+	pos  int
+	typ  Type
+
+	num   float64
+	str   string
+	b     bool
+	field field
+
+	op          string
+	left, right *node // unary only uses left
+}
+
+// binding powers. higher binds tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "~": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+const unaryPrecedence = 7
+
+type parser struct {
+	tokens []token
+	at     int
+	schema schema
+	nodes  int
+}
+
+// parse turns the source into a type checked tree (Pratt parser, type checking as nodes are built).
+func parse(src string, s schema) (*node, error) {
+	if len(src) > MaxLength {
+		return nil, errorAt(MaxLength, "expression is longer than %d characters", MaxLength)
+	}
+	if strings.TrimSpace(src) == "" {
+		return nil, errorAt(0, "empty expression")
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, schema: s}
+	root, err := p.expression(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorAt(t.pos, "unexpected %s after the end of the expression", describe(t))
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.at]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.at]
+	if t.kind != tokEOF {
+		p.at++
+	}
+	return t
+}
+
+func (p *parser) newNode(n *node) (*node, error) {
+	p.nodes++
+	if p.nodes > MaxNodes {
+		return nil, errorAt(n.pos, "expression has more than %d parts", MaxNodes)
+	}
+	return n, nil
+}
+
+func (p *parser) expression(minPrecedence int, depth int) (*node, error) {
+	if depth > MaxDepth {
+		return nil, errorAt(p.peek().pos, "expression is nested deeper than %d", MaxDepth)
+	}
+
+	left, err := p.prefix(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec <= minPrecedence {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.expression(prec, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		typ, err := checkBinary(t, left, right)
+		if err != nil {
+			return nil, err
+		}
+		left, err = p.newNode(&node{kind: nodeBinary, pos: t.pos, typ: typ, op: t.text, left: left, right: right})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) prefix(depth int) (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return p.newNode(&node{kind: nodeNumber, pos: t.pos, typ: TypeNumber, num: t.num})
+
+	case tokString:
+		return p.newNode(&node{kind: nodeString, pos: t.pos, typ: TypeString, str: t.str})
+
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return p.newNode(&node{kind: nodeBool, pos: t.pos, typ: TypeBool, b: t.text == "true"})
+		}
+		f, ok := p.schema[t.text]
+		if !ok {
+			return nil, errorAt(t.pos, "unknown field %q%s", t.text, suggest(t.text, p.schema))
+		}
+		return p.newNode(&node{kind: nodeField, pos: t.pos, typ: f.typ, field: f, str: t.text})
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			inner, err := p.expression(0, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.text != ")" || closing.kind != tokOp {
+				return nil, errorAt(closing.pos, "expected ) to close the ( at column %d, got %s", t.pos+1, describe(closing))
+			}
+			return inner, nil
+
+		case "!", "-":
+			operand, err := p.expression(unaryPrecedence, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			want := TypeBool
+			if t.text == "-" {
+				want = TypeNumber
+			}
+			if operand.typ != want {
+				return nil, errorAt(operand.pos, "%s needs a %s, got a %s", t.text, want, operand.typ)
+			}
+			return p.newNode(&node{kind: nodeUnary, pos: t.pos, typ: want, op: t.text, left: operand})
+		}
+	}
+	return nil, errorAt(t.pos, "expected a value, got %s", describe(t))
+}
+
+// checkBinary the type of `left op right`, or why it doesn't make sense.
+func checkBinary(op token, left *node, right *node) (Type, error) {
+	mismatch := func(want string) (Type, error) {
+		return TypeInvalid, errorAt(op.pos, "%s needs %s, got %s and %s", op.text, want, left.typ, right.typ)
+	}
+
+	switch op.text {
+	case "||", "&&":
+		if left.typ != TypeBool || right.typ != TypeBool {
+			return mismatch("two bools")
+		}
+		return TypeBool, nil
+	case "==", "!=":
+		if left.typ != right.typ {
+			return mismatch("two values of the same type")
+		}
+		return TypeBool, nil
+	case "~":
+		if left.typ != TypeString || right.typ != TypeString {
+			return mismatch("a string and a glob pattern")
+		}
+		if right.kind == nodeString {
+			if _, err := path.Match(strings.ToUpper(right.str), ""); err != nil {
+				return TypeInvalid, errorAt(right.pos, "invalid glob pattern %q", right.str)
+			}
+		}
+		return TypeBool, nil
+	case "<", "<=", ">", ">=":
+		if left.typ != TypeNumber || right.typ != TypeNumber {
+			return mismatch("two numbers")
+		}
+		return TypeBool, nil
+	default: // arithmetic
+		if left.typ != TypeNumber || right.typ != TypeNumber {
+			return mismatch("two numbers")
+		}
+		return TypeNumber, nil
+	}
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "the end of the expression"
+	case tokNumber:
+		return "number " + t.text
+	case tokString:
+		return "string " + t.text
+	case tokIdent:
+		return "\"" + t.text + "\""
+	}
+	return "\"" + t.text + "\""
+}
+
+// suggest the closest field name for typos like "proft".
+func suggest(name string, s schema) string {
+	best, bestDistance := "", 3 // more than 2 edits away isn't a typo anymore
+	for candidate := range s {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance || d == bestDistance && best != "" && candidate < best {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return ", did you mean \"" + best + "\"?"
+}
+
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
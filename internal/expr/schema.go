@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Type of a value in an expression.
+type Type int
+
+const (
+	TypeInvalid Type = iota
+	TypeNumber
+	TypeString
+	TypeBool
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	}
+	return "invalid"
+}
+
+// field one usable field of the struct expressions run against.
+type field struct {
+	index []int
+	typ   Type
+	kind  reflect.Kind
+}
+
+// schema the fields of a struct, by json name (that's what users see in the api, so that's what they write).
+type schema map[string]field
+
+var schemas sync.Map // reflect.Type -> schema
+
+// schemaOf every number/string/bool field of `t` that has a json name. Nested structs are reachable as "outer.inner". Fields
+// tagged `expr:"-"` are left out, for values that aren't set yet when expressions run.
+func schemaOf(t reflect.Type) schema {
+	if s, ok := schemas.Load(t); ok {
+		return s.(schema)
+	}
+	s := make(schema)
+	collectFields(t, nil, "", s)
+	schemas.Store(t, s)
+	return s
+}
+
+func collectFields(t reflect.Type, index []int, prefix string, s schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || f.Tag.Get("expr") == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		name = prefix + name
+		idx := append(append([]int(nil), index...), i)
+
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			s[name] = field{index: idx, typ: TypeNumber, kind: f.Type.Kind()}
+		case reflect.String:
+			s[name] = field{index: idx, typ: TypeString, kind: reflect.String}
+		case reflect.Bool:
+			s[name] = field{index: idx, typ: TypeBool, kind: reflect.Bool}
+		case reflect.Struct:
+			collectFields(f.Type, idx, name+".", s)
+		}
+	}
+}
+
+// Fields lists the names usable in expressions over T, with their types. Handy for error messages and docs.
+func Fields[T any]() map[string]Type {
+	s := schemaOf(reflect.TypeFor[T]())
+	fields := make(map[string]Type, len(s))
+	for name, f := range s {
+		fields[name] = f.typ
+	}
+	return fields
+}
@@ -3,14 +3,17 @@ package flippers
 import (
 	"Hyflip-Server/internal/api"
 	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/manipulation"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const PriceHistoryTimeSpan = 3600 * 24 * 7 // 1 week
+const PriceHistoryTimeSpan = 7 * 24 * time.Hour // 1 week
 
 type BazaarResponse struct {
 	Success     bool               `json:"success"`
@@ -63,34 +66,111 @@ type BazaarFoundFlip struct {
 	BuyMovingWeek                   int     `json:"buyMovingWeek"`
 	RecommendedFlipVolume           int     `json:"recommendedFlipVolume"`
 	ProfitFromRecommendedFlipVolume int     `json:"profitFromRecommendedFlipVolume"`
+	// order book, see AnalyzeBook
+	BuyDepth           int     `json:"buyDepth"`
+	SellDepth          int     `json:"sellDepth"`
+	BuyFillPrice       float64 `json:"buyFillPrice"`
+	SellFillPrice      float64 `json:"sellFillPrice"`
+	SlippagePercentage float64 `json:"slippagePercentage"`
+	// AdjustedProfit profit of RecommendedFlipVolume at the fill prices instead of the top of the book
+	AdjustedProfit int `json:"adjustedProfit"`
+	// fill time of RecommendedFlipVolume, see EstimateFill. 0 = unknown
+	BuyFillHours       float64 `json:"buyFillHours"`
+	SellFillHours      float64 `json:"sellFillHours"`
+	EstimatedFillHours float64 `json:"estimatedFillHours"`
+	// ProfitPerHour AdjustedProfit over EstimatedFillHours
+	ProfitPerHour float64 `json:"profitPerHour"`
+	// CompetitionScore 0-100, how much of an order war the product is. Competition has the details
+	CompetitionScore float64     `json:"competitionScore"`
+	Competition      Competition `json:"competition"`
+	// Volatility how much the sell price moved over PriceHistoryTimeSpan, std dev over mean in %
+	Volatility float64 `json:"volatility"`
+	// Manipulation what the manipulation detectors measured, ManipulationVerdict what the user's thresholds make of it
+	Manipulation        manipulation.Measurements `json:"manipulation"`
+	ManipulationVerdict manipulation.Verdict      `json:"manipulationVerdict"`
+	// Score from the user's scorer, see Scorer. set per user when flips are sent, after filtering, so filter expressions can't
+	// use it
+	Score float64 `json:"score" expr:"-"`
+}
+
+// bzCandidate a product that passed Filter, on its way to the manipulation check.
+type bzCandidate struct {
+	api.PriceHistoryProduct
+	evidence          manipulation.Evidence
+	recommendedVolume int
+	book              BookStats
+	fill              FillEstimate
+	competition       Competition
 }
 
 const (
-	VolumeAverageCheck       = 8
-	MaxSwingPercentage       = 40
+	VolumeAverageCheck       = manipulation.VolumeAverageCheck
 	RecommendedBuyPercentage = 0.01 // 1%;arbitrary for now
 	BazaarTax                = 1.25
 )
 
+// SnapshotRecorder is handed every bazaar poll BzFlip makes (see storage.BazaarHistoryTable).
+type SnapshotRecorder interface {
+	RecordBazaar(ctx context.Context, at time.Time, products map[string]Product) error
+}
+
+// BzFlipper is everything a bazaar flip cycle needs besides the config.
+type BzFlipper struct {
+	Api *api.HypixelApiClient
+	// Recorder optional. recording happens in the background so a slow db never holds up flips
+	Recorder SnapshotRecorder
+	// Tracker optional. without it fill times only know the moving week
+	Tracker *SnapshotTracker
+
+	// latest products of the last successful poll, for whoever needs prices and not flips (craft flips...)
+	latest atomic.Pointer[map[string]Product]
+	// rejections of the last finished cycle, see Rejections
+	rejections atomic.Pointer[[]Rejection]
+}
+
 // BzFlip returns a channel of found flips (for efficiency purposes). It uses the config to filter items and then checks for market manipulation using `price_checker.go`. Used for cache updates.
 func BzFlip(cl *api.HypixelApiClient, config *config.BZConfig) (<-chan BazaarFoundFlip, error) {
+	return BzFlipCtx(context.Background(), cl, config)
+}
+
+// BzFlipCtx is BzFlip but stops as soon as ctx is done: queued products are dropped, in-flight price checks cancelled and the channel closed early.
+func BzFlipCtx(ctx context.Context, cl *api.HypixelApiClient, config *config.BZConfig) (<-chan BazaarFoundFlip, error) {
+	return (&BzFlipper{Api: cl}).Flip(ctx, config)
+}
+
+// Flip is BzFlipCtx, plus recording the poll if there's a Recorder.
+func (f *BzFlipper) Flip(ctx context.Context, config *config.BZConfig) (<-chan BazaarFoundFlip, error) {
+	cl := f.Api
 	reqTime := time.Now()
 	var resp BazaarResponse
-	err := cl.Get(api.SbApiUrl+"bazaar", &resp)
+	err := cl.GetCtx(ctx, cl.Endpoints.Skyblock+"bazaar", &resp)
 	if err != nil {
-		return nil, fmt.Errorf("error while loading bazaar: " + err.Error())
+		return nil, fmt.Errorf("error while loading bazaar: %w", err)
 	}
 	if !resp.Success {
 		return nil, fmt.Errorf("bzflip not successful")
 	}
 	log.Printf("\nBazaar response success was: %t. Products found: %d. Time taken: %s\n", resp.Success, len(resp.Products), time.Since(reqTime).String())
+	f.latest.Store(&resp.Products)
+	if f.Tracker != nil {
+		f.Tracker.Observe(resp.updatedAt(), resp.Products)
+	}
+	if f.Recorder != nil {
+		go f.record(&resp)
+	}
 
 	// products which pass our initial check, and will now be checked for market manipulating.
-	respectableProducts := make(chan api.PriceHistoryProduct, 150)
+	respectableProducts := make(chan bzCandidate, 150)
 	// flips
 	resultsChan := make(chan BazaarFoundFlip, 200)
 	var (
 		wg sync.WaitGroup
+		// products we couldn't check. they are dropped since we can't vouch for them, but we say so instead of silently losing them
+		failedChecks  atomic.Int32
+		breakerChecks atomic.Int32
+		// flagged under the default thresholds. still sent as flips, Filter judges with the user's own
+		rejectionsLock sync.Mutex
+		rejections     = make([]Rejection, 0)
 	)
 
 	// worker pool for market manipulation checker
@@ -100,30 +180,41 @@ func BzFlip(cl *api.HypixelApiClient, config *config.BZConfig) (<-chan BazaarFou
 		// Price Checker/Market Manipulation Checker
 		go func() {
 			defer wg.Done()
-			for product := range respectableProducts {
-				fr, err := api.IsManipulatedBazaarProduct(cl, &product, PriceHistoryTimeSpan)
+			for candidate := range respectableProducts {
+				if ctx.Err() != nil {
+					continue // just drain
+				}
+				product := candidate.PriceHistoryProduct
+				measurements, err := measure(ctx, cl, candidate.evidence, product.ProductID)
 				if err != nil {
+					if ctx.Err() != nil {
+						continue // cancelled, not failed
+					}
+					// circuit open = price history host is down. these fail instantly so the rest of the queue drains fast
+					if errors.Is(err, api.ErrCircuitOpen) {
+						breakerChecks.Add(1)
+					} else {
+						failedChecks.Add(1)
+					}
 					continue
 				}
-				if fr {
-					//log.Println(product.ProductID + " is suspected to be market manipulated.")
-					continue
+				if verdict := manipulation.Judge(&measurements, nil); verdict.Manipulated {
+					rejectionsLock.Lock()
+					rejections = append(rejections, Rejection{
+						ProductID:    product.ProductID,
+						At:           time.Now(),
+						SellPrice:    product.SellPrice,
+						BuyPrice:     product.BuyPrice,
+						Measurements: measurements,
+						Verdict:      verdict,
+					})
+					rejectionsLock.Unlock()
 				}
 
-				recomFlipVol := int(float64(product.BuyMovingWeek/VolumeAverageCheck) * RecommendedBuyPercentage)
-				profitFromRecom := product.Profit * recomFlipVol
-				resultsChan <- BazaarFoundFlip{
-					ProductID:                       product.ProductID,
-					Command:                         "/bzs " + product.ProductID,
-					Profit:                          product.Profit,
-					SellPrice:                       product.SellPrice,
-					BuyPrice:                        product.BuyPrice,
-					SellVolume:                      product.SellVolume,
-					SellMovingWeek:                  product.SellMovingWeek,
-					BuyVolume:                       product.BuyVolume,
-					BuyMovingWeek:                   product.BuyMovingWeek,
-					RecommendedFlipVolume:           recomFlipVol,
-					ProfitFromRecommendedFlipVolume: profitFromRecom,
+				flip := newBzFlip(&candidate, measurements)
+				select {
+				case resultsChan <- flip:
+				case <-ctx.Done():
 				}
 			}
 		}()
@@ -131,33 +222,147 @@ func BzFlip(cl *api.HypixelApiClient, config *config.BZConfig) (<-chan BazaarFou
 
 	// Manager goroutine to close the channels
 	go func() {
+	products:
 		for _, product := range resp.Products {
-			filteredProduct := Filter(&product, nil, config)
-			if filteredProduct == nil { // product does not match our given filters
+			candidate, ok := newCandidate(&product, config, f.Tracker)
+			if !ok {
 				continue
 			}
-
-			// copy everytime but allg ig. if we sent *Product then it would just point to the latest variable in the loop as the variable will be re-used
-			// so 0xUWU would replace 0x322 as product after an iteration
-			respectableProducts <- api.PriceHistoryProduct{
-				ProductID:      product.ProductID,
-				Profit:         filteredProduct.Profit,
-				SellPrice:      product.QuickStatus.SellPrice,
-				BuyPrice:       product.QuickStatus.BuyPrice,
-				SellVolume:     filteredProduct.SellVolume,
-				SellMovingWeek: filteredProduct.SellMovingWeek,
-				BuyVolume:      filteredProduct.BuyVolume,
-				BuyMovingWeek:  filteredProduct.BuyMovingWeek,
+			select {
+			case respectableProducts <- candidate:
+			case <-ctx.Done():
+				break products
 			}
 		}
 		close(respectableProducts) // no more work for the price history checking goroutine
 		wg.Wait()                  // wait for price checking to be done so we can confirm all flips
-		close(resultsChan)         // no more work for the caller of this function. everything DONE
+		if failed, skipped := failedChecks.Load(), breakerChecks.Load(); failed > 0 || skipped > 0 {
+			log.Printf("Dropped %d products whose manipulation check failed and %d skipped because the price history host is down.\n", failed, skipped)
+		}
+		if ctx.Err() == nil {
+			f.rejections.Store(&rejections)
+		}
+		close(resultsChan) // no more work for the caller of this function. everything DONE
 	}()
 
 	return resultsChan, nil
 }
 
+// newCandidate runs the checks that only need the product itself. ok false if the product isn't a flip under the config.
+func newCandidate(product *Product, config *config.BZConfig, tracker *SnapshotTracker) (bzCandidate, bool) {
+	filteredProduct := Filter(product, nil, config)
+	if filteredProduct == nil { // product does not match our given filters
+		return bzCandidate{}, false
+	}
+
+	// the books are cheap to walk and we still have the whole product here, so do it before the (slow) manipulation check
+	recomFlipVol := int(float64(filteredProduct.BuyMovingWeek/VolumeAverageCheck) * RecommendedBuyPercentage)
+	book := AnalyzeBook(product, recomFlipVol)
+	if exceedsSlippage(book.SlippagePercentage, config) {
+		return bzCandidate{}, false
+	}
+	competition := tracker.Competition(product.ProductID)
+	if exceedsCompetition(competition.Score, config) {
+		return bzCandidate{}, false
+	}
+
+	return bzCandidate{
+		PriceHistoryProduct: api.PriceHistoryProduct{
+			ProductID:      product.ProductID,
+			Profit:         filteredProduct.Profit,
+			SellPrice:      product.QuickStatus.SellPrice,
+			BuyPrice:       product.QuickStatus.BuyPrice,
+			SellVolume:     filteredProduct.SellVolume,
+			SellMovingWeek: filteredProduct.SellMovingWeek,
+			BuyVolume:      filteredProduct.BuyVolume,
+			BuyMovingWeek:  filteredProduct.BuyMovingWeek,
+		},
+		evidence:          evidenceOf(product),
+		recommendedVolume: recomFlipVol,
+		book:              book,
+		fill:              EstimateFill(product, recomFlipVol, tracker),
+		competition:       competition,
+	}, true
+}
+
+// newBzFlip a measured candidate as a flip.
+func newBzFlip(candidate *bzCandidate, measurements manipulation.Measurements) BazaarFoundFlip {
+	product := candidate.PriceHistoryProduct
+	recomFlipVol := candidate.recommendedVolume
+	profitFromRecom := product.Profit * recomFlipVol
+	return BazaarFoundFlip{
+		ProductID:                       product.ProductID,
+		Command:                         "/bzs " + product.ProductID,
+		Profit:                          product.Profit,
+		SellPrice:                       product.SellPrice,
+		BuyPrice:                        product.BuyPrice,
+		SellVolume:                      product.SellVolume,
+		SellMovingWeek:                  product.SellMovingWeek,
+		BuyVolume:                       product.BuyVolume,
+		BuyMovingWeek:                   product.BuyMovingWeek,
+		RecommendedFlipVolume:           recomFlipVol,
+		ProfitFromRecommendedFlipVolume: profitFromRecom,
+		BuyDepth:                        candidate.book.BuyDepth,
+		SellDepth:                       candidate.book.SellDepth,
+		BuyFillPrice:                    candidate.book.BuyFillPrice,
+		SellFillPrice:                   candidate.book.SellFillPrice,
+		SlippagePercentage:              candidate.book.SlippagePercentage,
+		AdjustedProfit:                  candidate.book.AdjustedProfit,
+		BuyFillHours:                    candidate.fill.BuyFillHours,
+		SellFillHours:                   candidate.fill.SellFillHours,
+		EstimatedFillHours:              candidate.fill.TotalHours,
+		ProfitPerHour:                   candidate.fill.ProfitPerHour(candidate.book.AdjustedProfit),
+		CompetitionScore:                candidate.competition.Score,
+		Competition:                     candidate.competition,
+		Volatility:                      measurements.Volatility,
+		Manipulation:                    measurements,
+	}
+}
+
+// Latest every product of the last successful poll. nil if there wasn't one yet. Don't modify it, it's shared.
+func (f *BzFlipper) Latest() map[string]Product {
+	if products := f.latest.Load(); products != nil {
+		return *products
+	}
+	return nil
+}
+
+// Rejections products the last finished cycle flagged as manipulated under the default thresholds.
+func (f *BzFlipper) Rejections() []Rejection {
+	if rejections := f.rejections.Load(); rejections != nil {
+		return *rejections
+	}
+	return nil
+}
+
+// record saves a poll. Not tied to the cycle's ctx, an abandoned cycle still fetched real data.
+func (f *BzFlipper) record(resp *BazaarResponse) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := f.Recorder.RecordBazaar(ctx, resp.updatedAt(), resp.Products); err != nil {
+		log.Println("Error recording bazaar snapshot. Error: " + err.Error())
+	}
+}
+
+// updatedAt when Hypixel last updated the bazaar.
+func (r *BazaarResponse) updatedAt() time.Time {
+	if r.LastUpdated == 0 {
+		return time.Now() // mocks/fixtures don't always bother with it
+	}
+	return time.UnixMilli(r.LastUpdated)
+}
+
+// FilterFlips the flips of a cache snapshot that pass a user's config.
+func FilterFlips(snapshot map[int]BazaarFoundFlip, bzConfig *config.BZConfig) []BazaarFoundFlip {
+	flips := make([]BazaarFoundFlip, 0, len(snapshot))
+	for _, flip := range snapshot {
+		if Filter(nil, &flip, bzConfig) != nil {
+			flips = append(flips, flip)
+		}
+	}
+	return flips
+}
+
 // Filter filter using a config and EITHER Product or BazaarFoundFlip.
 func Filter(product *Product, bzFlip *BazaarFoundFlip, bzConfig *config.BZConfig) *FilteredProductInfo {
 	var (
@@ -171,16 +376,28 @@ func Filter(product *Product, bzFlip *BazaarFoundFlip, bzConfig *config.BZConfig
 	)
 
 	if product != nil {
+		// slippage needs the recommended volume and competition the tracker, so BzFlip checks those itself
 		// one hell of a one-liner huh
 		productId, sellPrice, buyPrice, sellVolume, buyVolume, sellMovingWeek, buyMovingWeek = product.ProductID, product.QuickStatus.SellPrice, product.QuickStatus.BuyPrice, product.QuickStatus.SellVolume, product.QuickStatus.BuyVolume, product.QuickStatus.SellMovingWeek, product.QuickStatus.BuyMovingWeek
 	} else if bzFlip != nil {
 		productId, sellPrice, buyPrice, sellVolume, buyVolume, sellMovingWeek, buyMovingWeek = bzFlip.ProductID, bzFlip.SellPrice, bzFlip.BuyPrice, bzFlip.SellVolume, bzFlip.BuyVolume, bzFlip.SellMovingWeek, bzFlip.BuyMovingWeek
+		if exceedsSlippage(bzFlip.SlippagePercentage, bzConfig) || exceedsCompetition(bzFlip.CompetitionScore, bzConfig) {
+			return nil
+		}
+		// manipulation is judged per user, products only get measured once they're flips
+		if JudgeFlip(bzFlip, bzConfig).Manipulated {
+			return nil
+		}
+		// only flips have every field the expression can use, so products get it checked once they're flips
+		if !matchesExpression(bzFlip, bzConfig) {
+			return nil
+		}
 	} else {
 		return nil // both product and bzFlip cannot be nil
 	}
 
-	// Name is excluded. Can be "COBBLE" e.g. to exclude COBBLESTONE, ENCHANTED_COBBLESTONE and so on
-	if isIdExcluded(productId, bzConfig) {
+	// Name is excluded (or not included). Can be "COBBLE" e.g. to exclude COBBLESTONE, ENCHANTED_COBBLESTONE and so on
+	if !rulesFor(bzConfig).Allows(productId) {
 		//log.Println("Ignoring product: " + product.ProductID + ". Cause: EXCLUDED_ITEMS.")
 		return nil
 	}
@@ -214,6 +431,14 @@ func Filter(product *Product, bzFlip *BazaarFoundFlip, bzConfig *config.BZConfig
 		return nil
 	}
 
+	// insta-buys/sells per day. 0 = don't care
+	if bzConfig.MinInstaBuys > 0 && buyMovingWeek/7 < bzConfig.MinInstaBuys {
+		return nil
+	}
+	if bzConfig.MaxInstaSells > 0 && sellMovingWeek/7 > bzConfig.MaxInstaSells {
+		return nil
+	}
+
 	// to ensure there is enough daily demand that you dont have to do weekly flips lol
 	if buyMovingWeek/VolumeAverageCheck <= 10 || sellMovingWeek/VolumeAverageCheck <= 10 {
 		//log.Println("Ignoring product: " + product.ProductID + ". Cause: MIN_DAILY_BUY_/_SELL_WEEK (" + strconv.Itoa(buyMovingWeek / VolumeAverageCheck) + "/" + strconv.Itoa(sellMovingWeek / VolumeAverageCheck) + ").")
@@ -229,12 +454,3 @@ func Filter(product *Product, bzFlip *BazaarFoundFlip, bzConfig *config.BZConfig
 		BuyMovingWeek:  buyMovingWeek,
 	}
 }
-
-func isIdExcluded(itemId string, config *config.BZConfig) bool {
-	for _, v := range config.ExcludeItems {
-		if strings.Contains(v, itemId) {
-			return true
-		}
-	}
-	return false
-}
@@ -0,0 +1,117 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/config"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayFixtures copies the recorded set into a temp dir, moving the price history up to now so it's inside the checked window.
+func replayFixtures(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := os.ReadDir("../../fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join("../../fixtures", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(file.Name(), "pricehistory") {
+			data = redate(t, data)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.Name()), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// redate shifts every point of a price history fixture so the newest one is an hour old.
+func redate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var fixture map[string]any
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	var points map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(fixture["body"].(string)), &points); err != nil {
+		t.Fatal(err)
+	}
+
+	var latest time.Time
+	for at := range points {
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.After(latest) {
+			latest = parsed
+		}
+	}
+	shift := time.Now().Add(-time.Hour).Sub(latest)
+
+	shifted := make(map[string]json.RawMessage, len(points))
+	for at, point := range points {
+		parsed, _ := time.Parse(time.RFC3339, at)
+		shifted[parsed.Add(shift).UTC().Format(time.RFC3339)] = point
+	}
+	body, err := json.Marshal(shifted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture["body"] = string(body)
+	if data, err = json.Marshal(fixture); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBzFlipReplay(t *testing.T) {
+	cl := api.Init([]string{"test-key"}, api.WithTransport(&api.ReplayTransport{Dir: replayFixtures(t)}))
+	flipper := &BzFlipper{Api: cl, Tracker: NewSnapshotTracker()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	flipsChan, err := flipper.Flip(ctx, config.GenerateDefaultBZConfig())
+	if err != nil {
+		t.Fatalf("Flip() err = %v", err)
+	}
+	flips := make(map[string]BazaarFoundFlip)
+	for flip := range flipsChan {
+		flips[flip.ProductID] = flip
+	}
+
+	if len(flipper.Latest()) != 3 {
+		t.Errorf("Latest() has %d products, want every product of the poll", len(flipper.Latest()))
+	}
+	// COBBLESTONE isn't worth it and BOOSTER_COOKIE barely trades
+	if len(flips) != 1 {
+		t.Fatalf("got flips %v, want only ENCHANTED_DIAMOND", flips)
+	}
+	flip, ok := flips["ENCHANTED_DIAMOND"]
+	if !ok {
+		t.Fatalf("got flips %v, want ENCHANTED_DIAMOND", flips)
+	}
+	expect(t, "Command", flip.Command, "/bzs ENCHANTED_DIAMOND")
+	expect(t, "RecommendedFlipVolume", flip.RecommendedFlipVolume, int(float64(500000/VolumeAverageCheck)*RecommendedBuyPercentage))
+	// the manipulation check had the (replayed) price history to work with
+	if flip.Manipulation.HistoryPoints == 0 {
+		t.Errorf("Manipulation = %+v, want it measured on the price history", flip.Manipulation)
+	}
+}
+
+func expect[T comparable](t *testing.T, field string, got T, want T) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
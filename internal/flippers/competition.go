@@ -0,0 +1,128 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"time"
+)
+
+// competitionWindow how far back the competition stats look. the cache polls every ~20s so a minute alone is ~3 samples
+const competitionWindow = 5 * time.Minute
+
+// these are what counts as "as bad as it gets" for each part of the score. anything above is capped
+const (
+	maxTopChangesPerMinute  = 3.0  // top order replaced on (almost) every poll
+	maxOrderChurn           = 0.5  // half the orders on the book come and go per minute
+	maxPriceLevelsPerMinute = 6.0  // distinct top prices seen per minute, both sides together
+	topChangesWeight        = 0.45 // being outbid is what actually kills a flip, so it matters most
+	orderChurnWeight        = 0.25
+	priceLevelsWeight       = 0.30
+)
+
+// Competition how contested a product's top of book is. Score is 0 (nobody touches it) to 100 (order war).
+type Competition struct {
+	Score float64 `json:"score"`
+	// TopChangesPerMinute how often the best buy order or sell offer price changed
+	TopChangesPerMinute float64 `json:"topChangesPerMinute"`
+	// OrderChurn orders added/removed per minute, relative to the orders on the book
+	OrderChurn float64 `json:"orderChurn"`
+	// PriceLevelsPerMinute distinct top prices seen per minute, not counting the ones we started with
+	PriceLevelsPerMinute float64 `json:"priceLevelsPerMinute"`
+}
+
+// bookObservation the top of one product's book in one poll.
+type bookObservation struct {
+	at         time.Time
+	topBuy     float64 // best buy order (sell_summary[0])
+	topSell    float64 // best sell offer (buy_summary[0])
+	buyOrders  int
+	sellOrders int
+}
+
+func observeBook(at time.Time, p *Product) bookObservation {
+	obs := bookObservation{at: at, topBuy: p.QuickStatus.SellPrice, topSell: p.QuickStatus.BuyPrice, buyOrders: p.QuickStatus.BuyOrders, sellOrders: p.QuickStatus.SellOrders}
+	if len(p.SellSummary) > 0 {
+		obs.topBuy = p.SellSummary[0].PricePerUnit
+	}
+	if len(p.BuySummary) > 0 {
+		obs.topSell = p.BuySummary[0].PricePerUnit
+	}
+	return obs
+}
+
+// pushObservation appends and drops whatever fell out of competitionWindow.
+func (a *productActivity) pushObservation(obs bookObservation) {
+	cutoff := obs.at.Add(-competitionWindow)
+	kept := a.recent[:0]
+	for _, o := range a.recent {
+		if o.at.After(cutoff) {
+			kept = append(kept, o)
+		}
+	}
+	a.recent = append(kept, obs)
+}
+
+// Competition of a product over the last competitionWindow. Zero until we've seen it at least twice.
+func (t *SnapshotTracker) Competition(productId string) Competition {
+	if t == nil {
+		return Competition{}
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	a, ok := t.products[productId]
+	if !ok || len(a.recent) < 2 {
+		return Competition{}
+	}
+	return measureCompetition(a.recent)
+}
+
+func measureCompetition(recent []bookObservation) Competition {
+	minutes := recent[len(recent)-1].at.Sub(recent[0].at).Minutes()
+	if minutes <= 0 {
+		return Competition{}
+	}
+
+	topChanges, churn := 0, 0.0
+	levels := make(map[float64]bool)
+	for i, obs := range recent {
+		levels[obs.topBuy] = true
+		levels[-obs.topSell] = true // negative so a buy and a sell at the same price still count as two levels
+		if i == 0 {
+			continue
+		}
+		prev := recent[i-1]
+		if obs.topBuy != prev.topBuy {
+			topChanges++
+		}
+		if obs.topSell != prev.topSell {
+			topChanges++
+		}
+		// only the net change is visible, so real churn is at least this
+		changed := abs(obs.buyOrders-prev.buyOrders) + abs(obs.sellOrders-prev.sellOrders)
+		if total := prev.buyOrders + prev.sellOrders; total > 0 {
+			churn += float64(changed) / float64(total)
+		}
+	}
+
+	c := Competition{
+		TopChangesPerMinute:  float64(topChanges) / minutes,
+		OrderChurn:           churn / minutes,
+		PriceLevelsPerMinute: float64(max(len(levels)-2, 0)) / minutes,
+	}
+	c.Score = 100 * (topChangesWeight*min(c.TopChangesPerMinute/maxTopChangesPerMinute, 1) +
+		orderChurnWeight*min(c.OrderChurn/maxOrderChurn, 1) +
+		priceLevelsWeight*min(c.PriceLevelsPerMinute/maxPriceLevelsPerMinute, 1))
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// exceedsCompetition whether the config's max competition score rules the flip out. 0 = no limit.
+func exceedsCompetition(score float64, conf *config.BZConfig) bool {
+	return conf.MaxCompetitionScore > 0 && score > conf.MaxCompetitionScore
+}
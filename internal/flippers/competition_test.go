@@ -0,0 +1,104 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"testing"
+	"time"
+)
+
+var competitionStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// book the top of the book `seconds` after competitionStart.
+func book(seconds int, topBuy float64, topSell float64, buyOrders int, sellOrders int) bookObservation {
+	return bookObservation{at: competitionStart.Add(time.Duration(seconds) * time.Second), topBuy: topBuy, topSell: topSell, buyOrders: buyOrders, sellOrders: sellOrders}
+}
+
+func TestMeasureCompetition(t *testing.T) {
+	// a new top on both sides every poll, and half the orders gone or new
+	war := []bookObservation{book(0, 10, 20, 10, 10)}
+	for i := 1; i <= 3; i++ {
+		war = append(war, book(i*20, 10+float64(i), 20-float64(i), 10+5*(i%2), 10-5*(i%2)))
+	}
+
+	tests := []struct {
+		name   string
+		recent []bookObservation
+		want   Competition
+	}{
+		{"nobody touches it", []bookObservation{book(0, 10, 20, 10, 10), book(120, 10, 20, 10, 10)}, Competition{}},
+		{"no time passed", []bookObservation{book(0, 10, 20, 10, 10), book(0, 11, 19, 5, 5)}, Competition{}},
+		// 2 changes and 2 new prices over 2 minutes
+		{"outbid now and then", []bookObservation{book(0, 10, 20, 10, 10), book(60, 11, 20, 10, 10), book(120, 11, 19, 10, 10)},
+			Competition{Score: 100 * (topChangesWeight/maxTopChangesPerMinute + priceLevelsWeight/maxPriceLevelsPerMinute), TopChangesPerMinute: 1, PriceLevelsPerMinute: 1}},
+		// 10 of 20 orders changed in a minute
+		{"orders coming and going", []bookObservation{book(0, 10, 20, 10, 10), book(60, 10, 20, 15, 5)},
+			Competition{Score: 100 * orderChurnWeight, OrderChurn: 0.5}},
+		{"a buy and a sell at the same price are two levels", []bookObservation{book(0, 10, 10, 10, 10), book(60, 10, 10, 10, 10)}, Competition{}},
+		{"order war is capped at 100", war, Competition{Score: 100, TopChangesPerMinute: 6, OrderChurn: 1.5, PriceLevelsPerMinute: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measureCompetition(tt.recent)
+			near(t, "Score", got.Score, tt.want.Score)
+			near(t, "TopChangesPerMinute", got.TopChangesPerMinute, tt.want.TopChangesPerMinute)
+			near(t, "OrderChurn", got.OrderChurn, tt.want.OrderChurn)
+			near(t, "PriceLevelsPerMinute", got.PriceLevelsPerMinute, tt.want.PriceLevelsPerMinute)
+		})
+	}
+}
+
+func TestTrackerCompetition(t *testing.T) {
+	poll := func(topBuy float64) map[string]Product {
+		return map[string]Product{"A": {
+			ProductID:   "A",
+			SellSummary: levels(100, topBuy),
+			BuySummary:  levels(100, 20),
+			QuickStatus: QuickStatus{BuyOrders: 10, SellOrders: 10},
+		}}
+	}
+	tests := []struct {
+		name    string
+		polls   []int // seconds after competitionStart, the top buy order goes up by one every poll
+		nilSelf bool
+		want    float64 // TopChangesPerMinute
+	}{
+		{"no tracker", []int{0, 60}, true, 0},
+		{"seen once", []int{0}, false, 0},
+		{"seen twice", []int{0, 60}, false, 1},
+		{"older polls fall out of the window", []int{0, 600, 660}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewSnapshotTracker()
+			if tt.nilSelf {
+				tracker = nil
+			}
+			for i, seconds := range tt.polls {
+				if tracker != nil {
+					tracker.Observe(competitionStart.Add(time.Duration(seconds)*time.Second), poll(10+float64(i)))
+				}
+			}
+			near(t, "TopChangesPerMinute", tracker.Competition("A").TopChangesPerMinute, tt.want)
+			expect(t, "unknown product", tracker.Competition("B"), Competition{})
+		})
+	}
+}
+
+func TestExceedsCompetition(t *testing.T) {
+	tests := []struct {
+		name  string
+		max   float64
+		score float64
+		want  bool
+	}{
+		{"no limit", 0, 100, false},
+		{"under", 50, 49, false},
+		{"at", 50, 50, false},
+		{"over", 50, 51, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, "exceedsCompetition()", exceedsCompetition(tt.score, &config.BZConfig{MaxCompetitionScore: tt.max}), tt.want)
+		})
+	}
+}
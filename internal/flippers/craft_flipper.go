@@ -0,0 +1,252 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/recipes"
+	"context"
+	"errors"
+	"log"
+	"sort"
+)
+
+const (
+	MarketBazaar  = "bazaar"
+	MarketAuction = "auction"
+)
+
+// Ingredient one line of a craft flip's shopping list.
+type Ingredient struct {
+	ItemID     string  `json:"itemId"`
+	Amount     float64 `json:"amount"`
+	UnitPrice  float64 `json:"unitPrice"`
+	TotalPrice float64 `json:"totalPrice"`
+	// Source where to buy it. MarketBazaar or MarketAuction
+	Source string `json:"source"`
+}
+
+type CraftFoundFlip struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Command   string `json:"command"`
+	// Market where the craft is sold. MarketBazaar or MarketAuction
+	Market string `json:"market"`
+	// OutputCount items one craft makes. every price below is per craft, not per item
+	OutputCount      int          `json:"outputCount"`
+	CraftCost        float64      `json:"craftCost"`
+	SellValue        float64      `json:"sellValue"`
+	Profit           int          `json:"profit"`
+	ProfitPercentage float64      `json:"profitPercentage"`
+	Ingredients      []Ingredient `json:"ingredients"`
+	// OutputMovingWeek insta-buys a week of the output. 0 for AH outputs
+	OutputMovingWeek int `json:"outputMovingWeek"`
+
+	// the best recipe with insta-bought and with buy ordered ingredients, FilterCraft picks the user's. nil if the
+	// ingredients can't be bought that way
+	instaBuy *craftPricing
+	buyOrder *craftPricing
+}
+
+// craftPricing one recipe of a craft flip, priced one way.
+type craftPricing struct {
+	outputCount int
+	sellValue   float64
+	cost        float64
+	ingredients []Ingredient
+}
+
+// CraftFlipper finds items that are cheaper to craft than to buy.
+type CraftFlipper struct {
+	Api  *api.HypixelApiClient
+	Book *recipes.Book
+	// Products latest bazaar products, usually BazaarCache.Products
+	Products func() map[string]Product
+}
+
+// Flip prices every recipe we know. Ingredients come from the bazaar (or the AH if they're not on it), crafts are sold on the
+// bazaar if they're there, otherwise on the AH if the config allows it.
+func (f *CraftFlipper) Flip(ctx context.Context, conf *config.CraftConfig) (<-chan CraftFoundFlip, error) {
+	products := f.Products()
+	if products == nil {
+		return nil, errors.New("no bazaar data yet")
+	}
+
+	// lowest BINs are only a bonus, bazaar-only crafts still work without them
+	bins, err := api.GetLowestBinsCtx(ctx, f.Api)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Println("Could not load lowest BINs, only pricing crafts from the bazaar. Error: " + err.Error())
+	}
+
+	resultsChan := make(chan CraftFoundFlip, 200)
+	go func() {
+		defer close(resultsChan)
+		for output, options := range f.Book.Recipes {
+			if ctx.Err() != nil {
+				return
+			}
+			flip, ok := f.evaluate(output, options, products, bins, conf)
+			if !ok {
+				continue
+			}
+			select {
+			case resultsChan <- flip:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultsChan, nil
+}
+
+// evaluate the cheapest recipe of an item against what the item sells for, with both ways of buying the ingredients.
+func (f *CraftFlipper) evaluate(output string, options []recipes.Recipe, products map[string]Product, bins map[string]float64, conf *config.CraftConfig) (CraftFoundFlip, bool) {
+	if !cachedRules(conf.ExcludeItems, nil, false).Allows(output) {
+		return CraftFoundFlip{}, false
+	}
+	value, market, movingWeek, ok := outputValue(output, products, bins, conf.IncludeAuction, conf.MinOutputMovingWeek)
+	if !ok {
+		return CraftFoundFlip{}, false
+	}
+
+	flip := CraftFoundFlip{
+		ProductID:        output,
+		Name:             f.Book.Names[output],
+		Command:          "/recipe " + output,
+		Market:           market,
+		OutputMovingWeek: movingWeek,
+	}
+	for _, recipe := range options {
+		for _, buyOrders := range []bool{false, true} {
+			cost, ingredients, ok := priceIngredients(recipe.Ingredients, products, bins, buyOrders)
+			if !ok {
+				continue // can't buy it anywhere we know of
+			}
+			pricing := &craftPricing{outputCount: recipe.Count, sellValue: value * float64(recipe.Count), cost: cost, ingredients: ingredients}
+			best := &flip.instaBuy
+			if buyOrders {
+				best = &flip.buyOrder
+			}
+			if *best == nil || pricing.sellValue-pricing.cost > (*best).sellValue-(*best).cost {
+				*best = pricing
+			}
+		}
+	}
+
+	if !FilterCraft(&flip, conf) {
+		return CraftFoundFlip{}, false
+	}
+	return flip, true
+}
+
+// priceIngredients what a shopping list costs altogether, most expensive ingredient first. ok false if something on it
+// can't be bought anywhere we know of.
+func priceIngredients(amounts map[string]float64, products map[string]Product, bins map[string]float64, buyOrders bool) (float64, []Ingredient, bool) {
+	cost := 0.0
+	ingredients := make([]Ingredient, 0, len(amounts))
+	for id, amount := range amounts {
+		unit, source, ok := ingredientPrice(id, products, bins, buyOrders)
+		if !ok {
+			return 0, nil, false
+		}
+		total := unit * amount
+		cost += total
+		ingredients = append(ingredients, Ingredient{ItemID: id, Amount: amount, UnitPrice: unit, TotalPrice: total, Source: source})
+	}
+	// most expensive first, that's what people look at
+	sort.Slice(ingredients, func(i, j int) bool {
+		return ingredients[i].TotalPrice > ingredients[j].TotalPrice
+	})
+	return cost, ingredients, cost > 0
+}
+
+// usePricing sets the flip's numbers to its insta-buy or buy order pricing. false if it has no such pricing.
+func (f *CraftFoundFlip) usePricing(buyOrders bool) bool {
+	pricing := f.instaBuy
+	if buyOrders {
+		pricing = f.buyOrder
+	}
+	if pricing == nil {
+		return false
+	}
+	f.OutputCount, f.SellValue, f.CraftCost, f.Ingredients = pricing.outputCount, pricing.sellValue, pricing.cost, pricing.ingredients
+	f.Profit = int(pricing.sellValue - pricing.cost)
+	f.ProfitPercentage = (pricing.sellValue - pricing.cost) / pricing.cost * 100
+	return true
+}
+
+// outputValue what one unit of a crafted/forged item sells for after tax, where, and its moving week (bazaar only). Bazaar if
+// it's there (with a sell offer, same as bazaar flips), otherwise the AH if allowed.
+func outputValue(id string, products map[string]Product, bins map[string]float64, includeAuction bool, minMovingWeek int) (float64, string, int, bool) {
+	if product, ok := products[id]; ok {
+		movingWeek := product.QuickStatus.BuyMovingWeek
+		if movingWeek < minMovingWeek || product.QuickStatus.BuyPrice <= 0 {
+			return 0, "", 0, false
+		}
+		return product.QuickStatus.BuyPrice * (1 - BazaarTax/100.0), MarketBazaar, movingWeek, true
+	}
+	if bin, ok := bins[id]; ok && includeAuction && bin > 0 {
+		return bin * (1 - AuctionTax(bin)), MarketAuction, 0, true
+	}
+	return 0, "", 0, false
+}
+
+// ingredientPrice what one unit of an ingredient costs and where to get it.
+func ingredientPrice(id string, products map[string]Product, bins map[string]float64, buyOrders bool) (float64, string, bool) {
+	if product, ok := products[id]; ok {
+		price := product.QuickStatus.BuyPrice // insta-buy
+		if buyOrders {
+			price = product.QuickStatus.SellPrice
+		}
+		if price > 0 {
+			return price, MarketBazaar, true
+		}
+	}
+	if bin, ok := bins[id]; ok && bin > 0 {
+		return bin, MarketAuction, true
+	}
+	return 0, "", false
+}
+
+// AuctionTax fraction of a BIN sale the AH keeps: the listing fee (1% under 10M, 2% under 100M, 2.5% above) plus 1% when
+// claiming anything over 1M.
+func AuctionTax(price float64) float64 {
+	tax := 0.01
+	switch {
+	case price >= 100_000_000:
+		tax = 0.025
+	case price >= 10_000_000:
+		tax = 0.02
+	}
+	if price > 1_000_000 {
+		tax += 0.01
+	}
+	return tax
+}
+
+// FilterCraft whether a craft flip passes a user's config. The flip is repriced (in place) with the user's way of buying
+// ingredients first, so the cache can hold flips priced for everyone.
+func FilterCraft(flip *CraftFoundFlip, conf *config.CraftConfig) bool {
+	if !cachedRules(conf.ExcludeItems, nil, false).Allows(flip.ProductID) {
+		return false
+	}
+	if flip.Market == MarketAuction && !conf.IncludeAuction {
+		return false
+	}
+	if flip.Market == MarketBazaar && flip.OutputMovingWeek < conf.MinOutputMovingWeek {
+		return false
+	}
+	if !flip.usePricing(conf.BuyOrderIngredients) {
+		return false
+	}
+	if flip.Profit < conf.MinProfit {
+		return false
+	}
+	minPercentage := conf.MinProfitPercentage
+	if flip.Market == MarketAuction {
+		minPercentage = conf.MinAuctionProfitPercentage
+	}
+	return flip.ProfitPercentage >= float64(minPercentage)
+}
@@ -0,0 +1,129 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"testing"
+)
+
+func TestPriceIngredients(t *testing.T) {
+	products := map[string]Product{
+		"A":    {ProductID: "A", QuickStatus: QuickStatus{BuyPrice: 10, SellPrice: 8}},
+		"B":    {ProductID: "B", QuickStatus: QuickStatus{BuyPrice: 100, SellPrice: 90}},
+		"DEAD": {ProductID: "DEAD"},
+	}
+	bins := map[string]float64{"C": 500, "DEAD": 40}
+
+	tests := []struct {
+		name      string
+		amounts   map[string]float64
+		buyOrders bool
+		wantCost  float64
+		wantOrder []string // ingredients, most expensive first
+		wantFrom  string   // source of the first ingredient
+		wantOk    bool
+	}{
+		{"insta-buy", map[string]float64{"A": 4, "B": 1}, false, 140, []string{"B", "A"}, MarketBazaar, true},
+		{"buy orders", map[string]float64{"A": 4, "B": 1}, true, 122, []string{"B", "A"}, MarketBazaar, true},
+		{"most expensive in total comes first", map[string]float64{"A": 20, "B": 1}, false, 300, []string{"A", "B"}, MarketBazaar, true},
+		{"not on the bazaar comes from the AH", map[string]float64{"C": 2, "A": 1}, false, 1010, []string{"C", "A"}, MarketAuction, true},
+		{"no bazaar price falls back to the AH", map[string]float64{"DEAD": 1}, false, 40, []string{"DEAD"}, MarketAuction, true},
+		{"can't be bought anywhere", map[string]float64{"A": 1, "NOWHERE": 1}, false, 0, nil, "", false},
+		{"nothing to buy", map[string]float64{}, false, 0, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, ingredients, ok := priceIngredients(tt.amounts, products, bins, tt.buyOrders)
+			expect(t, "ok", ok, tt.wantOk)
+			if !ok {
+				return
+			}
+			near(t, "cost", cost, tt.wantCost)
+			if len(ingredients) != len(tt.wantOrder) {
+				t.Fatalf("ingredients = %+v, want %v", ingredients, tt.wantOrder)
+			}
+			total := 0.0
+			for i, ingredient := range ingredients {
+				expect(t, "ingredient", ingredient.ItemID, tt.wantOrder[i])
+				near(t, ingredient.ItemID+" total", ingredient.TotalPrice, ingredient.UnitPrice*ingredient.Amount)
+				total += ingredient.TotalPrice
+			}
+			near(t, "sum of the ingredients", total, cost)
+			expect(t, "source", ingredients[0].Source, tt.wantFrom)
+		})
+	}
+}
+
+func TestFilterCraft(t *testing.T) {
+	// sells for 200 a craft, costs 140 insta-bought or 122 with buy orders
+	newFlip := func(market string, movingWeek int, withBuyOrders bool) *CraftFoundFlip {
+		flip := &CraftFoundFlip{
+			ProductID:        "X",
+			Market:           market,
+			OutputMovingWeek: movingWeek,
+			instaBuy:         &craftPricing{outputCount: 1, sellValue: 200, cost: 140},
+		}
+		if withBuyOrders {
+			flip.buyOrder = &craftPricing{outputCount: 1, sellValue: 200, cost: 122}
+		}
+		return flip
+	}
+	conf := func(change func(c *config.CraftConfig)) *config.CraftConfig {
+		c := &config.CraftConfig{MinProfit: 50, MinProfitPercentage: 20, MinAuctionProfitPercentage: 50, MinOutputMovingWeek: 100}
+		change(c)
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		flip       *CraftFoundFlip
+		conf       *config.CraftConfig
+		want       bool
+		wantProfit int
+	}{
+		{"insta-buy", newFlip(MarketBazaar, 1000, true), conf(func(c *config.CraftConfig) {}), true, 60},
+		{"buy orders", newFlip(MarketBazaar, 1000, true), conf(func(c *config.CraftConfig) { c.BuyOrderIngredients = true }), true, 78},
+		{"no buy order pricing", newFlip(MarketBazaar, 1000, false), conf(func(c *config.CraftConfig) { c.BuyOrderIngredients = true }), false, 0},
+		{"excluded", newFlip(MarketBazaar, 1000, true), conf(func(c *config.CraftConfig) { c.ExcludeItems = []string{"X"} }), false, 0},
+		{"output barely sells", newFlip(MarketBazaar, 99, true), conf(func(c *config.CraftConfig) {}), false, 0},
+		{"not enough profit", newFlip(MarketBazaar, 1000, true), conf(func(c *config.CraftConfig) { c.MinProfit = 61 }), false, 60},
+		{"not enough margin", newFlip(MarketBazaar, 1000, true), conf(func(c *config.CraftConfig) { c.MinProfitPercentage = 43 }), false, 60},
+		{"no auction crafts", newFlip(MarketAuction, 0, true), conf(func(c *config.CraftConfig) {}), false, 0},
+		// 42.9% is enough on the bazaar but not on the AH
+		{"auction crafts need their own margin", newFlip(MarketAuction, 0, true), conf(func(c *config.CraftConfig) { c.IncludeAuction = true }), false, 60},
+		{"auction crafts", newFlip(MarketAuction, 0, true), conf(func(c *config.CraftConfig) {
+			c.IncludeAuction = true
+			c.MinAuctionProfitPercentage = 40
+		}), true, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, "FilterCraft()", FilterCraft(tt.flip, tt.conf), tt.want)
+			expect(t, "Profit", tt.flip.Profit, tt.wantProfit)
+		})
+	}
+
+	t.Run("repriced for every user", func(t *testing.T) {
+		flip := newFlip(MarketBazaar, 1000, true)
+		FilterCraft(flip, conf(func(c *config.CraftConfig) { c.BuyOrderIngredients = true }))
+		FilterCraft(flip, conf(func(c *config.CraftConfig) {}))
+		expect(t, "Profit", flip.Profit, 60)
+		near(t, "CraftCost", flip.CraftCost, 140)
+		near(t, "ProfitPercentage", flip.ProfitPercentage, 60.0/140*100)
+	})
+}
+
+func TestAuctionTax(t *testing.T) {
+	tests := []struct {
+		price float64
+		want  float64
+	}{
+		{1_000, 0.01},
+		{1_000_000, 0.01},
+		{1_000_001, 0.02},
+		{10_000_000, 0.03},
+		{100_000_000, 0.035},
+	}
+	for _, tt := range tests {
+		near(t, "AuctionTax()", AuctionTax(tt.price), tt.want)
+	}
+}
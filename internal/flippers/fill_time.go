@@ -0,0 +1,138 @@
+package flippers
+
+import (
+	"sync"
+	"time"
+)
+
+// hoursPerWeek moving week volumes are over 7 days
+const hoursPerWeek = 7 * 24
+
+// observedRateWeight how much the rates we saw between polls count against the moving week ones once we have them
+const observedRateWeight = 0.5
+
+// rateSmoothing EWMA factor for observed rates. polls are seconds apart so a single one is mostly noise
+const rateSmoothing = 0.2
+
+// maxObservationGap polls further apart than this (server was down, cache stopped) don't say anything about current activity
+const maxObservationGap = 10 * time.Minute
+
+// FillEstimate how long a flip takes to go through.
+type FillEstimate struct {
+	// BuyFillHours until our buy order is filled. insta-sells fill it, after everything queued at the top of sell_summary
+	BuyFillHours float64
+	// SellFillHours until our sell offer is filled. insta-buys fill it, after everything queued at the top of buy_summary
+	SellFillHours float64
+	// TotalHours both legs, one after the other (can't sell what we don't have yet)
+	TotalHours float64
+}
+
+type productActivity struct {
+	at             time.Time
+	sellMovingWeek int
+	buyMovingWeek  int
+	// observed units per hour, smoothed. -1 until we saw two polls in a row
+	instaSellRate float64
+	instaBuyRate  float64
+	// recent top of book, for Competition
+	recent []bookObservation
+}
+
+// SnapshotTracker remembers the previous poll of every product so fill estimates can use what actually traded since, not just
+// the weekly average (which can't see a product that just went dead or just blew up).
+type SnapshotTracker struct {
+	lock     sync.RWMutex
+	products map[string]*productActivity
+}
+
+func NewSnapshotTracker() *SnapshotTracker {
+	return &SnapshotTracker{products: make(map[string]*productActivity)}
+}
+
+// Observe feeds a poll in. Moving week volumes only ever go up by what traded since the last poll (minus whatever fell off the
+// end of the week, which is why negative deltas are ignored instead of trusted).
+func (t *SnapshotTracker) Observe(at time.Time, products map[string]Product) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for id, p := range products {
+		qs := p.QuickStatus
+		prev, ok := t.products[id]
+		if !ok {
+			t.products[id] = &productActivity{at: at, sellMovingWeek: qs.SellMovingWeek, buyMovingWeek: qs.BuyMovingWeek, instaSellRate: -1, instaBuyRate: -1,
+				recent: []bookObservation{observeBook(at, &p)}}
+			continue
+		}
+
+		elapsed := at.Sub(prev.at)
+		if elapsed <= 0 {
+			continue // same poll twice
+		}
+		prev.pushObservation(observeBook(at, &p))
+		if elapsed <= maxObservationGap {
+			hours := elapsed.Hours()
+			prev.instaSellRate = smoothRate(prev.instaSellRate, float64(max(qs.SellMovingWeek-prev.sellMovingWeek, 0))/hours)
+			prev.instaBuyRate = smoothRate(prev.instaBuyRate, float64(max(qs.BuyMovingWeek-prev.buyMovingWeek, 0))/hours)
+		}
+		prev.at, prev.sellMovingWeek, prev.buyMovingWeek = at, qs.SellMovingWeek, qs.BuyMovingWeek
+	}
+}
+
+// rates observed insta-sell/insta-buy units per hour. ok false if we haven't seen enough polls of the product.
+func (t *SnapshotTracker) rates(productId string) (instaSell float64, instaBuy float64, ok bool) {
+	if t == nil {
+		return 0, 0, false
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	a, found := t.products[productId]
+	if !found || a.instaSellRate < 0 {
+		return 0, 0, false
+	}
+	return a.instaSellRate, a.instaBuyRate, true
+}
+
+func smoothRate(prev float64, observed float64) float64 {
+	if prev < 0 {
+		return observed
+	}
+	return prev + rateSmoothing*(observed-prev)
+}
+
+// EstimateFill estimates how long flipping `volume` units takes. `tracker` can be nil, then only the moving week is used.
+// Zero hours means we have no idea (nothing traded at all), not instant.
+func EstimateFill(product *Product, volume int, tracker *SnapshotTracker) FillEstimate {
+	instaSellRate := float64(product.QuickStatus.SellMovingWeek) / hoursPerWeek
+	instaBuyRate := float64(product.QuickStatus.BuyMovingWeek) / hoursPerWeek
+	if observedSell, observedBuy, ok := tracker.rates(product.ProductID); ok {
+		instaSellRate = instaSellRate*(1-observedRateWeight) + observedSell*observedRateWeight
+		instaBuyRate = instaBuyRate*(1-observedRateWeight) + observedBuy*observedRateWeight
+	}
+
+	// we assume we match the top order instead of outbidding it, so whatever sits there goes first
+	buyQueue, sellQueue := 0, 0
+	if len(product.SellSummary) > 0 {
+		buyQueue = product.SellSummary[0].Amount
+	}
+	if len(product.BuySummary) > 0 {
+		sellQueue = product.BuySummary[0].Amount
+	}
+
+	var estimate FillEstimate
+	if instaSellRate <= 0 || instaBuyRate <= 0 {
+		return estimate
+	}
+	estimate.BuyFillHours = float64(buyQueue+volume) / instaSellRate
+	estimate.SellFillHours = float64(sellQueue+volume) / instaBuyRate
+	estimate.TotalHours = estimate.BuyFillHours + estimate.SellFillHours
+	return estimate
+}
+
+// ProfitPerHour spreads `profit` over the estimated time. 0 if we couldn't estimate the time.
+func (e FillEstimate) ProfitPerHour(profit int) float64 {
+	if e.TotalHours <= 0 {
+		return 0
+	}
+	return float64(profit) / e.TotalHours
+}
@@ -0,0 +1,79 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/expr"
+	"Hyflip-Server/internal/manipulation"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// maxCachedExpressions same idea as maxCachedRules
+const maxCachedExpressions = 1000
+
+var (
+	expressionsLock sync.Mutex
+	// nil = doesn't compile, so it isn't retried (and logged) for every flip
+	expressions = make(map[string]*expr.Program[BazaarFoundFlip])
+)
+
+// CompileFilterExpression compiles a BZConfig.FilterExpression. Errors are *expr.Error so they can point at the problem.
+func CompileFilterExpression(src string) (*expr.Program[BazaarFoundFlip], error) {
+	return expr.Compile[BazaarFoundFlip](src)
+}
+
+// ValidateBZConfig reports everything wrong with a config's rules and filter expression. Run this before saving a config.
+func ValidateBZConfig(conf *config.BZConfig) error {
+	var errs []error
+	if _, err := CompileRules(conf); err != nil {
+		errs = append(errs, err)
+	}
+	if conf.FilterExpression != "" {
+		if _, err := CompileFilterExpression(conf.FilterExpression); err != nil {
+			errs = append(errs, fmt.Errorf("filter_expression: %w", err))
+		}
+	}
+	if _, err := NewScorer(conf.Scorer, conf.ScorerWeights); err != nil {
+		errs = append(errs, fmt.Errorf("scorer: %w", err))
+	}
+	if err := manipulation.Validate(&conf.Manipulation); err != nil {
+		errs = append(errs, fmt.Errorf("manipulation: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// expressionFor the compiled filter expression, compiled the first time we see it. nil if it doesn't compile.
+func expressionFor(src string) *expr.Program[BazaarFoundFlip] {
+	expressionsLock.Lock()
+	defer expressionsLock.Unlock()
+	if program, ok := expressions[src]; ok {
+		return program
+	}
+
+	program, err := CompileFilterExpression(src)
+	if err != nil {
+		log.Println("Dropping every flip of an invalid filter expression. Error: " + err.Error())
+	}
+	if len(expressions) >= maxCachedExpressions {
+		expressions = make(map[string]*expr.Program[BazaarFoundFlip])
+	}
+	expressions[src] = program
+	return program
+}
+
+// matchesExpression whether a flip passes the config's filter expression. No expression lets everything through. A broken one
+// (saved before a field it uses went away) lets nothing through, same as a flip the expression can't decide on (division by
+// zero...). GET /api/config/bz tells the user what's wrong with it.
+func matchesExpression(flip *BazaarFoundFlip, conf *config.BZConfig) bool {
+	if conf.FilterExpression == "" {
+		return true
+	}
+	program := expressionFor(conf.FilterExpression)
+	if program == nil {
+		return false
+	}
+	ok, err := program.Eval(flip)
+	return err == nil && ok
+}
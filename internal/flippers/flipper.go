@@ -0,0 +1,107 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"context"
+)
+
+// Flipper is one kind of flip: T is the flip, C its section of the user config. A cache runs Flip with DefaultConfig every
+// cycle and every user gets the results through Filter with their own section.
+type Flipper[T any, C any] interface {
+	// Name short and lowercase, it ends up in logs and routes (/api/<name>flips)
+	Name() string
+	// Flip runs one cycle. the channel is closed when it's done
+	Flip(ctx context.Context, conf *C) (<-chan T, error)
+	// DefaultConfig what the shared cache computes with. has to be at least as lenient as any user's config, nil is fine if Flip says so
+	DefaultConfig() *C
+	// UserConfig the user's section of their config
+	UserConfig(conf *config.UserConfig) *C
+	// Filter whether a flip passes a user's config. may change the flip to fit the config (repricing, scoring...)
+	Filter(flip *T, conf *C) bool
+}
+
+// Ranker is optionally implemented by a Flipper whose flips have an order. The returned func scores a flip (storing the score
+// on it if it has one), higher is better.
+type Ranker[T any, C any] interface {
+	Ranker(conf *C) func(flip *T) float64
+}
+
+// bazaar flips
+
+func (f *BzFlipper) Name() string { return "bz" }
+
+func (f *BzFlipper) DefaultConfig() *config.BZConfig { return config.GenerateDefaultBZConfig() }
+
+func (f *BzFlipper) UserConfig(conf *config.UserConfig) *config.BZConfig { return &conf.BzConfig }
+
+func (f *BzFlipper) Filter(flip *BazaarFoundFlip, conf *config.BZConfig) bool {
+	return Filter(nil, flip, conf) != nil
+}
+
+func (f *BzFlipper) Ranker(conf *config.BZConfig) func(flip *BazaarFoundFlip) float64 {
+	scorer := ScorerFor(conf)
+	return func(flip *BazaarFoundFlip) float64 {
+		return ScoreFlip(flip, scorer)
+	}
+}
+
+// craft flips
+
+func (f *CraftFlipper) Name() string { return "craft" }
+
+// DefaultConfig no minimums and every market, FilterCraft reprices and filters per user
+func (f *CraftFlipper) DefaultConfig() *config.CraftConfig {
+	conf := config.GenerateDefaultCraftConfig()
+	conf.MinProfit, conf.MinProfitPercentage, conf.MinAuctionProfitPercentage = 0, 0, 0
+	conf.IncludeAuction, conf.MinOutputMovingWeek = true, 0
+	return conf
+}
+
+func (f *CraftFlipper) UserConfig(conf *config.UserConfig) *config.CraftConfig {
+	return &conf.CraftConfig
+}
+
+func (f *CraftFlipper) Filter(flip *CraftFoundFlip, conf *config.CraftConfig) bool {
+	return FilterCraft(flip, conf)
+}
+
+// npc flips
+
+func (f *NpcFlipper) Name() string { return "npc" }
+
+// DefaultConfig nil, see Flip. the NPC config changes the numbers of a flip so the cache keeps everything
+func (f *NpcFlipper) DefaultConfig() *config.NPCConfig { return nil }
+
+func (f *NpcFlipper) UserConfig(conf *config.UserConfig) *config.NPCConfig { return &conf.NpcConfig }
+
+func (f *NpcFlipper) Filter(flip *NpcFoundFlip, conf *config.NPCConfig) bool {
+	return FilterNpc(flip, conf)
+}
+
+func (f *NpcFlipper) Ranker(*config.NPCConfig) func(flip *NpcFoundFlip) float64 {
+	return func(flip *NpcFoundFlip) float64 { return float64(flip.DailyProfit) }
+}
+
+// forge flips
+
+func (f *ForgeFlipper) Name() string { return "forge" }
+
+// DefaultConfig no minimums and every market. Quick Forge and ingredient pricing change the numbers per user so FilterForge decides
+func (f *ForgeFlipper) DefaultConfig() *config.ForgeConfig {
+	conf := config.GenerateDefaultForgeConfig()
+	conf.MinProfit, conf.MinProfitPerHour = 0, 0
+	conf.IncludeAuction, conf.MinOutputMovingWeek = true, 0
+	return conf
+}
+
+func (f *ForgeFlipper) UserConfig(conf *config.UserConfig) *config.ForgeConfig {
+	return &conf.ForgeConfig
+}
+
+func (f *ForgeFlipper) Filter(flip *ForgeFoundFlip, conf *config.ForgeConfig) bool {
+	return FilterForge(flip, conf)
+}
+
+func (f *ForgeFlipper) Ranker(*config.ForgeConfig) func(flip *ForgeFoundFlip) float64 {
+	return func(flip *ForgeFoundFlip) float64 { return flip.ProfitPerHour }
+}
@@ -0,0 +1,176 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/recipes"
+	"context"
+	"errors"
+	"log"
+	"sort"
+)
+
+// MaxQuickForgeLevel the perk stops there
+const MaxQuickForgeLevel = 20
+
+type ForgeFoundFlip struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Command   string `json:"command"`
+	// Market where the output is sold. MarketBazaar or MarketAuction
+	Market      string `json:"market"`
+	OutputCount int    `json:"outputCount"`
+	// Cost ingredients plus the coins the forge charges
+	Cost             float64 `json:"cost"`
+	SellValue        float64 `json:"sellValue"`
+	Profit           int     `json:"profit"`
+	ProfitPercentage float64 `json:"profitPercentage"`
+	// ForgeHours how long one forge slot is busy, after Quick Forge
+	ForgeHours float64 `json:"forgeHours"`
+	// ProfitPerHour profit per forge slot hour, what forge flips are ranked by
+	ProfitPerHour   float64      `json:"profitPerHour"`
+	QuickForgeLevel int          `json:"quickForgeLevel"`
+	Ingredients     []Ingredient `json:"ingredients"`
+	// OutputMovingWeek insta-buys a week of the output. 0 for AH outputs
+	OutputMovingWeek int `json:"outputMovingWeek"`
+
+	baseHours float64
+	// the recipe with insta-bought and with buy ordered ingredients, FilterForge picks the user's. nil if the ingredients
+	// can't be bought that way
+	instaBuy *forgePricing
+	buyOrder *forgePricing
+}
+
+// forgePricing a forge recipe's cost, priced one way.
+type forgePricing struct {
+	cost        float64
+	ingredients []Ingredient
+}
+
+// ForgeFlipper prices the forge recipes we know.
+type ForgeFlipper struct {
+	Api     *api.HypixelApiClient
+	Recipes []recipes.ForgeRecipe
+	// Products latest bazaar products, usually BazaarCache.Products
+	Products func() map[string]Product
+}
+
+// Flip prices every forge recipe for conf. Ingredients and outputs are priced like craft flips.
+func (f *ForgeFlipper) Flip(ctx context.Context, conf *config.ForgeConfig) (<-chan ForgeFoundFlip, error) {
+	products := f.Products()
+	if products == nil {
+		return nil, errors.New("no bazaar data yet")
+	}
+
+	bins, err := api.GetLowestBinsCtx(ctx, f.Api)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Println("Could not load lowest BINs, only pricing forge items from the bazaar. Error: " + err.Error())
+	}
+
+	resultsChan := make(chan ForgeFoundFlip, 100)
+	go func() {
+		defer close(resultsChan)
+		for _, recipe := range f.Recipes {
+			if ctx.Err() != nil {
+				return
+			}
+			flip, ok := priceForge(recipe, products, bins, conf)
+			if !ok || !FilterForge(&flip, conf) {
+				continue
+			}
+			select {
+			case resultsChan <- flip:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultsChan, nil
+}
+
+// priceForge prices a recipe with both ways of buying the ingredients, FilterForge picks one per user.
+func priceForge(recipe recipes.ForgeRecipe, products map[string]Product, bins map[string]float64, conf *config.ForgeConfig) (ForgeFoundFlip, bool) {
+	value, market, movingWeek, ok := outputValue(recipe.Output, products, bins, conf.IncludeAuction, conf.MinOutputMovingWeek)
+	if !ok {
+		return ForgeFoundFlip{}, false
+	}
+	flip := ForgeFoundFlip{
+		ProductID:        recipe.Output,
+		Name:             recipe.Name,
+		Command:          "/viewrecipe " + recipe.Output,
+		Market:           market,
+		OutputCount:      recipe.Count,
+		SellValue:        value * float64(recipe.Count),
+		OutputMovingWeek: movingWeek,
+		baseHours:        recipe.Duration.Hours(),
+	}
+
+	if cost, ingredients, ok := priceIngredients(recipe.Ingredients, products, bins, false); ok {
+		flip.instaBuy = &forgePricing{cost: cost + recipe.Coins, ingredients: ingredients}
+	}
+	if cost, ingredients, ok := priceIngredients(recipe.Ingredients, products, bins, true); ok {
+		flip.buyOrder = &forgePricing{cost: cost + recipe.Coins, ingredients: ingredients}
+	}
+	return flip, flip.instaBuy != nil || flip.buyOrder != nil
+}
+
+// usePricing sets the flip's cost and profit to its insta-buy or buy order pricing. false if it has no such pricing.
+func (f *ForgeFoundFlip) usePricing(buyOrders bool) bool {
+	pricing := f.instaBuy
+	if buyOrders {
+		pricing = f.buyOrder
+	}
+	if pricing == nil {
+		return false
+	}
+	f.Cost, f.Ingredients = pricing.cost, pricing.ingredients
+	f.Profit = int(f.SellValue - f.Cost)
+	f.ProfitPercentage = (f.SellValue - f.Cost) / f.Cost * 100
+	return true
+}
+
+// QuickForgeReduction fraction of forge time the Quick Forge perk takes off: 10% + 0.5% per level, 30% at the max level.
+func QuickForgeReduction(level int) float64 {
+	switch {
+	case level <= 0:
+		return 0
+	case level >= MaxQuickForgeLevel:
+		return 0.3
+	}
+	return 0.1 + 0.005*float64(level)
+}
+
+// FilterForge applies the user's way of buying ingredients and Quick Forge level to the flip (in place) and tells whether it
+// passes their config.
+func FilterForge(flip *ForgeFoundFlip, conf *config.ForgeConfig) bool {
+	if !cachedRules(conf.ExcludeItems, nil, false).Allows(flip.ProductID) {
+		return false
+	}
+	if flip.Market == MarketAuction && !conf.IncludeAuction {
+		return false
+	}
+	if flip.Market == MarketBazaar && flip.OutputMovingWeek < conf.MinOutputMovingWeek {
+		return false
+	}
+	if !flip.usePricing(conf.BuyOrderIngredients) {
+		return false
+	}
+
+	flip.QuickForgeLevel = min(max(conf.QuickForgeLevel, 0), MaxQuickForgeLevel)
+	flip.ForgeHours = flip.baseHours * (1 - QuickForgeReduction(flip.QuickForgeLevel))
+	flip.ProfitPerHour = 0
+	if flip.ForgeHours > 0 {
+		flip.ProfitPerHour = float64(flip.Profit) / flip.ForgeHours
+	}
+	return flip.Profit >= conf.MinProfit && flip.ProfitPerHour >= float64(conf.MinProfitPerHour)
+}
+
+// RankForge best profit per forge slot hour first.
+func RankForge(flips []ForgeFoundFlip) {
+	sort.Slice(flips, func(i, j int) bool {
+		return flips[i].ProfitPerHour > flips[j].ProfitPerHour
+	})
+}
@@ -0,0 +1,109 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/recipes"
+	"testing"
+	"time"
+)
+
+func TestQuickForgeReduction(t *testing.T) {
+	tests := []struct {
+		level int
+		want  float64
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 0.105},
+		{10, 0.15},
+		{19, 0.195},
+		{20, 0.3},
+		{25, 0.3},
+	}
+	for _, tt := range tests {
+		near(t, "QuickForgeReduction()", QuickForgeReduction(tt.level), tt.want)
+	}
+}
+
+func TestFilterForge(t *testing.T) {
+	// sells for 1000 and takes 10 hours. costs 600 insta-bought or 500 with buy orders
+	newFlip := func(market string, movingWeek int, hours float64, withBuyOrders bool) *ForgeFoundFlip {
+		flip := &ForgeFoundFlip{
+			ProductID:        "X",
+			Market:           market,
+			SellValue:        1000,
+			OutputMovingWeek: movingWeek,
+			baseHours:        hours,
+			instaBuy:         &forgePricing{cost: 600},
+		}
+		if withBuyOrders {
+			flip.buyOrder = &forgePricing{cost: 500}
+		}
+		return flip
+	}
+	conf := func(change func(c *config.ForgeConfig)) *config.ForgeConfig {
+		c := &config.ForgeConfig{MinProfit: 100, MinProfitPerHour: 10, MinOutputMovingWeek: 10}
+		change(c)
+		return c
+	}
+
+	tests := []struct {
+		name        string
+		flip        *ForgeFoundFlip
+		conf        *config.ForgeConfig
+		want        bool
+		wantHours   float64
+		wantPerHour float64
+		wantLevel   int
+		wantProfit  int
+	}{
+		{"insta-buy", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) {}), true, 10, 40, 0, 400},
+		{"buy orders", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.BuyOrderIngredients = true }), true, 10, 50, 0, 500},
+		{"quick forge", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.QuickForgeLevel = 10 }), true, 8.5, 400 / 8.5, 10, 400},
+		{"quick forge is capped", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.QuickForgeLevel = 30 }), true, 7, 400.0 / 7, 20, 400},
+		{"no negative quick forge", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.QuickForgeLevel = -5 }), true, 10, 40, 0, 400},
+		{"too slow", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.MinProfitPerHour = 41 }), false, 10, 40, 0, 400},
+		{"quick forge makes it fast enough", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) {
+			c.MinProfitPerHour = 41
+			c.QuickForgeLevel = 20
+		}), true, 7, 400.0 / 7, 20, 400},
+		{"instant forge has no profit per hour", newFlip(MarketBazaar, 100, 0, true), conf(func(c *config.ForgeConfig) {}), false, 0, 0, 0, 400},
+		{"not enough profit", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.MinProfit = 401 }), false, 10, 40, 0, 400},
+		{"no buy order pricing", newFlip(MarketBazaar, 100, 10, false), conf(func(c *config.ForgeConfig) { c.BuyOrderIngredients = true }), false, 0, 0, 0, 0},
+		{"excluded", newFlip(MarketBazaar, 100, 10, true), conf(func(c *config.ForgeConfig) { c.ExcludeItems = []string{"X"} }), false, 0, 0, 0, 0},
+		{"output barely sells", newFlip(MarketBazaar, 9, 10, true), conf(func(c *config.ForgeConfig) {}), false, 0, 0, 0, 0},
+		{"no auction outputs", newFlip(MarketAuction, 0, 10, true), conf(func(c *config.ForgeConfig) {}), false, 0, 0, 0, 0},
+		{"auction outputs", newFlip(MarketAuction, 0, 10, true), conf(func(c *config.ForgeConfig) { c.IncludeAuction = true }), true, 10, 40, 0, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, "FilterForge()", FilterForge(tt.flip, tt.conf), tt.want)
+			expect(t, "Profit", tt.flip.Profit, tt.wantProfit)
+			expect(t, "QuickForgeLevel", tt.flip.QuickForgeLevel, tt.wantLevel)
+			near(t, "ForgeHours", tt.flip.ForgeHours, tt.wantHours)
+			near(t, "ProfitPerHour", tt.flip.ProfitPerHour, tt.wantPerHour)
+		})
+	}
+}
+
+func TestPriceForge(t *testing.T) {
+	products := map[string]Product{
+		"GEM":    {ProductID: "GEM", QuickStatus: QuickStatus{BuyPrice: 100, SellPrice: 80}},
+		"OUTPUT": {ProductID: "OUTPUT", QuickStatus: QuickStatus{BuyPrice: 10_000, BuyMovingWeek: 500}},
+	}
+	recipe := recipes.ForgeRecipe{Output: "OUTPUT", Count: 2, Duration: 4 * time.Hour, Ingredients: map[string]float64{"GEM": 3}, Coins: 1000}
+
+	flip, ok := priceForge(recipe, products, nil, &config.ForgeConfig{})
+	if !ok {
+		t.Fatal("priceForge() not ok")
+	}
+	near(t, "SellValue", flip.SellValue, 2*10_000*(1-BazaarTax/100))
+	// the forge's coins are part of the cost either way
+	near(t, "insta-buy cost", flip.instaBuy.cost, 1300)
+	near(t, "buy order cost", flip.buyOrder.cost, 1240)
+	near(t, "baseHours", flip.baseHours, 4)
+
+	if _, ok := priceForge(recipes.ForgeRecipe{Output: "OUTPUT", Count: 1, Ingredients: map[string]float64{"NOWHERE": 1}}, products, nil, &config.ForgeConfig{}); ok {
+		t.Error("priceForge() ok with an ingredient that can't be bought")
+	}
+}
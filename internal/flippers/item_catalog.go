@@ -0,0 +1,60 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// itemsRefresh the item catalog barely ever changes, no point asking more often
+const itemsRefresh = time.Hour
+
+// ItemCatalog the skyblock item catalog (names, NPC sell prices), loaded lazily and refreshed every itemsRefresh.
+type ItemCatalog struct {
+	api *api.HypixelApiClient
+
+	mu     sync.Mutex
+	items  map[string]api.SkyblockItem
+	loaded time.Time
+}
+
+func NewItemCatalog(apiClient *api.HypixelApiClient) *ItemCatalog {
+	return &ItemCatalog{api: apiClient}
+}
+
+// Get the catalog by item id. A failed refresh keeps using the old one if there is one.
+func (c *ItemCatalog) Get(ctx context.Context) (map[string]api.SkyblockItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items != nil && time.Since(c.loaded) < itemsRefresh {
+		return c.items, nil
+	}
+
+	items, err := api.GetItemsCtx(ctx, c.api)
+	if err != nil {
+		if c.items != nil {
+			log.Println("Could not refresh the item catalog, using the old one. Error: " + err.Error())
+			return c.items, nil
+		}
+		return nil, err
+	}
+	c.items, c.loaded = items, time.Now()
+	return items, nil
+}
+
+// NpcPrices NPC sell price by item id, only the items NPCs actually buy.
+func (c *ItemCatalog) NpcPrices(ctx context.Context) (map[string]float64, error) {
+	items, err := c.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prices := make(map[string]float64, len(items))
+	for id, item := range items {
+		if item.NpcSellPrice > 0 {
+			prices[id] = item.NpcSellPrice
+		}
+	}
+	return prices, nil
+}
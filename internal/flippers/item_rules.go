@@ -0,0 +1,204 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CategoriesFile maps bazaar categories to the patterns of their products. Hypixel doesn't send categories with the bazaar
+// so we keep our own list. Plain entries there are whole ids (COAL is coal, not ENCHANTED_CHARCOAL), globs and regexes work
+// like they do in configs.
+const CategoriesFile = "data/bazaar_categories.json"
+
+// maxCachedRules compiled rule sets kept around. one per distinct config, so this is only hit if someone's spamming configs
+const maxCachedRules = 1000
+
+// ItemRules are the compiled include/exclude lists of a BZConfig. Patterns:
+//   - `re:<regex>` matches if the regex matches anywhere in the product id
+//   - `cat:<category>` matches every product of a category in CategoriesFile
+//   - anything with *, ? or [ is a glob over the whole id
+//   - anything else matches if the id contains it, e.g. "COBBLE" for COBBLESTONE, ENCHANTED_COBBLESTONE...
+//
+// Everything is case-insensitive. Excluded products are dropped unless an include rule matches them too, so includes work as
+// exceptions. With AllowlistOnly only included products pass at all.
+type ItemRules struct {
+	exclude       []itemMatcher
+	include       []itemMatcher
+	allowlistOnly bool
+}
+
+type itemMatcher func(id string) bool
+
+var (
+	categoriesOnce sync.Once
+	categories     map[string][]itemMatcher
+
+	rulesLock   sync.Mutex
+	rulesByConf = make(map[string]*ItemRules)
+)
+
+// CompileRules compiles the include/exclude lists of a config. Rules that don't compile are left out and reported in the
+// error (every one of them, not just the first) so a config can be validated before it's saved.
+func CompileRules(conf *config.BZConfig) (*ItemRules, error) {
+	return compileItemRules(conf.ExcludeItems, conf.IncludeItems, conf.AllowlistOnly)
+}
+
+func compileItemRules(exclude []string, include []string, allowlistOnly bool) (*ItemRules, error) {
+	var errs []error
+	rules := &ItemRules{allowlistOnly: allowlistOnly}
+	rules.exclude = compilePatterns(exclude, "exclude_items", false, &errs)
+	rules.include = compilePatterns(include, "include_items", false, &errs)
+	return rules, errors.Join(errs...)
+}
+
+// Allows whether a product passes the rules.
+func (r *ItemRules) Allows(productId string) bool {
+	id := strings.ToUpper(productId)
+	if matchesAny(r.include, id) {
+		return true
+	}
+	if r.allowlistOnly {
+		return false
+	}
+	return !matchesAny(r.exclude, id)
+}
+
+func matchesAny(matchers []itemMatcher, id string) bool {
+	for _, m := range matchers {
+		if m(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles a list, collecting what doesn't compile in errs. inCategory for the entries of CategoriesFile.
+func compilePatterns(patterns []string, field string, inCategory bool, errs *[]error) []itemMatcher {
+	matchers := make([]itemMatcher, 0, len(patterns))
+	for i, pattern := range patterns {
+		m, err := compilePattern(pattern, inCategory)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("%s[%d] %s: %w", field, i, strconv.Quote(pattern), err))
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+func compilePattern(pattern string, inCategory bool) (itemMatcher, error) {
+	switch {
+	case strings.HasPrefix(pattern, "re:"):
+		// (?i) instead of uppercasing so things like \w don't get mangled
+		re, err := regexp.Compile("(?i)" + strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+
+	case strings.HasPrefix(pattern, "cat:"):
+		if inCategory {
+			return nil, errors.New("categories can't contain other categories")
+		}
+		name := strings.ToUpper(strings.TrimPrefix(pattern, "cat:"))
+		members, ok := loadCategories()[name]
+		if !ok {
+			return nil, errors.New("unknown category")
+		}
+		return func(id string) bool { return matchesAny(members, id) }, nil
+
+	case strings.ContainsAny(pattern, "*?["):
+		glob := strings.ToUpper(pattern)
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, err
+		}
+		return func(id string) bool {
+			ok, _ := path.Match(glob, id)
+			return ok
+		}, nil
+
+	case pattern == "":
+		return nil, errors.New("empty pattern")
+
+	case inCategory:
+		// categories list actual products. a substring would have INK_SACK claim INK_SACK:3 (cocoa) and COAL claim charcoal
+		exact := strings.ToUpper(pattern)
+		return func(id string) bool { return id == exact }, nil
+
+	default:
+		sub := strings.ToUpper(pattern)
+		return func(id string) bool { return strings.Contains(id, sub) }, nil
+	}
+}
+
+// loadCategories reads CategoriesFile once. A missing or broken file only means `cat:` rules won't compile.
+func loadCategories() map[string][]itemMatcher {
+	categoriesOnce.Do(func() {
+		data, err := os.ReadFile(CategoriesFile)
+		if err != nil {
+			log.Println("Could not read bazaar categories. Error: " + err.Error())
+			categories = make(map[string][]itemMatcher)
+			return
+		}
+		categories = parseCategories(data)
+	})
+	return categories
+}
+
+// parseCategories compiles the contents of CategoriesFile. Broken entries are logged and left out.
+func parseCategories(data []byte) map[string][]itemMatcher {
+	parsed := make(map[string][]itemMatcher)
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		log.Println("Could not parse bazaar categories. Error: " + err.Error())
+		return parsed
+	}
+	for name, patterns := range raw {
+		var errs []error
+		parsed[strings.ToUpper(name)] = compilePatterns(patterns, name, true, &errs)
+		if err := errors.Join(errs...); err != nil {
+			log.Println("Broken patterns in bazaar category " + name + ". Error: " + err.Error())
+		}
+	}
+	return parsed
+}
+
+// rulesFor returns the compiled rules of a config, compiling them only the first time we see those lists.
+func rulesFor(conf *config.BZConfig) *ItemRules {
+	return cachedRules(conf.ExcludeItems, conf.IncludeItems, conf.AllowlistOnly)
+}
+
+// ExcludeRules cached rules for a plain exclude list, for the flip types that only have that.
+func ExcludeRules(exclude []string) *ItemRules {
+	return cachedRules(exclude, nil, false)
+}
+
+func cachedRules(exclude []string, include []string, allowlistOnly bool) *ItemRules {
+	key := strconv.FormatBool(allowlistOnly) + "\x00" + strings.Join(exclude, "\x00") + "\x01" + strings.Join(include, "\x00")
+
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+	if rules, ok := rulesByConf[key]; ok {
+		return rules
+	}
+
+	rules, err := compileItemRules(exclude, include, allowlistOnly)
+	if err != nil {
+		// the broken rules just don't apply. only logged once per config since it's cached after this
+		log.Println("Ignoring invalid item rules. Error: " + err.Error())
+	}
+	if len(rulesByConf) >= maxCachedRules {
+		rulesByConf = make(map[string]*ItemRules)
+	}
+	rulesByConf[key] = rules
+	return rules
+}
@@ -0,0 +1,165 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"os"
+	"strings"
+	"testing"
+)
+
+// the real CategoriesFile, whichever test happens to load the categories first. it's relative to the repo root
+func init() {
+	categoriesOnce.Do(func() {
+		data, err := os.ReadFile("../../" + CategoriesFile)
+		if err != nil {
+			panic(err)
+		}
+		categories = parseCategories(data)
+	})
+}
+
+func TestItemRules(t *testing.T) {
+	tests := []struct {
+		name          string
+		exclude       []string
+		include       []string
+		allowlistOnly bool
+		allowed       []string
+		dropped       []string
+	}{
+		{"no rules", nil, nil, false, []string{"COBBLESTONE", "ENCHANTED_DIAMOND"}, nil},
+		{"plain patterns match anywhere in the id", []string{"cobble"}, nil, false,
+			[]string{"DIAMOND"}, []string{"COBBLESTONE", "ENCHANTED_COBBLESTONE"}},
+		{"globs match the whole id", []string{"ENCHANTED_*"}, nil, false,
+			[]string{"DIAMOND", "SUPER_ENCHANTED_EGG"}, []string{"ENCHANTED_DIAMOND", "enchanted_coal"}},
+		{"? and [] are globs too", []string{"INK_SACK:?", "[AB]_THING"}, nil, false,
+			[]string{"INK_SACK", "C_THING"}, []string{"INK_SACK:3", "A_THING", "B_THING"}},
+		{"regexes match anywhere and ignore case", []string{`re:^enchanted_\w+_block$`}, nil, false,
+			[]string{"ENCHANTED_DIAMOND", "BLOCK"}, []string{"ENCHANTED_DIAMOND_BLOCK", "ENCHANTED_IRON_BLOCK"}},
+		{"includes are exceptions to excludes", []string{"ENCHANTED_*"}, []string{"ENCHANTED_DIAMOND"}, false,
+			[]string{"ENCHANTED_DIAMOND", "ENCHANTED_DIAMOND_BLOCK", "COAL"}, []string{"ENCHANTED_COAL"}},
+		{"allowlist only lets includes through", nil, []string{"DIAMOND"}, true,
+			[]string{"DIAMOND", "ENCHANTED_DIAMOND"}, []string{"COAL"}},
+		{"allowlist ignores excludes", []string{"DIAMOND"}, []string{"ENCHANTED_*"}, true,
+			[]string{"ENCHANTED_DIAMOND"}, []string{"DIAMOND", "COAL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := CompileRules(&config.BZConfig{ExcludeItems: tt.exclude, IncludeItems: tt.include, AllowlistOnly: tt.allowlistOnly})
+			if err != nil {
+				t.Fatalf("CompileRules() err = %v", err)
+			}
+			for _, id := range tt.allowed {
+				expect(t, "Allows("+id+")", rules.Allows(id), true)
+			}
+			for _, id := range tt.dropped {
+				expect(t, "Allows("+id+")", rules.Allows(id), false)
+			}
+		})
+	}
+}
+
+func TestItemRulesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		include []string
+		want    []string // in the error
+		dropped string   // still dropped by the rules that did compile
+	}{
+		{"broken regex", []string{"re:(", "COAL"}, nil, []string{`exclude_items[0] "re:("`}, "COAL"},
+		{"broken glob", []string{"[", "COAL"}, nil, []string{`exclude_items[0] "["`}, "COAL"},
+		{"empty pattern", []string{"", "COAL"}, nil, []string{`exclude_items[0] ""`, "empty pattern"}, "COAL"},
+		{"unknown category", []string{"COAL"}, []string{"cat:NOT_A_CATEGORY"}, []string{`include_items[0] "cat:NOT_A_CATEGORY"`, "unknown category"}, "COAL"},
+		{"every broken rule is reported", []string{"re:(", "COAL", "["}, []string{""}, []string{"exclude_items[0]", "exclude_items[2]", "include_items[0]"}, "COAL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileItemRules(tt.exclude, tt.include, false)
+			if err == nil {
+				t.Fatal("compileItemRules() err = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("compileItemRules() err = %q, want it to mention %q", err, want)
+				}
+			}
+			expect(t, "Allows("+tt.dropped+")", rules.Allows(tt.dropped), false)
+		})
+	}
+}
+
+func TestCachedRules(t *testing.T) {
+	a := &config.BZConfig{ExcludeItems: []string{"COAL"}}
+	b := &config.BZConfig{ExcludeItems: []string{"COAL"}}
+	if rulesFor(a) != rulesFor(b) {
+		t.Error("rulesFor() compiled the same lists twice")
+	}
+	// the lists are joined for the key, so moving an entry across them is a different config
+	if ExcludeRules([]string{"A", "B"}) == cachedRules([]string{"A"}, []string{"B"}, false) {
+		t.Error("cachedRules() mixed up exclude and include lists")
+	}
+	if cachedRules(nil, []string{"A"}, true) == cachedRules(nil, []string{"A"}, false) {
+		t.Error("cachedRules() ignored AllowlistOnly")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	tests := []struct {
+		category string
+		id       string
+		want     bool
+	}{
+		{"MINING", "COAL", true},
+		{"MINING", "ENCHANTED_COAL", true},
+		{"MINING", "ENCHANTED_CHARCOAL", false},
+		{"MINING", "ICE", true},
+		{"MINING", "PACKED_ICE", true},
+		{"MINING", "SAND:1", true},
+		{"MINING", "INK_SACK:4", true},
+		{"MINING", "SULPHUR", false},
+		{"MINING", "ENCHANTED_GOLDEN_CARROT", false},
+		{"FARMING", "ENCHANTED_GOLDEN_CARROT", true},
+		{"FARMING", "INK_SACK:3", true},
+		{"FARMING", "EGG", true},
+		{"WOODS_AND_FISHES", "INK_SACK", true},
+		{"WOODS_AND_FISHES", "INK_SACK:3", false},
+		{"WOODS_AND_FISHES", "ENCHANTED_INK_SACK", true},
+		{"COMBAT", "SULPHUR", true},
+		{"COMBAT", "BONE", true},
+		{"COMBAT", "ENCHANTED_BONE_BLOCK", true},
+		{"ODDITIES", "ENCHANTMENT_SHARPNESS_5", false},
+		{"ENCHANTMENTS", "ENCHANTMENT_SHARPNESS_5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.category+"/"+tt.id, func(t *testing.T) {
+			rules, err := compileItemRules(nil, []string{"cat:" + tt.category}, true)
+			if err != nil {
+				t.Fatalf("compileItemRules() err = %v", err)
+			}
+			expect(t, "Allows()", rules.Allows(tt.id), tt.want)
+		})
+	}
+
+	t.Run("every product has one category at most", func(t *testing.T) {
+		ids := []string{"COAL", "ENCHANTED_COAL", "ENCHANTED_CHARCOAL", "INK_SACK", "INK_SACK:3", "INK_SACK:4", "SULPHUR", "ENCHANTED_GUNPOWDER",
+			"ICE", "ENCHANTED_ICE", "EGG", "ENCHANTED_EGG", "BONE", "SAND", "ENCHANTED_GOLDEN_CARROT", "ENCHANTED_GOLD", "HOT_POTATO_BOOK",
+			"ENCHANTMENT_SHARPNESS_5", "ESSENCE_WITHER", "SHARD_ZEALOT", "ENCHANTED_SLIME_BALL", "ENCHANTED_CLAY_BALL"}
+		for _, id := range ids {
+			var in []string
+			for name, members := range categories {
+				if matchesAny(members, id) {
+					in = append(in, name)
+				}
+			}
+			if len(in) > 1 {
+				t.Errorf("%s is in %v", id, in)
+			}
+		}
+	})
+
+	t.Run("categories can't contain categories", func(t *testing.T) {
+		parsed := parseCategories([]byte(`{"A": ["COAL", "cat:B"], "B": ["DIAMOND"]}`))
+		expect(t, "len(A)", len(parsed["A"]), 1)
+	})
+}
@@ -0,0 +1,62 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/manipulation"
+	"context"
+	"time"
+)
+
+// Rejection a product the default thresholds call manipulated. Users with laxer thresholds can still get it as a flip.
+type Rejection struct {
+	ProductID    string                    `json:"productId"`
+	At           time.Time                 `json:"at"`
+	SellPrice    float64                   `json:"sellPrice"`
+	BuyPrice     float64                   `json:"buyPrice"`
+	Measurements manipulation.Measurements `json:"measurements"`
+	Verdict      manipulation.Verdict      `json:"verdict"`
+}
+
+// evidenceOf a product, minus the price history (that's fetched by the workers).
+func evidenceOf(product *Product) manipulation.Evidence {
+	qs := product.QuickStatus
+	return manipulation.Evidence{
+		Window:         PriceHistoryTimeSpan,
+		SellPrice:      qs.SellPrice,
+		BuyPrice:       qs.BuyPrice,
+		SellVolume:     qs.SellVolume,
+		BuyVolume:      qs.BuyVolume,
+		SellMovingWeek: qs.SellMovingWeek,
+		BuyMovingWeek:  qs.BuyMovingWeek,
+		BuyOrders:      levelsOf(product.SellSummary),
+		SellOffers:     levelsOf(product.BuySummary),
+	}
+}
+
+func levelsOf(summary []OrderSummary) []manipulation.Level {
+	levels := make([]manipulation.Level, len(summary))
+	for i, s := range summary {
+		levels[i] = manipulation.Level{Price: s.PricePerUnit, Amount: s.Amount, Orders: s.Orders}
+	}
+	return levels
+}
+
+// measure fetches the product's price history and runs every detector's measurements on it.
+func measure(ctx context.Context, cl *api.HypixelApiClient, evidence manipulation.Evidence, productId string) (manipulation.Measurements, error) {
+	points, err := api.GetPriceHistoryCtx(ctx, cl, productId, evidence.Window)
+	if err != nil {
+		return manipulation.Measurements{}, err
+	}
+	evidence.History = make([]float64, len(points))
+	for i, point := range points {
+		evidence.History[i] = point.Sell
+	}
+	return manipulation.Measure(&evidence), nil
+}
+
+// JudgeFlip the user's verdict on a flip, stored on it too.
+func JudgeFlip(flip *BazaarFoundFlip, conf *config.BZConfig) manipulation.Verdict {
+	flip.ManipulationVerdict = manipulation.Judge(&flip.Manipulation, &conf.Manipulation)
+	return flip.ManipulationVerdict
+}
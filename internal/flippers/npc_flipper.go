@@ -0,0 +1,144 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/config"
+	"context"
+	"errors"
+	"math"
+)
+
+type NpcFoundFlip struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Command   string `json:"command"`
+	// BuyPrice per item, insta-buy or buy order depending on the config
+	BuyPrice         float64 `json:"buyPrice"`
+	NpcSellPrice     float64 `json:"npcSellPrice"`
+	ProfitPerItem    float64 `json:"profitPerItem"`
+	ProfitPercentage float64 `json:"profitPercentage"`
+	// DailyVolume how many you can flip a day: whatever runs out first of the daily NPC cap and the bazaar supply
+	DailyVolume int `json:"dailyVolume"`
+	DailyProfit int `json:"dailyProfit"`
+	// CapLimited true when the daily NPC cap, not the bazaar, is what limits DailyVolume
+	CapLimited bool `json:"capLimited"`
+	BuyOrder   bool `json:"buyOrder"`
+
+	// both ways of buying, so one cached flip can be priced for any config (see priceNpc)
+	instaBuyPrice  float64
+	instaBuySupply int
+	orderPrice     float64
+	orderSupply    int
+}
+
+// NpcFlipper finds bazaar items that an NPC pays more for than they cost.
+type NpcFlipper struct {
+	Items *ItemCatalog
+	// Products latest bazaar products, usually BazaarCache.Products
+	Products func() map[string]Product
+}
+
+// Flip checks every bazaar product against its NPC sell price. Flips are priced for conf, but keep what FilterNpc needs to
+// reprice them for another config. A nil conf keeps everything that's profitable either way of buying (insta-buy, no cap).
+func (f *NpcFlipper) Flip(ctx context.Context, conf *config.NPCConfig) (<-chan NpcFoundFlip, error) {
+	products := f.Products()
+	if products == nil {
+		return nil, errors.New("no bazaar data yet")
+	}
+	items, err := f.Items.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsChan := make(chan NpcFoundFlip, 200)
+	go func() {
+		defer close(resultsChan)
+		for id, product := range products {
+			if ctx.Err() != nil {
+				return
+			}
+			item, ok := items[id]
+			if !ok || item.NpcSellPrice <= 0 {
+				continue
+			}
+			flip := newNpcFlip(product, item)
+			if conf == nil {
+				if !flip.profitable() {
+					continue
+				}
+				priceNpc(&flip, &config.NPCConfig{})
+			} else if !FilterNpc(&flip, conf) {
+				continue
+			}
+			select {
+			case resultsChan <- flip:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultsChan, nil
+}
+
+func newNpcFlip(product Product, item api.SkyblockItem) NpcFoundFlip {
+	qs := product.QuickStatus
+	return NpcFoundFlip{
+		ProductID:    product.ProductID,
+		Name:         item.Name,
+		Command:      "/bz " + item.Name,
+		NpcSellPrice: item.NpcSellPrice,
+		// insta-buying is limited by the sell offers up right now, buy orders by how much gets insta-sold a day
+		instaBuyPrice:  qs.BuyPrice,
+		instaBuySupply: qs.BuyVolume,
+		orderPrice:     qs.SellPrice,
+		orderSupply:    qs.SellMovingWeek / 7,
+	}
+}
+
+// profitable with either way of buying
+func (f *NpcFoundFlip) profitable() bool {
+	instaBuy := f.instaBuyPrice > 0 && f.instaBuyPrice < f.NpcSellPrice && f.instaBuySupply > 0
+	order := f.orderPrice > 0 && f.orderPrice < f.NpcSellPrice && f.orderSupply > 0
+	return instaBuy || order
+}
+
+// priceNpc fills in the numbers of a flip for a config: how it's bought and how much of it fits under the daily NPC cap.
+func priceNpc(flip *NpcFoundFlip, conf *config.NPCConfig) {
+	flip.BuyOrder = conf.BuyOrders
+	supply := flip.instaBuySupply
+	flip.BuyPrice = flip.instaBuyPrice
+	if conf.BuyOrders {
+		supply = flip.orderSupply
+		flip.BuyPrice = flip.orderPrice
+	}
+
+	flip.ProfitPerItem = flip.NpcSellPrice - flip.BuyPrice
+	flip.ProfitPercentage = 0
+	if flip.BuyPrice > 0 {
+		flip.ProfitPercentage = flip.ProfitPerItem / flip.BuyPrice * 100
+	}
+
+	flip.DailyVolume, flip.CapLimited = supply, false
+	if conf.DailySellCap > 0 {
+		capVolume := int(math.Floor(float64(conf.DailySellCap) / flip.NpcSellPrice))
+		if capVolume < supply {
+			flip.DailyVolume, flip.CapLimited = capVolume, true
+		}
+	}
+	flip.DailyProfit = int(float64(flip.DailyVolume) * flip.ProfitPerItem)
+}
+
+// FilterNpc reprices the flip for a user's config (in place) and tells whether it passes.
+func FilterNpc(flip *NpcFoundFlip, conf *config.NPCConfig) bool {
+	if !cachedRules(conf.ExcludeItems, nil, false).Allows(flip.ProductID) {
+		return false
+	}
+	priceNpc(flip, conf)
+	if flip.BuyPrice <= 0 || flip.ProfitPerItem <= 0 || flip.DailyVolume <= 0 {
+		return false
+	}
+	if flip.ProfitPerItem < conf.MinProfitPerItem || flip.ProfitPercentage < float64(conf.MinProfitPercentage) {
+		return false
+	}
+	return flip.DailyProfit >= conf.MinDailyProfit
+}
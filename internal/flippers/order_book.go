@@ -0,0 +1,95 @@
+package flippers
+
+import "Hyflip-Server/internal/config"
+
+// DepthWindowPercentage is the X in "how many units before the price moves by X%" (BuyDepth/SellDepth).
+const DepthWindowPercentage = 5
+
+// BookStats is what the order books say about flipping `volume` units of a product.
+//
+// we buy with a buy order (competing with sell_summary, highest first) and sell with a sell offer (competing with buy_summary,
+// lowest first). Our orders sit at the front, but moving `volume` units takes as long as the book needs to clear that much,
+// so we assume we have to price as far into the book as that volume reaches: the fill is the top price mirrored by however much
+// the volume-weighted price of the book moved over those units. Crude, but it scales with depth which is the whole point.
+type BookStats struct {
+	// BuyDepth units in sell_summary before the price drops more than DepthWindowPercentage below the top
+	BuyDepth int
+	// SellDepth units in buy_summary before the price rises more than DepthWindowPercentage above the top
+	SellDepth int
+	// BuyFillPrice what buying `volume` units costs on average
+	BuyFillPrice float64
+	// SellFillPrice what selling `volume` units makes on average
+	SellFillPrice float64
+	// SlippagePercentage how much worse the fills are than the top of the book, relative to the buy price
+	SlippagePercentage float64
+	// AdjustedProfit taxed profit of the whole volume at the fill prices
+	AdjustedProfit int
+}
+
+// AnalyzeBook computes BookStats for flipping `volume` units. Falls back to quick_status prices if a side of the book is empty.
+func AnalyzeBook(product *Product, volume int) BookStats {
+	buyTop, sellTop := product.QuickStatus.SellPrice, product.QuickStatus.BuyPrice
+	if len(product.SellSummary) > 0 {
+		buyTop = product.SellSummary[0].PricePerUnit
+	}
+	if len(product.BuySummary) > 0 {
+		sellTop = product.BuySummary[0].PricePerUnit
+	}
+
+	stats := BookStats{
+		BuyDepth:  depthWithin(product.SellSummary, buyTop, -DepthWindowPercentage),
+		SellDepth: depthWithin(product.BuySummary, sellTop, DepthWindowPercentage),
+	}
+
+	// sell_summary goes down from the top so the vwap is <= top, and we pay the difference on top of it. buy_summary the opposite
+	stats.BuyFillPrice = buyTop + (buyTop - vwap(product.SellSummary, volume, buyTop))
+	stats.SellFillPrice = sellTop - (vwap(product.BuySummary, volume, sellTop) - sellTop)
+
+	if buyTop > 0 {
+		stats.SlippagePercentage = ((stats.BuyFillPrice - buyTop) + (sellTop - stats.SellFillPrice)) / buyTop * 100
+	}
+	taxFactor := 1 - BazaarTax/100.0
+	stats.AdjustedProfit = int((stats.SellFillPrice*taxFactor - stats.BuyFillPrice) * float64(volume))
+	return stats
+}
+
+// depthWithin sums the units of the levels within `percentage` of `top` (negative = below it).
+func depthWithin(levels []OrderSummary, top float64, percentage float64) int {
+	limit := top * (1 + percentage/100)
+	depth := 0
+	for _, level := range levels {
+		if (percentage < 0 && level.PricePerUnit < limit) || (percentage > 0 && level.PricePerUnit > limit) {
+			break
+		}
+		depth += level.Amount
+	}
+	return depth
+}
+
+// vwap is the volume-weighted price of the first `volume` units of the book. Hypixel only sends the top levels, so whatever
+// doesn't fit is assumed to go at the last level we know of. `fallback` if there's no book at all.
+func vwap(levels []OrderSummary, volume int, fallback float64) float64 {
+	if len(levels) == 0 || volume <= 0 {
+		return fallback
+	}
+
+	remaining := volume
+	cost := 0.0
+	for _, level := range levels {
+		take := min(level.Amount, remaining)
+		cost += float64(take) * level.PricePerUnit
+		remaining -= take
+		if remaining == 0 {
+			break
+		}
+	}
+	if remaining > 0 {
+		cost += float64(remaining) * levels[len(levels)-1].PricePerUnit
+	}
+	return cost / float64(volume)
+}
+
+// exceedsSlippage whether the config's max slippage rules the flip out. 0 = no limit.
+func exceedsSlippage(slippagePercentage float64, conf *config.BZConfig) bool {
+	return conf.MaxSlippagePercentage > 0 && slippagePercentage > conf.MaxSlippagePercentage
+}
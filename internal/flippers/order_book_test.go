@@ -0,0 +1,128 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"math"
+	"testing"
+)
+
+func levels(amountsAndPrices ...float64) []OrderSummary {
+	summary := make([]OrderSummary, 0, len(amountsAndPrices)/2)
+	for i := 0; i+1 < len(amountsAndPrices); i += 2 {
+		summary = append(summary, OrderSummary{Amount: int(amountsAndPrices[i]), PricePerUnit: amountsAndPrices[i+1], Orders: 1})
+	}
+	return summary
+}
+
+func TestVwap(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []OrderSummary
+		volume int
+		want   float64
+	}{
+		{"no book", nil, 10, 42},
+		{"no volume", levels(10, 5), 0, 42},
+		{"inside the top level", levels(10, 5, 10, 7), 4, 5},
+		{"across levels", levels(10, 5, 10, 7), 15, 85.0 / 15},
+		{"past what hypixel sends goes at the last level", levels(10, 5, 10, 7), 40, 6.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			near(t, "vwap()", vwap(tt.levels, tt.volume, 42), tt.want)
+		})
+	}
+}
+
+func TestDepthWithin(t *testing.T) {
+	tests := []struct {
+		name       string
+		levels     []OrderSummary
+		percentage float64
+		want       int
+	}{
+		{"no book", nil, -5, 0},
+		{"below the top", levels(10, 100, 20, 96, 40, 94), -5, 30},
+		{"the edge of the window counts", levels(10, 100, 20, 95, 40, 94), -5, 30},
+		{"above the top", levels(10, 100, 20, 105, 40, 106), 5, 30},
+		{"stops at the first level outside", levels(10, 100, 20, 90, 40, 99), -5, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, "depthWithin()", depthWithin(tt.levels, 100, tt.percentage), tt.want)
+		})
+	}
+}
+
+func TestAnalyzeBook(t *testing.T) {
+	product := &Product{
+		ProductID: "A",
+		// where our buy order competes, highest first
+		SellSummary: levels(100, 80, 100, 76, 100, 70),
+		// where our sell offer competes, lowest first
+		BuySummary:  levels(100, 101, 100, 105, 100, 131),
+		QuickStatus: QuickStatus{SellPrice: 79, BuyPrice: 102},
+	}
+	empty := &Product{ProductID: "B", QuickStatus: QuickStatus{SellPrice: 80, BuyPrice: 101}}
+
+	tests := []struct {
+		name     string
+		product  *Product
+		volume   int
+		want     BookStats
+		wantSlip float64
+	}{
+		{"top of the book", product, 100, BookStats{BuyDepth: 200, SellDepth: 200, BuyFillPrice: 80, SellFillPrice: 101, AdjustedProfit: 1973}, 0},
+		// vwaps 78 and 103, mirrored around the tops
+		{"two levels deep", product, 200, BookStats{BuyDepth: 200, SellDepth: 200, BuyFillPrice: 82, SellFillPrice: 99, AdjustedProfit: 3152}, 5},
+		{"no book falls back to quick status", empty, 100, BookStats{BuyFillPrice: 80, SellFillPrice: 101, AdjustedProfit: 1973}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeBook(tt.product, tt.volume)
+			expect(t, "BuyDepth", got.BuyDepth, tt.want.BuyDepth)
+			expect(t, "SellDepth", got.SellDepth, tt.want.SellDepth)
+			near(t, "BuyFillPrice", got.BuyFillPrice, tt.want.BuyFillPrice)
+			near(t, "SellFillPrice", got.SellFillPrice, tt.want.SellFillPrice)
+			near(t, "SlippagePercentage", got.SlippagePercentage, tt.wantSlip)
+			expect(t, "AdjustedProfit", got.AdjustedProfit, tt.want.AdjustedProfit)
+		})
+	}
+
+	t.Run("slippage only grows with volume", func(t *testing.T) {
+		last := -1.0
+		for volume := 50; volume <= 1000; volume += 50 {
+			slippage := AnalyzeBook(product, volume).SlippagePercentage
+			if slippage < last {
+				t.Fatalf("slippage at %d = %v, less than %v before it", volume, slippage, last)
+			}
+			last = slippage
+		}
+	})
+}
+
+func TestExceedsSlippage(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      float64
+		slippage float64
+		want     bool
+	}{
+		{"no limit", 0, 80, false},
+		{"under", 5, 4.9, false},
+		{"at", 5, 5, false},
+		{"over", 5, 5.1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expect(t, "exceedsSlippage()", exceedsSlippage(tt.slippage, &config.BZConfig{MaxSlippagePercentage: tt.max}), tt.want)
+		})
+	}
+}
+
+func near(t *testing.T, field string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
@@ -0,0 +1,27 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/manipulation"
+)
+
+// MeasureReplay the manipulation measurements of a product of a recorded poll, `history` (sell prices over
+// PriceHistoryTimeSpan, oldest first) standing in for the fetched price history. They don't depend on any config, so replays
+// of several configs can share them.
+func MeasureReplay(product *Product, history []float64) manipulation.Measurements {
+	evidence := evidenceOf(product)
+	evidence.History = history
+	return manipulation.Measure(&evidence)
+}
+
+// ReplayFlip runs one product of a recorded poll through the same checks a live cycle and Filter do. `measure` stands in for the
+// price history fetch (see MeasureReplay) and is only called for products that get that far. ok false if the config wouldn't
+// have been sent the flip. The flip is still returned if it got measured, so callers can see why (ManipulationVerdict...).
+func ReplayFlip(product *Product, measure func() manipulation.Measurements, tracker *SnapshotTracker, conf *config.BZConfig) (BazaarFoundFlip, bool) {
+	candidate, ok := newCandidate(product, conf, tracker)
+	if !ok {
+		return BazaarFoundFlip{}, false
+	}
+	flip := newBzFlip(&candidate, measure())
+	return flip, Filter(nil, &flip, conf) != nil
+}
@@ -0,0 +1,155 @@
+package flippers
+
+import (
+	"Hyflip-Server/internal/config"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// scorer names, what BZConfig.Scorer and the keys of BZConfig.ScorerWeights can be
+const (
+	ScoreProfit             = "profit"
+	ScoreProfitPercentage   = "profit_percentage"
+	ScoreProfitPerHour      = "profit_per_hour"
+	ScoreVolatilityAdjusted = "volatility_adjusted"
+	ScoreBlend              = "blend"
+)
+
+// Scorer ranks flips, higher is better. Scores of different scorers aren't comparable with each other.
+type Scorer interface {
+	Name() string
+	Score(flip *BazaarFoundFlip) float64
+}
+
+type profitScorer struct{}
+
+func (profitScorer) Name() string { return ScoreProfit }
+
+// Score what the recommended volume makes, at the fill prices when we have them
+func (profitScorer) Score(flip *BazaarFoundFlip) float64 {
+	if flip.AdjustedProfit != 0 {
+		return float64(flip.AdjustedProfit)
+	}
+	return float64(flip.ProfitFromRecommendedFlipVolume)
+}
+
+type profitPercentageScorer struct{}
+
+func (profitPercentageScorer) Name() string { return ScoreProfitPercentage }
+
+func (profitPercentageScorer) Score(flip *BazaarFoundFlip) float64 {
+	if flip.SellPrice <= 0 {
+		return 0
+	}
+	return float64(flip.Profit) / flip.SellPrice * 100
+}
+
+type profitPerHourScorer struct{}
+
+func (profitPerHourScorer) Name() string { return ScoreProfitPerHour }
+
+func (profitPerHourScorer) Score(flip *BazaarFoundFlip) float64 {
+	return flip.ProfitPerHour
+}
+
+type volatilityAdjustedScorer struct{}
+
+func (volatilityAdjustedScorer) Name() string { return ScoreVolatilityAdjusted }
+
+// Score profit, halved for every 10% of volatility. a flip on a price that jumps around is a flip that might not be there tomorrow
+func (volatilityAdjustedScorer) Score(flip *BazaarFoundFlip) float64 {
+	return profitScorer{}.Score(flip) / (1 + flip.Volatility/10)
+}
+
+// blendScorer a weighted sum of other scorers. the scores are log scaled first, otherwise profit (millions) would drown out
+// profit % (tens) no matter the weights
+type blendScorer struct {
+	parts   []Scorer
+	weights []float64
+}
+
+func (b *blendScorer) Name() string { return ScoreBlend }
+
+func (b *blendScorer) Score(flip *BazaarFoundFlip) float64 {
+	score := 0.0
+	for i, part := range b.parts {
+		v := part.Score(flip)
+		score += b.weights[i] * math.Copysign(math.Log10(1+math.Abs(v)), v)
+	}
+	return score
+}
+
+var baseScorers = map[string]Scorer{
+	ScoreProfit:             profitScorer{},
+	ScoreProfitPercentage:   profitPercentageScorer{},
+	ScoreProfitPerHour:      profitPerHourScorer{},
+	ScoreVolatilityAdjusted: volatilityAdjustedScorer{},
+}
+
+// DefaultScorer what configs without a scorer get
+var DefaultScorer Scorer = profitScorer{}
+
+// NewScorer builds the scorer a config asks for. Weights are only used by "blend".
+func NewScorer(name string, weights map[string]float64) (Scorer, error) {
+	if name == "" {
+		return DefaultScorer, nil
+	}
+	if s, ok := baseScorers[name]; ok {
+		return s, nil
+	}
+	if name != ScoreBlend {
+		return nil, fmt.Errorf("unknown scorer %q (one of %s)", name, scorerNames())
+	}
+
+	if len(weights) == 0 {
+		return nil, errors.New("the blend scorer needs scorer_weights")
+	}
+	names := make([]string, 0, len(weights))
+	for part := range weights {
+		names = append(names, part)
+	}
+	sort.Strings(names) // same order every time, floats don't add up the same in every order
+	blend := &blendScorer{}
+	for _, part := range names {
+		s, ok := baseScorers[part]
+		if !ok {
+			return nil, fmt.Errorf("unknown scorer %q in scorer_weights", part)
+		}
+		w := weights[part]
+		if math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight for %q", part)
+		}
+		blend.parts = append(blend.parts, s)
+		blend.weights = append(blend.weights, w)
+	}
+	return blend, nil
+}
+
+func scorerNames() string {
+	names := make([]string, 0, len(baseScorers)+1)
+	for name := range baseScorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(append(names, ScoreBlend), ", ")
+}
+
+// ScorerFor the scorer of a config. Broken scorer settings fall back to DefaultScorer, ValidateBZConfig is what reports them.
+func ScorerFor(conf *config.BZConfig) Scorer {
+	s, err := NewScorer(conf.Scorer, conf.ScorerWeights)
+	if err != nil {
+		log.Println("Ignoring invalid scorer. Error: " + err.Error())
+		return DefaultScorer
+	}
+	return s
+}
+
+// ScoreFlip sets the flip's Score with the config's scorer and returns it.
+func ScoreFlip(flip *BazaarFoundFlip, scorer Scorer) float64 {
+	flip.Score = scorer.Score(flip)
+	return flip.Score
+}
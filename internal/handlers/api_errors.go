@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/api"
+	"errors"
+	"net/http"
+)
+
+// UpstreamErrorStatus maps an error from the api package to the status we should answer with.
+func UpstreamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, api.ErrRateLimited), errors.Is(err, api.ErrUpstreamUnavailable), errors.Is(err, api.ErrInvalidKey):
+		// all of these are our (or the upstream's) problem, and all of them go away with time
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -44,6 +44,7 @@ func AuthMiddleware(data *FlipperStructs) echo.MiddlewareFunc {
 
 			fmt.Println("Succeeded auth.")
 			c.Set("user_key_hash", hash)
+			c.Set("username", username)
 			// Continue. our next function (endpoint) will have access to userDb and hypixelApi
 			return next(c)
 		}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"Hyflip-Server/internal/api"
 	"Hyflip-Server/internal/storage"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -51,12 +50,19 @@ func CreateAccountPostHandler(p *RegisteredPlayers, data *FlipperStructs) echo.H
 		for _, player := range players {
 			if player == username {
 				key := uuid.New().String()
-				playerUuid, err := api.GetMojangUuid(data.Api, username)
+				playerUuid, err := data.Mojang.Uuid(c.Request().Context(), username)
 				if err != nil {
-					return c.JSON(http.StatusBadRequest, ResponseType{
+					status := UpstreamErrorStatus(err)
+					message := "Could not look up uuid. Error: " + err.Error()
+					if status == http.StatusNotFound {
+						message = "Invalid username (uuid not found). Error: " + err.Error()
+					} else if status == http.StatusServiceUnavailable {
+						message = "Mojang is unavailable right now. Retry later. Error: " + err.Error()
+					}
+					return c.JSON(status, ResponseType{
 						Success: false,
 						Data:    nil,
-						Message: "Invalid username (uuid not found). Error: " + err.Error(),
+						Message: message,
 					})
 				}
 
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// BzConfigData the user's bazaar config. Error is set if it doesn't validate anymore (a saved filter expression breaks when a
+// field it uses goes away), no flips get through it until it's fixed.
+type BzConfigData struct {
+	Config    config.BZConfig  `json:"config"`
+	Error     string           `json:"error,omitempty"`
+	ErrorData *ConfigErrorData `json:"errorData,omitempty"`
+}
+
+// GetBzConfigHandler the user's bazaar config and whatever is wrong with it.
+func GetBzConfigHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userKeyHash, _ := c.Get("user_key_hash").(string)
+		if userKeyHash == "" {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+
+		conf, err := data.ConfigTable.GetConfig(userKeyHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			conf, err = config.GenerateDefaultUserConfig(), nil
+		}
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusInternalServerError, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		result := BzConfigData{Config: conf.BzConfig}
+		if err := flippers.ValidateBZConfig(&conf.BzConfig); err != nil {
+			result.Error, result.ErrorData = err.Error(), configErrorData(err)
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    result,
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/cache"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// GetFlipsHandler streams the flips of one registered flip cache, filtered (and ranked, if the flipper does that) by the
+// user's config. Every cache in the registry gets one of these at /api/<name>flips.
+func GetFlipsHandler(data *FlipperStructs, flips cache.Streamer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+		// todo: cache this data.
+		conf, err := data.ConfigTable.GetConfig(userKeyHash.(string))
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		flusher, err := GetSSEFlusher(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid flusher provided. Err: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		flusher.Flush()
+
+		return flips.Stream(c.Request().Context(), conf, func(flip any) {
+			sendEvent(c, flusher, flip)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/cache"
+	"Hyflip-Server/internal/flippers"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetForgeHandler the current forge flips for the user's config, best profit per forge slot hour first.
+// Query: limit (optional).
+func GetForgeHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		forgeCache := cache.Lookup[flippers.ForgeFoundFlip](data.Flippers, "forge")
+		if forgeCache == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "Forge flips are disabled (no forge recipes loaded)",
+				Data:    nil,
+			})
+		}
+
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+
+		limit := 0
+		if raw := c.QueryParam("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+				return c.JSON(http.StatusBadRequest, ResponseType{
+					Success: false,
+					Message: "Invalid limit provided",
+					Data:    nil,
+				})
+			}
+		}
+
+		conf, err := data.ConfigTable.GetConfig(userKeyHash.(string))
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		snapshot := forgeCache.Get()
+		flips := make([]flippers.ForgeFoundFlip, 0, len(snapshot))
+		for _, flip := range snapshot {
+			if flippers.FilterForge(&flip, &conf.ForgeConfig) {
+				flips = append(flips, flip)
+			}
+		}
+		flippers.RankForge(flips)
+		if limit > 0 && len(flips) > limit {
+			flips = flips[:limit]
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    flips,
+		})
+	}
+}
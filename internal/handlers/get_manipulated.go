@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/cache"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+)
+
+// GetManipulatedHandler every bazaar product currently flagged as manipulated (default thresholds), flagged the longest first.
+func GetManipulatedHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if data.BzCache == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "No bazaar data (bazaar cache is disabled)",
+				Data:    nil,
+			})
+		}
+
+		snapshot := data.BzCache.Manipulated.Get()
+		flagged := make([]cache.FlaggedProduct, 0, len(snapshot))
+		for _, product := range snapshot {
+			flagged = append(flagged, product)
+		}
+		sort.Slice(flagged, func(i, j int) bool {
+			if !flagged[i].FirstFlagged.Equal(flagged[j].FirstFlagged) {
+				return flagged[i].FirstFlagged.Before(flagged[j].FirstFlagged)
+			}
+			return flagged[i].ProductID < flagged[j].ProductID
+		})
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    flagged,
+		})
+	}
+}
+
+// GetManipulatedStreamHandler streams flagged products like the flip streams: what's flagged now, then every product of the
+// next refresh.
+func GetManipulatedStreamHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if data.BzCache == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "No bazaar data (bazaar cache is disabled)",
+				Data:    nil,
+			})
+		}
+
+		flusher, err := GetSSEFlusher(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid flusher provided. Err: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		flusher.Flush()
+
+		return streamFlips(c, flusher, data.BzCache.Manipulated.Broadcaster, func(*cache.FlaggedProduct) bool {
+			return true // same for everyone
+		}, nil)
+	}
+}
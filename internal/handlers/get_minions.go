@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/minions"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// GetMinionsHandler every minion with the user's minion setup, priced from the latest bazaar poll.
+// Query: sort (profit or roi, default profit).
+func GetMinionsHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if data.Minions == nil || data.BzCache == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "Minions are disabled (no minion definitions or bazaar data)",
+				Data:    nil,
+			})
+		}
+
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+
+		sortBy := c.QueryParam("sort")
+		if sortBy != "" && sortBy != "profit" && sortBy != "roi" {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid sort provided (profit or roi)",
+				Data:    nil,
+			})
+		}
+
+		conf, err := data.ConfigTable.GetConfig(userKeyHash.(string))
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		products := data.BzCache.Products()
+		if products == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "No bazaar data yet, try again in a bit",
+				Data:    nil,
+			})
+		}
+		// without NPC prices the bazaar ones still work
+		npc, err := data.Items.NpcPrices(c.Request().Context())
+		if err != nil {
+			log.Println("Could not load NPC prices for minions. Error: " + err.Error())
+		}
+
+		results, err := data.Minions.Calculate(minions.Prices{Products: products, Npc: npc}, &conf.MinionConfig)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid minion config. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		if sortBy == "roi" {
+			minions.SortByRoi(results)
+		} else {
+			minions.SortByProfit(results)
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    results,
+		})
+	}
+}
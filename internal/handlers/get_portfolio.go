@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/portfolio"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetPortfolioHandler plans which of the current bazaar flips to do with the user's purse and free order slots.
+// Query: purse, slots, risk (0-1, default 0.5), horizon (hours, default 24).
+func GetPortfolioHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+
+		if data.BzCache == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "No bazaar data (bazaar cache is disabled)",
+				Data:    nil,
+			})
+		}
+
+		req, err := portfolioRequestFromQuery(c)
+		if err == nil {
+			err = req.Validate()
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid portfolio request. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		conf, err := data.ConfigTable.GetConfig(userKeyHash.(string))
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		// only flips the user would've been sent anyway
+		flips := flippers.FilterFlips(data.BzCache.Get(), &conf.BzConfig)
+		plan, err := portfolio.Optimize(flips, req)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Could not plan portfolio. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    plan,
+		})
+	}
+}
+
+func portfolioRequestFromQuery(c echo.Context) (portfolio.Request, error) {
+	req := portfolio.Request{RiskTolerance: 0.5, HorizonHours: 24}
+	var err error
+	if req.Purse, err = strconv.ParseFloat(c.QueryParam("purse"), 64); err != nil {
+		return req, err
+	}
+	if req.Slots, err = strconv.Atoi(c.QueryParam("slots")); err != nil {
+		return req, err
+	}
+	if risk := c.QueryParam("risk"); risk != "" {
+		if req.RiskTolerance, err = strconv.ParseFloat(risk, 64); err != nil {
+			return req, err
+		}
+	}
+	if horizon := c.QueryParam("horizon"); horizon != "" {
+		if req.HorizonHours, err = strconv.ParseFloat(horizon, 64); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/backtest"
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+// backtestTimeout a month of polls takes a while to replay, but not this long
+const backtestTimeout = 2 * time.Minute
+
+// BacktestRequest a backtest.Request plus the config to test.
+type BacktestRequest struct {
+	backtest.Request
+	// Config optional, the user's saved bazaar config if left out
+	Config *config.BZConfig `json:"config"`
+}
+
+// configToTest the config a backtest request brought (validated), or the user's saved one. The status code goes with the error.
+func configToTest(data *FlipperStructs, userKeyHash string, conf *config.BZConfig) (*config.BZConfig, int, error) {
+	if conf != nil {
+		if err := flippers.ValidateBZConfig(conf); err != nil {
+			return nil, http.StatusBadRequest, errors.New("Invalid config. Error: " + err.Error())
+		}
+		return conf, 0, nil
+	}
+
+	userConf, err := data.ConfigTable.GetConfig(userKeyHash)
+	if err != nil {
+		log.Println("Error loading config. Error: " + err.Error())
+		return nil, http.StatusUnauthorized, errors.New("Request error (Loading Config). Error: " + err.Error())
+	}
+	return &userConf.BzConfig, 0, nil
+}
+
+// PostBacktestHandler replays the recorded bazaar between from and to through a bazaar config and reports how it would have
+// done (see backtest.Report).
+func PostBacktestHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+		if data.History == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "Backtests are disabled (no bazaar history recorded)",
+				Data:    nil,
+			})
+		}
+
+		var req BacktestRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid backtest request. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		if err := req.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid backtest request. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		conf, status, err := configToTest(data, userKeyHash.(string), req.Config)
+		if err != nil {
+			return c.JSON(status, ResponseType{
+				Success: false,
+				Message: err.Error(),
+				Data:    nil,
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), backtestTimeout)
+		defer cancel()
+		report, err := backtest.Run(ctx, data.History, conf, req.Request)
+		if errors.Is(err, backtest.ErrNoSnapshots) {
+			return c.JSON(http.StatusNotFound, ResponseType{
+				Success: false,
+				Message: "Could not backtest. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		if err != nil {
+			log.Println("Error running backtest. Error: " + err.Error())
+			return c.JSON(http.StatusInternalServerError, ResponseType{
+				Success: false,
+				Message: "Could not backtest. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    report,
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/backtest"
+	"Hyflip-Server/internal/config"
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+// tuneTimeout every candidate replays the whole range. it's one pass over the db but a lot of simulating
+const tuneTimeout = 10 * time.Minute
+
+// TuneRequest a backtest.TuneRequest plus the config the sweep starts from.
+type TuneRequest struct {
+	backtest.TuneRequest
+	// Config optional, the user's saved bazaar config if left out
+	Config *config.BZConfig `json:"config"`
+}
+
+// PostTuneHandler sweeps bazaar config fields over the recorded bazaar and returns the best configs by simulated profit per
+// hour (see backtest.Tuning). Any result's config can be saved as is with PUT /api/config/bz.
+func PostTuneHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userKeyHash := c.Get("user_key_hash")
+		if userKeyHash == nil {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+		if data.History == nil {
+			return c.JSON(http.StatusServiceUnavailable, ResponseType{
+				Success: false,
+				Message: "Tuning is disabled (no bazaar history recorded)",
+				Data:    nil,
+			})
+		}
+
+		var req TuneRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid tune request. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		if err := req.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid tune request. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		conf, status, err := configToTest(data, userKeyHash.(string), req.Config)
+		if err != nil {
+			return c.JSON(status, ResponseType{
+				Success: false,
+				Message: err.Error(),
+				Data:    nil,
+			})
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), tuneTimeout)
+		defer cancel()
+		tuning, err := backtest.Tune(ctx, data.History, conf, req.TuneRequest)
+		if errors.Is(err, backtest.ErrNoSnapshots) {
+			return c.JSON(http.StatusNotFound, ResponseType{
+				Success: false,
+				Message: "Could not tune. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		if err != nil {
+			log.Println("Error tuning config. Error: " + err.Error())
+			return c.JSON(http.StatusInternalServerError, ResponseType{
+				Success: false,
+				Message: "Could not tune. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    tuning,
+		})
+	}
+}
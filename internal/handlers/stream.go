@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/cache"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// streamFlips is cache.Stream over SSE, for broadcasters that aren't flip caches (see GetFlipsHandler for those).
+func streamFlips[T any](c echo.Context, flusher http.Flusher, b *cache.Broadcaster[T], keep func(*T) bool, score func(*T) float64) error {
+	return cache.Stream(c.Request().Context(), b, keep, score, func(flip *T) {
+		sendEvent(c, flusher, flip)
+	})
+}
+
+// GetSSEFlusher - Sets the headers to allow server-side events, and gives us the flusher to immediately push data
+func GetSSEFlusher(c echo.Context) (http.Flusher, error) {
+	c.Response().Header().Set("Content-Type", "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().Header().Set("Connection", "keep-alive")
+
+	/* the flusher is needed because http buffers our responses because an HTTP request for every small request would cause some
+	performance issues */
+	flusher, ok := c.Response().Writer.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("http req doesnt support sse")
+	}
+
+	return flusher, nil
+}
+
+// sendEvent writes one SSE data event.
+func sendEvent(c echo.Context, flusher http.Flusher, v any) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshalling event: %v", err)
+		return
+	}
+
+	fmt.Fprintf(c.Response(), "data: %s\n\n", jsonData)
+	flusher.Flush()
+}
@@ -3,14 +3,25 @@ package handlers
 import (
 	"Hyflip-Server/internal/api"
 	"Hyflip-Server/internal/cache"
+	"Hyflip-Server/internal/flippers"
+	"Hyflip-Server/internal/minions"
 	"Hyflip-Server/internal/storage"
 )
 
 type FlipperStructs struct {
 	Api         *api.HypixelApiClient
+	Mojang      *api.MojangResolver
 	UsersTable  *storage.DatabaseClient
 	ConfigTable *storage.ConfigTableClient
-	BzCache     *cache.BazaarCache
+	// History recorded bazaar polls, for backtests. nil turns those off
+	History *storage.BazaarHistoryTable
+	BzCache *cache.BazaarCache
+	// Flippers every running flip cache (the bazaar one included). Flip types without data to flip with just aren't in it
+	Flippers *cache.Registry
+	// Items the item catalog, for NPC prices
+	Items *flippers.ItemCatalog
+	// Minions nil if there are no minion definitions
+	Minions *minions.Definitions
 }
 
 type ResponseType struct {
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/expr"
+	"Hyflip-Server/internal/flippers"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// ConfigErrorData is sent along with a rejected config so clients can point at the broken part of the filter expression.
+type ConfigErrorData struct {
+	// Position column of the filter expression the error is at. 0 if the error isn't in the expression
+	Position int    `json:"position,omitempty"`
+	Pointer  string `json:"pointer,omitempty"`
+}
+
+// configErrorData where in the filter expression a config error is. nil if it isn't in the expression.
+func configErrorData(err error) *ConfigErrorData {
+	var exprErr *expr.Error
+	if !errors.As(err, &exprErr) {
+		return nil
+	}
+	return &ConfigErrorData{Position: exprErr.Pos + 1, Pointer: exprErr.Pointer()}
+}
+
+// UpdateBzConfigHandler replaces the user's bazaar config. Rules and the filter expression are compiled first, so a config that
+// would be (partially) ignored never gets saved.
+func UpdateBzConfigHandler(data *FlipperStructs) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userKeyHash, _ := c.Get("user_key_hash").(string)
+		username, _ := c.Get("username").(string)
+		if userKeyHash == "" || username == "" {
+			return c.JSON(http.StatusUnauthorized, ResponseType{
+				Success: false,
+				Message: "Invalid user_key_hash provided (nil)",
+				Data:    nil,
+			})
+		}
+
+		var bzConfig config.BZConfig
+		if err := c.Bind(&bzConfig); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid config. Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		if err := flippers.ValidateBZConfig(&bzConfig); err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseType{
+				Success: false,
+				Message: "Invalid config. Error: " + err.Error(),
+				Data:    configErrorData(err),
+			})
+		}
+
+		conf, err := data.ConfigTable.GetConfig(userKeyHash)
+		if errors.Is(err, pgx.ErrNoRows) {
+			conf, err = config.GenerateDefaultUserConfig(), nil
+		}
+		if err != nil {
+			log.Println("Error loading config. Error: " + err.Error())
+			return c.JSON(http.StatusInternalServerError, ResponseType{
+				Success: false,
+				Message: "Request error (Loading Config). Error: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		conf.BzConfig = bzConfig
+		if err := data.ConfigTable.SaveConfig(userKeyHash, username, conf); err != nil {
+			log.Println("Error saving config. Error: " + err.Error())
+			return c.JSON(http.StatusInternalServerError, ResponseType{
+				Success: false,
+				Message: "Retry. Error saving config: " + err.Error(),
+				Data:    nil,
+			})
+		}
+
+		return c.JSON(http.StatusOK, ResponseType{
+			Success: true,
+			Message: "",
+			Data:    conf.BzConfig,
+		})
+	}
+}
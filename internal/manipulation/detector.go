@@ -0,0 +1,182 @@
+package manipulation
+
+import (
+	"Hyflip-Server/internal/config"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// VolumeAverageCheck the moving week is divided by this to get "normal" volume (a bit more than a day's worth)
+	VolumeAverageCheck = 8
+	// MaxSwingPercentage default for ManipulationThresholds.MaxSwingPercentage. 40% is arbitrary atm
+	MaxSwingPercentage = 40
+	// MaxZScore default for ManipulationThresholds.MaxZScore
+	MaxZScore = 3.5
+	// MaxVolumeSpike default for ManipulationThresholds.MaxVolumeSpike
+	MaxVolumeSpike = 10
+	// MaxSingleOrderShare default for ManipulationThresholds.MaxSingleOrderShare
+	MaxSingleOrderShare = 0.8
+	// MinSpoofDays default for ManipulationThresholds.MinSpoofDays
+	MinSpoofDays = 0.5
+	// spoofLevels how many levels from the top of each book the spoofing detector looks at
+	spoofLevels = 5
+)
+
+// Level one price level of an order book, best first.
+type Level struct {
+	Price  float64
+	Amount int
+	Orders int
+}
+
+// Evidence everything the detectors look at for one product.
+type Evidence struct {
+	// History sell prices over Window, oldest first
+	History []float64
+	Window  time.Duration
+
+	SellPrice      float64
+	BuyPrice       float64
+	SellVolume     int
+	BuyVolume      int
+	SellMovingWeek int
+	BuyMovingWeek  int
+
+	// BuyOrders sell_summary, SellOffers buy_summary
+	BuyOrders  []Level
+	SellOffers []Level
+}
+
+// Measurements what the detectors measured. Doesn't depend on anyone's thresholds, so it's computed once per product and every
+// user's thresholds are applied to it later (see Judge).
+type Measurements struct {
+	WindowHours   float64 `json:"windowHours"`
+	HistoryPoints int     `json:"historyPoints"`
+	// SwingPercentage max-min of the sell price over its midpoint
+	SwingPercentage float64 `json:"swingPercentage"`
+	// SellVolumeRatio and BuyVolumeRatio current volume over "normal" volume (moving week / VolumeAverageCheck)
+	SellVolumeRatio float64 `json:"sellVolumeRatio"`
+	BuyVolumeRatio  float64 `json:"buyVolumeRatio"`
+	// ZScore how many standard deviations the current sell price is from its mean
+	ZScore float64 `json:"zScore"`
+	// Volatility standard deviation of the sell price relative to its mean, in %
+	Volatility float64 `json:"volatility"`
+	// SingleOrderShare biggest single order's share of the top levels of either book
+	SingleOrderShare float64 `json:"singleOrderShare"`
+	// SingleOrderDays that order's size in days of trading
+	SingleOrderDays float64 `json:"singleOrderDays"`
+}
+
+// Reason why a detector flagged a product. Code is the stable, machine-readable part.
+type Reason struct {
+	Detector  string  `json:"detector"`
+	Code      string  `json:"code"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Verdict of every enabled detector.
+type Verdict struct {
+	Manipulated bool     `json:"manipulated"`
+	Reasons     []Reason `json:"reasons"`
+}
+
+// Detector one way of spotting manipulation. Measure fills in its part of the measurements, Judge decides with a user's
+// thresholds (already defaulted, see WithDefaults). A nil Judge result means nothing suspicious.
+type Detector interface {
+	Name() string
+	Measure(e *Evidence, m *Measurements)
+	Judge(m *Measurements, t *config.ManipulationThresholds) []Reason
+}
+
+// Detectors every detector, in the order they run
+var Detectors = []Detector{Swing{}, ZScore{}, VolumeSpike{}, Spoofing{}}
+
+// Measure runs every detector's measurements.
+func Measure(e *Evidence) Measurements {
+	m := Measurements{WindowHours: e.Window.Hours(), HistoryPoints: len(e.History)}
+	for _, d := range Detectors {
+		d.Measure(e, &m)
+	}
+	return m
+}
+
+// Judge applies a user's thresholds to measurements.
+func Judge(m *Measurements, thresholds *config.ManipulationThresholds) Verdict {
+	t := WithDefaults(thresholds)
+	verdict := Verdict{Reasons: make([]Reason, 0)}
+	for _, d := range Detectors {
+		if slices.Contains(t.Disabled, d.Name()) {
+			continue
+		}
+		verdict.Reasons = append(verdict.Reasons, d.Judge(m, &t)...)
+	}
+	verdict.Manipulated = len(verdict.Reasons) > 0
+	return verdict
+}
+
+// WithDefaults the thresholds with every unset (0) one replaced by its default.
+func WithDefaults(t *config.ManipulationThresholds) config.ManipulationThresholds {
+	out := config.ManipulationThresholds{}
+	if t != nil {
+		out = *t
+	}
+	if out.MaxSwingPercentage <= 0 {
+		out.MaxSwingPercentage = MaxSwingPercentage
+	}
+	if out.MaxZScore <= 0 {
+		out.MaxZScore = MaxZScore
+	}
+	if out.MaxVolumeSpike <= 0 {
+		out.MaxVolumeSpike = MaxVolumeSpike
+	}
+	if out.MaxSingleOrderShare <= 0 {
+		out.MaxSingleOrderShare = MaxSingleOrderShare
+	}
+	if out.MinSpoofDays <= 0 {
+		out.MinSpoofDays = MinSpoofDays
+	}
+	return out
+}
+
+// Validate rejects thresholds that can't mean anything.
+func Validate(t *config.ManipulationThresholds) error {
+	var errs []error
+	for _, name := range t.Disabled {
+		if !slices.Contains(Names(), name) {
+			errs = append(errs, fmt.Errorf("unknown detector %q (one of %s)", name, strings.Join(Names(), ", ")))
+		}
+	}
+	for _, threshold := range []struct {
+		name  string
+		value float64
+	}{
+		{"max_swing_percentage", t.MaxSwingPercentage},
+		{"max_z_score", t.MaxZScore},
+		{"max_volume_spike", t.MaxVolumeSpike},
+		{"max_single_order_share", t.MaxSingleOrderShare},
+		{"min_spoof_days", t.MinSpoofDays},
+	} {
+		if v := threshold.value; v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			errs = append(errs, fmt.Errorf("%s has to be a positive number (or 0 for the default)", threshold.name))
+		}
+	}
+	if t.MaxSingleOrderShare > 1 {
+		errs = append(errs, errors.New("max_single_order_share is a share, it can't be over 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// Names of every detector, for validating configs.
+func Names() []string {
+	names := make([]string, len(Detectors))
+	for i, d := range Detectors {
+		names[i] = d.Name()
+	}
+	return names
+}
@@ -0,0 +1,150 @@
+package manipulation
+
+import (
+	"Hyflip-Server/internal/config"
+	"math"
+)
+
+// Swing is the original rule: a large price swing while volume is abnormally low.
+type Swing struct{}
+
+func (Swing) Name() string { return "swing" }
+
+func (Swing) Measure(e *Evidence, m *Measurements) {
+	minimum, maximum := e.SellPrice, e.SellPrice
+	for _, price := range e.History {
+		minimum = min(minimum, price)
+		maximum = max(maximum, price)
+	}
+	if maximum+minimum > 0 {
+		m.SwingPercentage = (maximum - minimum) / ((maximum + minimum) / 2) * 100
+	}
+	m.SellVolumeRatio = volumeRatio(e.SellVolume, e.SellMovingWeek)
+	m.BuyVolumeRatio = volumeRatio(e.BuyVolume, e.BuyMovingWeek)
+}
+
+func (Swing) Judge(m *Measurements, t *config.ManipulationThresholds) []Reason {
+	if m.SwingPercentage <= t.MaxSwingPercentage {
+		return nil
+	}
+	// low volume = under the normal volume (ratio < 1)
+	var reasons []Reason
+	if m.SellVolumeRatio < 1 {
+		reasons = append(reasons, Reason{Detector: "swing", Code: "swing_low_sell_volume", Value: m.SwingPercentage, Threshold: t.MaxSwingPercentage})
+	}
+	if m.BuyVolumeRatio < 1 {
+		reasons = append(reasons, Reason{Detector: "swing", Code: "swing_low_buy_volume", Value: m.SwingPercentage, Threshold: t.MaxSwingPercentage})
+	}
+	return reasons
+}
+
+// ZScore flags a current price that's far off its history.
+type ZScore struct{}
+
+func (ZScore) Name() string { return "zscore" }
+
+func (ZScore) Measure(e *Evidence, m *Measurements) {
+	if len(e.History) < 2 {
+		return
+	}
+	sum := 0.0
+	for _, price := range e.History {
+		sum += price
+	}
+	mean := sum / float64(len(e.History))
+	variance := 0.0
+	for _, price := range e.History {
+		variance += (price - mean) * (price - mean)
+	}
+	std := math.Sqrt(variance / float64(len(e.History)))
+	if mean > 0 {
+		m.Volatility = std / mean * 100
+	}
+	if std > 0 {
+		m.ZScore = (e.SellPrice - mean) / std
+	}
+}
+
+func (ZScore) Judge(m *Measurements, t *config.ManipulationThresholds) []Reason {
+	if math.Abs(m.ZScore) <= t.MaxZScore {
+		return nil
+	}
+	code := "price_above_history"
+	if m.ZScore < 0 {
+		code = "price_below_history"
+	}
+	return []Reason{{Detector: "zscore", Code: code, Value: m.ZScore, Threshold: t.MaxZScore}}
+}
+
+// VolumeSpike flags far more volume sitting in the books than normally trades.
+type VolumeSpike struct{}
+
+func (VolumeSpike) Name() string { return "volume_spike" }
+
+// Measure the ratios are shared with Swing, which already measured them
+func (VolumeSpike) Measure(*Evidence, *Measurements) {}
+
+func (VolumeSpike) Judge(m *Measurements, t *config.ManipulationThresholds) []Reason {
+	var reasons []Reason
+	if m.SellVolumeRatio > t.MaxVolumeSpike {
+		reasons = append(reasons, Reason{Detector: "volume_spike", Code: "sell_volume_spike", Value: m.SellVolumeRatio, Threshold: t.MaxVolumeSpike})
+	}
+	if m.BuyVolumeRatio > t.MaxVolumeSpike {
+		reasons = append(reasons, Reason{Detector: "volume_spike", Code: "buy_volume_spike", Value: m.BuyVolumeRatio, Threshold: t.MaxVolumeSpike})
+	}
+	return reasons
+}
+
+// Spoofing flags one huge order propping up (or holding down) the top of a book.
+type Spoofing struct{}
+
+func (Spoofing) Name() string { return "spoofing" }
+
+func (Spoofing) Measure(e *Evidence, m *Measurements) {
+	for _, side := range []struct {
+		levels     []Level
+		movingWeek int
+	}{{e.BuyOrders, e.SellMovingWeek}, {e.SellOffers, e.BuyMovingWeek}} {
+		share, amount := largestSingleOrder(side.levels)
+		if share <= m.SingleOrderShare {
+			continue
+		}
+		m.SingleOrderShare = share
+		m.SingleOrderDays = 0
+		if side.movingWeek > 0 {
+			m.SingleOrderDays = float64(amount) / (float64(side.movingWeek) / 7)
+		}
+	}
+}
+
+func (Spoofing) Judge(m *Measurements, t *config.ManipulationThresholds) []Reason {
+	// a big share of a tiny book is just a tiny book, the order has to be big in absolute terms too
+	if m.SingleOrderShare <= t.MaxSingleOrderShare || m.SingleOrderDays < t.MinSpoofDays {
+		return nil
+	}
+	return []Reason{{Detector: "spoofing", Code: "single_large_order", Value: m.SingleOrderShare, Threshold: t.MaxSingleOrderShare}}
+}
+
+// largestSingleOrder the biggest level made of one order within the top spoofLevels, as a share of those levels
+func largestSingleOrder(levels []Level) (float64, int) {
+	levels = levels[:min(len(levels), spoofLevels)]
+	total, largest := 0, 0
+	for _, level := range levels {
+		total += level.Amount
+		if level.Orders == 1 && level.Amount > largest {
+			largest = level.Amount
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(largest) / float64(total), largest
+}
+
+func volumeRatio(volume int, movingWeek int) float64 {
+	normal := float64(movingWeek) / VolumeAverageCheck
+	if normal <= 0 {
+		return 0
+	}
+	return float64(volume) / normal
+}
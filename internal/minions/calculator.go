@@ -0,0 +1,277 @@
+package minions
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"fmt"
+	"sort"
+)
+
+// ways of selling what a minion makes. MinionConfig.SellMode is one of these
+const (
+	SellOffer = "sell_offer"
+	InstaSell = "insta_sell"
+	SellNpc   = "npc"
+	SellBest  = "best"
+)
+
+// MaxUpgrades minions have two upgrade slots
+const MaxUpgrades = 2
+
+const secondsPerDay = 24 * 60 * 60
+
+// Prices what the calculator sells and buys at.
+type Prices struct {
+	// Products latest bazaar products
+	Products map[string]flippers.Product
+	// Npc NPC sell prices, see flippers.ItemCatalog.NpcPrices
+	Npc map[string]float64
+}
+
+// DropYield how much of one item a minion makes per day.
+type DropYield struct {
+	Item   string  `json:"item"`
+	PerDay float64 `json:"perDay"`
+}
+
+// CoinsPerDay revenue per day for each way of selling, before fuel.
+type CoinsPerDay struct {
+	SellOffer float64 `json:"sellOffer"`
+	InstaSell float64 `json:"instaSell"`
+	Npc       float64 `json:"npc"`
+}
+
+// Result one minion with the user's setup.
+type Result struct {
+	Id          string      `json:"id"`
+	Name        string      `json:"name"`
+	Tier        int         `json:"tier"`
+	Drops       []DropYield `json:"drops"`
+	CoinsPerDay CoinsPerDay `json:"coinsPerDay"`
+	// SellMode the way of selling ProfitPerDay assumes
+	SellMode       string  `json:"sellMode"`
+	FuelCostPerDay float64 `json:"fuelCostPerDay"`
+	ProfitPerDay   float64 `json:"profitPerDay"`
+	// HoursUntilFull how long the storage lasts. production stops after that until it's collected
+	HoursUntilFull float64 `json:"hoursUntilFull"`
+	// CraftCost crafting every tier up to this one, at insta-buy prices. 0 if something in it isn't on the bazaar
+	CraftCost float64 `json:"craftCost"`
+	// RoiPercentage ProfitPerDay relative to CraftCost, per day
+	RoiPercentage float64 `json:"roiPercentage"`
+	PaybackDays   float64 `json:"paybackDays"`
+}
+
+// Validate the setup in a MinionConfig against the definitions.
+func (d *Definitions) Validate(conf *config.MinionConfig) error {
+	if conf.Fuel != "" {
+		if _, ok := d.Fuels[conf.Fuel]; !ok {
+			return fmt.Errorf("unknown fuel %q", conf.Fuel)
+		}
+	}
+	if len(conf.Upgrades) > MaxUpgrades {
+		return fmt.Errorf("minions only have %d upgrade slots", MaxUpgrades)
+	}
+	for _, upgrade := range conf.Upgrades {
+		if _, ok := d.Upgrades[upgrade]; !ok {
+			return fmt.Errorf("unknown upgrade %q", upgrade)
+		}
+	}
+	if conf.Storage != "" {
+		if _, ok := d.Storages[conf.Storage]; !ok {
+			return fmt.Errorf("unknown storage %q", conf.Storage)
+		}
+	}
+	switch conf.SellMode {
+	case "", SellOffer, InstaSell, SellNpc, SellBest:
+	default:
+		return fmt.Errorf("unknown sell mode %q", conf.SellMode)
+	}
+	if conf.CollectEveryHours < 0 {
+		return fmt.Errorf("collect_every_hours can't be negative")
+	}
+	return nil
+}
+
+// Calculate every minion with the user's setup, in no particular order (see SortByProfit, SortByRoi).
+func (d *Definitions) Calculate(prices Prices, conf *config.MinionConfig) ([]Result, error) {
+	if err := d.Validate(conf); err != nil {
+		return nil, err
+	}
+
+	fuel := d.Fuels[conf.Fuel]
+	speed := 1 + fuel.Speed
+	multiplier := 1.0
+	if fuel.Multiplier > 0 {
+		multiplier = fuel.Multiplier
+	}
+	var extra []Drop
+	for _, id := range conf.Upgrades {
+		upgrade := d.Upgrades[id]
+		speed += upgrade.Speed
+		extra = append(extra, upgrade.Extra...)
+	}
+	extraSlots := d.Storages[conf.Storage].Slots
+
+	fuelCost := 0.0
+	if conf.Fuel != "" && fuel.DurationHours > 0 {
+		fuelCost = instaBuyPrice(conf.Fuel, prices) * 24 / fuel.DurationHours
+	}
+
+	rules := flippers.ExcludeRules(conf.ExcludeItems)
+	results := make([]Result, 0, len(d.Minions))
+	for i := range d.Minions {
+		m := &d.Minions[i]
+		if !m.allowed(rules) {
+			continue
+		}
+		tierIndex := len(m.Tiers) - 1
+		if conf.Tier > 0 {
+			if tierIndex = m.tierIndex(conf.Tier); tierIndex < 0 {
+				continue // this minion doesn't go that high
+			}
+		}
+		tier := m.Tiers[tierIndex]
+
+		harvestsPerDay := secondsPerDay / (tier.SecondsPerAction * float64(m.ActionsPerHarvest) / speed)
+		drops := make([]DropYield, 0, len(m.Drops)+len(extra))
+		total := 0.0
+		for _, drop := range append(append([]Drop{}, m.Drops...), extra...) {
+			perDay := drop.Amount * harvestsPerDay * multiplier
+			drops = append(drops, DropYield{Item: drop.Item, PerDay: perDay})
+			total += perDay
+		}
+
+		r := Result{Id: m.Id, Name: m.Name, Tier: tier.Tier, FuelCostPerDay: fuelCost}
+		if total <= 0 {
+			continue
+		}
+		capacity := float64((tier.Slots + extraSlots) * SlotSize)
+		r.HoursUntilFull = capacity / total * 24
+		// storage fills up before the user comes back, the rest of the time it's idle
+		if conf.CollectEveryHours > 0 && r.HoursUntilFull < conf.CollectEveryHours {
+			scale := r.HoursUntilFull / conf.CollectEveryHours
+			for j := range drops {
+				drops[j].PerDay *= scale
+			}
+		}
+		r.Drops = drops
+
+		r.CoinsPerDay = revenue(drops, prices)
+		r.SellMode, r.ProfitPerDay = pickMode(r.CoinsPerDay, conf.SellMode)
+		r.ProfitPerDay -= fuelCost
+
+		r.CraftCost = m.craftCost(tierIndex, prices)
+		if r.CraftCost > 0 {
+			r.RoiPercentage = r.ProfitPerDay / r.CraftCost * 100
+			if r.ProfitPerDay > 0 {
+				r.PaybackDays = r.CraftCost / r.ProfitPerDay
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// allowed excluding a minion works by its id or by what it drops
+func (m *Minion) allowed(rules *flippers.ItemRules) bool {
+	if !rules.Allows(m.Id) {
+		return false
+	}
+	for _, drop := range m.Drops {
+		if !rules.Allows(drop.Item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Minion) tierIndex(tier int) int {
+	for i, t := range m.Tiers {
+		if t.Tier == tier {
+			return i
+		}
+	}
+	return -1
+}
+
+// craftCost every tier up to tierIndex, since each one eats the one before. 0 if any ingredient can't be priced
+func (m *Minion) craftCost(tierIndex int, prices Prices) float64 {
+	cost := 0.0
+	for _, tier := range m.Tiers[:tierIndex+1] {
+		for item, amount := range tier.Craft {
+			price := instaBuyPrice(item, prices)
+			if price <= 0 {
+				return 0
+			}
+			cost += price * amount
+		}
+	}
+	return cost
+}
+
+func revenue(drops []DropYield, prices Prices) CoinsPerDay {
+	taxFactor := 1 - flippers.BazaarTax/100.0
+	var coins CoinsPerDay
+	for _, drop := range drops {
+		npc := prices.Npc[drop.Item]
+		coins.Npc += drop.PerDay * npc
+
+		product, ok := prices.Products[drop.Item]
+		if !ok {
+			// not on the bazaar, the NPC is the only buyer
+			coins.SellOffer += drop.PerDay * npc
+			coins.InstaSell += drop.PerDay * npc
+			continue
+		}
+		coins.SellOffer += drop.PerDay * product.QuickStatus.BuyPrice * taxFactor
+		coins.InstaSell += drop.PerDay * product.QuickStatus.SellPrice * taxFactor
+	}
+	return coins
+}
+
+func pickMode(coins CoinsPerDay, mode string) (string, float64) {
+	switch mode {
+	case SellOffer:
+		return SellOffer, coins.SellOffer
+	case InstaSell:
+		return InstaSell, coins.InstaSell
+	case SellNpc:
+		return SellNpc, coins.Npc
+	}
+	best, value := SellOffer, coins.SellOffer
+	if coins.InstaSell > value {
+		best, value = InstaSell, coins.InstaSell
+	}
+	if coins.Npc > value {
+		best, value = SellNpc, coins.Npc
+	}
+	return best, value
+}
+
+func instaBuyPrice(item string, prices Prices) float64 {
+	if product, ok := prices.Products[item]; ok {
+		return product.QuickStatus.BuyPrice
+	}
+	return 0
+}
+
+// SortByProfit most profit per day first.
+func SortByProfit(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ProfitPerDay > results[j].ProfitPerDay
+	})
+}
+
+// SortByRoi best daily return on the crafting cost first. Minions without a known craft cost go last.
+func SortByRoi(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.CraftCost > 0) != (b.CraftCost > 0) {
+			return a.CraftCost > 0
+		}
+		if a.RoiPercentage != b.RoiPercentage {
+			return a.RoiPercentage > b.RoiPercentage
+		}
+		return a.ProfitPerDay > b.ProfitPerDay
+	})
+}
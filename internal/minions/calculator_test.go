@@ -0,0 +1,190 @@
+package minions
+
+import (
+	"Hyflip-Server/internal/config"
+	"Hyflip-Server/internal/flippers"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testDefinitions a cobblestone minion (2 tiers, sells on the bazaar) and one whose drop only an NPC buys.
+func testDefinitions() *Definitions {
+	return &Definitions{
+		Minions: []Minion{
+			{
+				Id: "COBBLESTONE_GENERATOR", Name: "Cobblestone Minion", ActionsPerHarvest: 2,
+				Drops: []Drop{{Item: "COBBLESTONE", Amount: 1}},
+				Tiers: []Tier{
+					{Tier: 1, SecondsPerAction: 10, Slots: 1, Craft: map[string]float64{"COBBLESTONE": 80}},
+					{Tier: 2, SecondsPerAction: 5, Slots: 3, Craft: map[string]float64{"COBBLESTONE": 160}},
+				},
+			},
+			{
+				Id: "ODD_GENERATOR", Name: "Odd Minion", ActionsPerHarvest: 1,
+				Drops: []Drop{{Item: "ODD_THING", Amount: 0.5}},
+				Tiers: []Tier{{Tier: 1, SecondsPerAction: 30, Slots: 15, Craft: map[string]float64{"NOT_ON_BAZAAR": 1}}},
+			},
+		},
+		Fuels: map[string]Fuel{
+			"COAL":     {Name: "Coal", Speed: 0.25, DurationHours: 0.5},
+			"CATALYST": {Name: "Catalyst", Multiplier: 3, DurationHours: 3},
+		},
+		Upgrades: map[string]Upgrade{
+			"DIAMOND_SPREADING": {Name: "Diamond Spreading", Extra: []Drop{{Item: "DIAMOND", Amount: 0.1}}},
+			"FLYCATCHER":        {Name: "Flycatcher", Speed: 0.2},
+		},
+		Storages: map[string]Storage{"LARGE": {Name: "Large Storage", Slots: 12}},
+	}
+}
+
+func testPrices() Prices {
+	product := func(id string, buyPrice float64, sellPrice float64) flippers.Product {
+		return flippers.Product{ProductID: id, QuickStatus: flippers.QuickStatus{ProductID: id, BuyPrice: buyPrice, SellPrice: sellPrice}}
+	}
+	return Prices{
+		Products: map[string]flippers.Product{
+			"COBBLESTONE": product("COBBLESTONE", 2, 1.8),
+			"DIAMOND":     product("DIAMOND", 8, 7),
+			"COAL":        product("COAL", 4, 3),
+			"CATALYST":    product("CATALYST", 100, 90),
+		},
+		Npc: map[string]float64{"COBBLESTONE": 1, "ODD_THING": 10},
+	}
+}
+
+const taxFactor = 1 - flippers.BazaarTax/100
+
+func TestCalculate(t *testing.T) {
+	// tier 2 harvests every 10s, so 8640 cobblestone a day without anything on it
+	tests := []struct {
+		name         string
+		conf         config.MinionConfig
+		wantCobble   float64 // cobblestone per day, 0 = no cobblestone minion in the results
+		wantMode     string
+		wantProfit   float64
+		wantHours    float64
+		wantCraft    float64
+		wantOddCount int
+	}{
+		{"highest tier, best way of selling", config.MinionConfig{}, 8640, SellOffer, 8640 * 2 * taxFactor, 192.0 / 8640 * 24, 480, 1},
+		{"tier 1", config.MinionConfig{Tier: 1}, 4320, SellOffer, 4320 * 2 * taxFactor, 64.0 / 4320 * 24, 160, 1},
+		{"minions without the tier are left out", config.MinionConfig{Tier: 2}, 8640, SellOffer, 8640 * 2 * taxFactor, 192.0 / 8640 * 24, 480, 0},
+		{"insta-sell", config.MinionConfig{SellMode: InstaSell}, 8640, InstaSell, 8640 * 1.8 * taxFactor, 192.0 / 8640 * 24, 480, 1},
+		{"npc", config.MinionConfig{SellMode: SellNpc}, 8640, SellNpc, 8640, 192.0 / 8640 * 24, 480, 1},
+		// 4 coins every half hour
+		{"speed fuel", config.MinionConfig{Fuel: "COAL"}, 10800, SellOffer, 10800*2*taxFactor - 192, 192.0 / 10800 * 24, 480, 1},
+		{"catalyst", config.MinionConfig{Fuel: "CATALYST"}, 25920, SellOffer, 25920*2*taxFactor - 800, 192.0 / 25920 * 24, 480, 1},
+		{"speed upgrade", config.MinionConfig{Upgrades: []string{"FLYCATCHER"}}, 10368, SellOffer, 10368 * 2 * taxFactor, 192.0 / 10368 * 24, 480, 1},
+		// 864 diamonds on top take up storage too
+		{"extra drops", config.MinionConfig{Upgrades: []string{"DIAMOND_SPREADING"}}, 8640, SellOffer, (8640*2 + 864*8) * taxFactor, 192.0 / 9504 * 24, 480, 1},
+		{"storage", config.MinionConfig{Storage: "LARGE"}, 8640, SellOffer, 8640 * 2 * taxFactor, 960.0 / 8640 * 24, 480, 1},
+		// full after 32 minutes, then idle until the user is back a day later
+		{"collected once a day", config.MinionConfig{CollectEveryHours: 24}, 192, SellOffer, 192 * 2 * taxFactor, 192.0 / 8640 * 24, 480, 1},
+		{"collected before it's full", config.MinionConfig{CollectEveryHours: 0.5}, 8640, SellOffer, 8640 * 2 * taxFactor, 192.0 / 8640 * 24, 480, 1},
+		{"excluded by what it drops", config.MinionConfig{ExcludeItems: []string{"COBBLESTONE"}}, 0, "", 0, 0, 0, 1},
+		{"excluded by id", config.MinionConfig{ExcludeItems: []string{"ODD_GENERATOR"}}, 8640, SellOffer, 8640 * 2 * taxFactor, 192.0 / 8640 * 24, 480, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := testDefinitions().Calculate(testPrices(), &tt.conf)
+			if err != nil {
+				t.Fatalf("Calculate() err = %v", err)
+			}
+			var cobble *Result
+			odd := 0
+			for i := range results {
+				switch results[i].Id {
+				case "COBBLESTONE_GENERATOR":
+					cobble = &results[i]
+				case "ODD_GENERATOR":
+					odd++
+				}
+			}
+			expect(t, "odd minions", float64(odd), float64(tt.wantOddCount))
+			if tt.wantCobble == 0 {
+				if cobble != nil {
+					t.Errorf("got %+v, want no cobblestone minion", cobble)
+				}
+				return
+			}
+			if cobble == nil {
+				t.Fatal("no cobblestone minion in the results")
+			}
+			expect(t, "cobblestone per day", cobble.Drops[0].PerDay, tt.wantCobble)
+			if cobble.SellMode != tt.wantMode {
+				t.Errorf("SellMode = %s, want %s", cobble.SellMode, tt.wantMode)
+			}
+			expect(t, "ProfitPerDay", cobble.ProfitPerDay, tt.wantProfit)
+			expect(t, "HoursUntilFull", cobble.HoursUntilFull, tt.wantHours)
+			expect(t, "CraftCost", cobble.CraftCost, tt.wantCraft)
+			expect(t, "RoiPercentage", cobble.RoiPercentage, tt.wantProfit/tt.wantCraft*100)
+			expect(t, "PaybackDays", cobble.PaybackDays, tt.wantCraft/tt.wantProfit)
+		})
+	}
+}
+
+func TestCalculateNpcOnly(t *testing.T) {
+	results, err := testDefinitions().Calculate(testPrices(), &config.MinionConfig{SellMode: SellBest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortByRoi(results)
+	odd := results[len(results)-1]
+	if odd.Id != "ODD_GENERATOR" {
+		t.Fatalf("SortByRoi() put %s last, want the minion without a craft cost", odd.Id)
+	}
+	// 2880 harvests of half an item, and no bazaar to sell them on
+	for _, coins := range []float64{odd.CoinsPerDay.SellOffer, odd.CoinsPerDay.InstaSell, odd.CoinsPerDay.Npc} {
+		expect(t, "coins per day", coins, 14400)
+	}
+	expect(t, "CraftCost", odd.CraftCost, 0)
+	expect(t, "RoiPercentage", odd.RoiPercentage, 0)
+	expect(t, "PaybackDays", odd.PaybackDays, 0)
+
+	SortByProfit(results)
+	if results[0].Id != "COBBLESTONE_GENERATOR" {
+		t.Errorf("SortByProfit() put %s first", results[0].Id)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.MinionConfig
+		want string // in the error, "" = valid
+	}{
+		{"empty", config.MinionConfig{}, ""},
+		{"everything", config.MinionConfig{Fuel: "COAL", Upgrades: []string{"FLYCATCHER", "DIAMOND_SPREADING"}, Storage: "LARGE", SellMode: SellBest, CollectEveryHours: 12}, ""},
+		{"unknown fuel", config.MinionConfig{Fuel: "LAVA"}, "unknown fuel"},
+		{"unknown upgrade", config.MinionConfig{Upgrades: []string{"SUPER_COMPACTOR"}}, "unknown upgrade"},
+		{"too many upgrades", config.MinionConfig{Upgrades: []string{"FLYCATCHER", "FLYCATCHER", "FLYCATCHER"}}, "upgrade slots"},
+		{"unknown storage", config.MinionConfig{Storage: "HUGE"}, "unknown storage"},
+		{"unknown sell mode", config.MinionConfig{SellMode: "auction"}, "unknown sell mode"},
+		{"negative collection interval", config.MinionConfig{CollectEveryHours: -1}, "collect_every_hours"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testDefinitions().Validate(&tt.conf)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want %q", err, tt.want)
+			}
+			if _, err := testDefinitions().Calculate(testPrices(), &tt.conf); err == nil {
+				t.Error("Calculate() ran with an invalid config")
+			}
+		})
+	}
+}
+
+func expect(t *testing.T, field string, got float64, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
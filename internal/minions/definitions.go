@@ -0,0 +1,119 @@
+package minions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultDefinitionsFile where the minion definitions are expected if MINIONS_FILE isn't set.
+const DefaultDefinitionsFile = "data/minions.json"
+
+// SlotSize items one storage slot holds
+const SlotSize = 64
+
+// Drop what one harvest gives. Amount can be fractional for chance drops.
+type Drop struct {
+	Item   string  `json:"item"`
+	Amount float64 `json:"amount"`
+}
+
+// Tier one minion tier.
+type Tier struct {
+	Tier int `json:"tier"`
+	// SecondsPerAction between two actions. a harvest takes two actions (place, then break) for almost every minion
+	SecondsPerAction float64 `json:"seconds_per_action"`
+	// Slots storage slots before any storage chest
+	Slots int `json:"slots"`
+	// Craft what upgrading from the previous tier takes (the previous minion is consumed). Filled from the craft pattern if empty
+	Craft map[string]float64 `json:"craft"`
+}
+
+// Minion one minion type and all its tiers.
+type Minion struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Drops []Drop `json:"drops"`
+	// ActionsPerHarvest 2 for most, 1 for the ones that don't place anything (fishing...). 0 means 2
+	ActionsPerHarvest int    `json:"actions_per_harvest"`
+	Tiers             []Tier `json:"tiers"`
+	// CraftBase and CraftEnchanted the usual recipe shape: the base item for the first tiers, then the enchanted one
+	CraftBase      string `json:"craft_base"`
+	CraftEnchanted string `json:"craft_enchanted"`
+}
+
+// Fuel a minion fuel. Consumable fuels (DurationHours > 0) are bought again every DurationHours.
+type Fuel struct {
+	Name string `json:"name"`
+	// Speed extra speed, 0.25 = 25% faster
+	Speed float64 `json:"speed"`
+	// Multiplier drops are multiplied by this (catalysts). 0 means 1
+	Multiplier    float64 `json:"multiplier"`
+	DurationHours float64 `json:"duration_hours"`
+}
+
+// Upgrade a minion upgrade slot item.
+type Upgrade struct {
+	Name  string  `json:"name"`
+	Speed float64 `json:"speed"`
+	// Extra drops on top of the minion's own, per harvest (diamond spreading...)
+	Extra []Drop `json:"extra"`
+}
+
+// Storage a storage chest.
+type Storage struct {
+	Name  string `json:"name"`
+	Slots int    `json:"slots"`
+}
+
+// Definitions everything in the minions file.
+type Definitions struct {
+	// StandardCraftAmounts per tier, for minions with a craft pattern. the first BaseTiers use the base item, the rest the enchanted one
+	StandardCraftAmounts []float64          `json:"standard_craft_amounts"`
+	BaseTiers            int                `json:"base_tiers"`
+	Minions              []Minion           `json:"minions"`
+	Fuels                map[string]Fuel    `json:"fuels"`
+	Upgrades             map[string]Upgrade `json:"upgrades"`
+	Storages             map[string]Storage `json:"storages"`
+}
+
+// LoadDefinitions reads the minions file and fills in the pattern crafts.
+func LoadDefinitions(file string) (*Definitions, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var defs Definitions
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	if len(defs.Minions) == 0 {
+		return nil, errors.New("no minions in " + file)
+	}
+
+	for i := range defs.Minions {
+		m := &defs.Minions[i]
+		if m.ActionsPerHarvest <= 0 {
+			m.ActionsPerHarvest = 2
+		}
+		if len(m.Tiers) == 0 || len(m.Drops) == 0 {
+			return nil, fmt.Errorf("minion %s has no tiers or drops", m.Id)
+		}
+		for t := range m.Tiers {
+			tier := &m.Tiers[t]
+			if tier.SecondsPerAction <= 0 {
+				return nil, fmt.Errorf("minion %s tier %d has no speed", m.Id, tier.Tier)
+			}
+			if len(tier.Craft) > 0 || m.CraftBase == "" || t >= len(defs.StandardCraftAmounts) {
+				continue
+			}
+			item := m.CraftBase
+			if t >= defs.BaseTiers && m.CraftEnchanted != "" {
+				item = m.CraftEnchanted
+			}
+			tier.Craft = map[string]float64{item: defs.StandardCraftAmounts[t]}
+		}
+	}
+	return &defs, nil
+}
@@ -0,0 +1,254 @@
+package portfolio
+
+import (
+	"Hyflip-Server/internal/flippers"
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	// MaxOrderAmount is the most units one bazaar order can hold
+	MaxOrderAmount = 71680
+	// MaxSlots bazaar order slots you can have at most (with every upgrade)
+	MaxSlots = 35
+	// capitalBuckets how finely the purse is split for the knapsack. more = closer to optimal, slower
+	capitalBuckets = 400
+	// maxCandidates only the best flips (by expected profit at full size) go into the knapsack
+	maxCandidates = 300
+)
+
+// volumeSteps fractions of a flip's max volume the optimizer can pick. a flip either isn't taken or is taken at one of these
+var volumeSteps = []float64{0.25, 0.5, 0.75, 1}
+
+// Request what the user has to work with.
+type Request struct {
+	// Purse coins available for buy orders
+	Purse float64 `json:"purse"`
+	// Slots free bazaar order slots. every flip takes one (the buy order turns into the sell offer)
+	Slots int `json:"slots"`
+	// RiskTolerance 0 (only safe flips, spread out) to 1 (whatever makes the most)
+	RiskTolerance float64 `json:"riskTolerance"`
+	// HorizonHours how long until the user wants the coins back
+	HorizonHours float64 `json:"horizonHours"`
+}
+
+// Allocation is one flip of the plan.
+type Allocation struct {
+	ProductID     string  `json:"productId"`
+	Command       string  `json:"command"`
+	Volume        int     `json:"volume"`
+	BuyPrice      float64 `json:"buyPrice"`
+	SellPrice     float64 `json:"sellPrice"`
+	CapitalLocked float64 `json:"capitalLocked"`
+	// Profit if everything fills at the expected prices
+	Profit float64 `json:"profit"`
+	// ExpectedProfit Profit discounted by Risk
+	ExpectedProfit float64 `json:"expectedProfit"`
+	FillHours      float64 `json:"fillHours"`
+	// Risk 0-1, from competition and slippage
+	Risk float64 `json:"risk"`
+}
+
+// Plan is the best set of flips for a Request.
+type Plan struct {
+	Allocations    []Allocation `json:"allocations"`
+	ExpectedProfit float64      `json:"expectedProfit"`
+	CapitalLocked  float64      `json:"capitalLocked"`
+	// ExpectedReturnPercentage ExpectedProfit relative to CapitalLocked
+	ExpectedReturnPercentage float64 `json:"expectedReturnPercentage"`
+	SlotsUsed                int     `json:"slotsUsed"`
+	// ConsideredFlips how many flips were usable at all
+	ConsideredFlips int `json:"consideredFlips"`
+}
+
+// option one way of taking a flip: how much, what it costs and what it (probably) makes.
+type option struct {
+	volume   int
+	capital  float64
+	cost     int // capital in buckets, rounded up so the purse is never overspent
+	profit   float64
+	expected float64
+}
+
+type candidate struct {
+	flip      *flippers.BazaarFoundFlip
+	unitBuy   float64
+	unitSell  float64
+	fillHours float64
+	risk      float64
+	options   []option
+}
+
+// Validate rejects requests the optimizer can't do anything with.
+func (r *Request) Validate() error {
+	switch {
+	case r.Purse <= 0:
+		return errors.New("purse has to be positive")
+	case r.Slots <= 0 || r.Slots > MaxSlots:
+		return errors.New("slots has to be between 1 and 35")
+	case r.RiskTolerance < 0 || r.RiskTolerance > 1:
+		return errors.New("riskTolerance has to be between 0 and 1")
+	case r.HorizonHours <= 0:
+		return errors.New("horizonHours has to be positive")
+	}
+	return nil
+}
+
+// Optimize picks the flips and volumes that make the most expected profit without going over the purse or the slots. It's a
+// multiple-choice knapsack: each flip is a group (not taken, or taken at one of volumeSteps), each taken flip costs one slot and
+// its capital.
+func Optimize(flips []flippers.BazaarFoundFlip, req Request) (*Plan, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	bucketSize := req.Purse / capitalBuckets
+	candidates := buildCandidates(flips, req, bucketSize)
+	plan := &Plan{Allocations: make([]Allocation, 0), ConsideredFlips: len(candidates)}
+	if len(candidates) == 0 {
+		return plan, nil
+	}
+
+	slots := min(req.Slots, len(candidates))
+	// best[s][b] best expected profit with s slots and b buckets used. choice[i][s][b] which option of candidate i got there (-1 = skipped)
+	best := make([][]float64, slots+1)
+	for s := range best {
+		best[s] = make([]float64, capitalBuckets+1)
+	}
+	choice := make([][][]int8, len(candidates))
+
+	for i, c := range candidates {
+		choice[i] = make([][]int8, slots+1)
+		for s := range choice[i] {
+			choice[i][s] = make([]int8, capitalBuckets+1)
+			for b := range choice[i][s] {
+				choice[i][s][b] = -1
+			}
+		}
+		// backwards so every candidate is used at most once (0/1 knapsack trick)
+		for s := slots; s >= 1; s-- {
+			for b := capitalBuckets; b >= 0; b-- {
+				for o, opt := range c.options {
+					if opt.cost > b {
+						continue
+					}
+					if v := best[s-1][b-opt.cost] + opt.expected; v > best[s][b] {
+						best[s][b] = v
+						choice[i][s][b] = int8(o)
+					}
+				}
+			}
+		}
+	}
+
+	// walk back from the best end state
+	s, b := slots, capitalBuckets
+	for i := len(candidates) - 1; i >= 0 && s > 0; i-- {
+		o := choice[i][s][b]
+		if o < 0 {
+			continue
+		}
+		c, opt := candidates[i], candidates[i].options[o]
+		plan.Allocations = append(plan.Allocations, Allocation{
+			ProductID:      c.flip.ProductID,
+			Command:        c.flip.Command,
+			Volume:         opt.volume,
+			BuyPrice:       c.unitBuy,
+			SellPrice:      c.unitSell,
+			CapitalLocked:  opt.capital,
+			Profit:         opt.profit,
+			ExpectedProfit: opt.expected,
+			FillHours:      c.fillHours * float64(opt.volume) / float64(c.options[len(c.options)-1].volume),
+			Risk:           c.risk,
+		})
+		plan.ExpectedProfit += opt.expected
+		plan.CapitalLocked += opt.capital
+		s, b = s-1, b-opt.cost
+	}
+
+	sort.Slice(plan.Allocations, func(i, j int) bool {
+		return plan.Allocations[i].ExpectedProfit > plan.Allocations[j].ExpectedProfit
+	})
+	plan.SlotsUsed = len(plan.Allocations)
+	if plan.CapitalLocked > 0 {
+		plan.ExpectedReturnPercentage = plan.ExpectedProfit / plan.CapitalLocked * 100
+	}
+	return plan, nil
+}
+
+// buildCandidates turns flips into knapsack groups, dropping the ones that can't make money within the request.
+func buildCandidates(flips []flippers.BazaarFoundFlip, req Request, bucketSize float64) []candidate {
+	taxFactor := 1 - flippers.BazaarTax/100.0
+	// low tolerance = no single flip gets most of the purse
+	maxShare := 0.25 + 0.75*req.RiskTolerance
+
+	candidates := make([]candidate, 0, len(flips))
+	for i := range flips {
+		f := &flips[i]
+		unitBuy, unitSell := f.BuyFillPrice, f.SellFillPrice
+		if unitBuy <= 0 || unitSell <= 0 {
+			// flip from before the order book model, use the top of the book
+			unitBuy, unitSell = f.SellPrice, f.BuyPrice
+		}
+		unitProfit := unitSell*taxFactor - unitBuy
+		if unitProfit <= 0 || unitBuy <= 0 {
+			continue
+		}
+
+		// both legs, one after the other, have to fit in the horizon
+		instaSellRate := float64(f.SellMovingWeek) / (7 * 24)
+		instaBuyRate := float64(f.BuyMovingWeek) / (7 * 24)
+		if instaSellRate <= 0 || instaBuyRate <= 0 {
+			continue
+		}
+		hoursPerUnit := 1/instaSellRate + 1/instaBuyRate
+		maxVolume := int(req.HorizonHours / hoursPerUnit)
+		maxVolume = min(maxVolume, MaxOrderAmount, int(req.Purse*maxShare/unitBuy))
+		if maxVolume <= 0 {
+			continue
+		}
+
+		risk := flipRisk(f)
+		discount := 1 - (1-req.RiskTolerance)*risk
+		c := candidate{flip: f, unitBuy: unitBuy, unitSell: unitSell, fillHours: float64(maxVolume) * hoursPerUnit, risk: risk}
+		lastVolume := 0
+		for _, step := range volumeSteps {
+			volume := int(math.Round(float64(maxVolume) * step))
+			if volume <= lastVolume {
+				continue // tiny max volumes round several steps to the same thing
+			}
+			lastVolume = volume
+			capital := float64(volume) * unitBuy
+			profit := float64(volume) * unitProfit
+			c.options = append(c.options, option{
+				volume:   volume,
+				capital:  capital,
+				cost:     int(math.Ceil(capital / bucketSize)),
+				profit:   profit,
+				expected: profit * discount,
+			})
+		}
+		candidates = append(candidates, c)
+	}
+
+	// the dp is slots*buckets per candidate, keep the ones that could matter
+	if len(candidates) > maxCandidates {
+		sort.Slice(candidates, func(i, j int) bool {
+			return lastOption(candidates[i]).expected > lastOption(candidates[j]).expected
+		})
+		candidates = candidates[:maxCandidates]
+	}
+	return candidates
+}
+
+func lastOption(c candidate) option {
+	return c.options[len(c.options)-1]
+}
+
+// flipRisk 0-1. order wars and thin books are what make flips go wrong
+func flipRisk(f *flippers.BazaarFoundFlip) float64 {
+	competition := f.CompetitionScore / 100
+	slippage := min(f.SlippagePercentage/10, 1) // 10% slippage is as bad as it gets
+	return min(max(0.5*competition+0.5*slippage, 0), 1)
+}
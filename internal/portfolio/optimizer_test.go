@@ -0,0 +1,107 @@
+package portfolio
+
+import (
+	"Hyflip-Server/internal/flippers"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// flip a risk-free flip: buy orders at unitBuy, sell offers making unitProfit per unit after tax. hoursPerUnit how long one
+// unit takes through both legs.
+func flip(id string, unitBuy float64, unitProfit float64, hoursPerUnit float64) flippers.BazaarFoundFlip {
+	movingWeek := int(math.Round(2 * 7 * 24 / hoursPerUnit))
+	return flippers.BazaarFoundFlip{
+		ProductID:      id,
+		SellPrice:      unitBuy,
+		BuyPrice:       (unitBuy + unitProfit) / (1 - flippers.BazaarTax/100.0),
+		SellMovingWeek: movingWeek,
+		BuyMovingWeek:  movingWeek,
+	}
+}
+
+func TestOptimizeKnownOptimum(t *testing.T) {
+	flips := []flippers.BazaarFoundFlip{
+		flip("A", 400, 200, 0.001), // the whole purse for 200
+		flip("B", 100, 60, 0.001),  // up to 4 units, 240 at full size
+		flip("C", 100, 70, 2),      // best per coin but only 1 unit fits in the horizon
+		flip("D", 100, -10, 0.001), // loses money
+	}
+	// a bucket is 1 coin, so the only rounding is the float prices
+	plan, err := Optimize(flips, Request{Purse: 400, Slots: 2, RiskTolerance: 1, HorizonHours: 2})
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+
+	// taking B at full size makes 240, B at 3 with C makes 250
+	want := map[string]int{"B": 3, "C": 1}
+	if len(plan.Allocations) != len(want) {
+		t.Fatalf("Optimize() allocations = %+v, want %v", plan.Allocations, want)
+	}
+	for _, a := range plan.Allocations {
+		if want[a.ProductID] != a.Volume {
+			t.Errorf("Optimize() took %s x%d, want %v", a.ProductID, a.Volume, want)
+		}
+	}
+	if math.Abs(plan.ExpectedProfit-250) > 1e-6 {
+		t.Errorf("ExpectedProfit = %v, want 250", plan.ExpectedProfit)
+	}
+	if math.Abs(plan.CapitalLocked-400) > 1e-6 {
+		t.Errorf("CapitalLocked = %v, want 400", plan.CapitalLocked)
+	}
+	if plan.ConsideredFlips != 3 || plan.SlotsUsed != 2 {
+		t.Errorf("ConsideredFlips = %d, SlotsUsed = %d, want 3 and 2", plan.ConsideredFlips, plan.SlotsUsed)
+	}
+	if plan.Allocations[0].ExpectedProfit < plan.Allocations[1].ExpectedProfit {
+		t.Errorf("allocations aren't sorted by expected profit: %+v", plan.Allocations)
+	}
+}
+
+// TestOptimizeMatchesBruteForce random small markets, the dp has to find what trying every combination finds and never
+// spend more than the purse.
+func TestOptimizeMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		flips := make([]flippers.BazaarFoundFlip, 1+rng.Intn(5))
+		for i := range flips {
+			f := flip(string(rune('A'+i)), 10+rng.Float64()*990, rng.Float64()*200-20, 0.01+rng.Float64())
+			f.CompetitionScore = rng.Float64() * 100
+			f.SlippagePercentage = rng.Float64() * 10
+			flips[i] = f
+		}
+		req := Request{Purse: 100 + rng.Float64()*20_000, Slots: 1 + rng.Intn(4), RiskTolerance: rng.Float64(), HorizonHours: 1 + rng.Float64()*48}
+
+		plan, err := Optimize(flips, req)
+		if err != nil {
+			t.Fatalf("Optimize() error = %v", err)
+		}
+		if plan.CapitalLocked > req.Purse {
+			t.Fatalf("round %d: CapitalLocked %v > Purse %v", round, plan.CapitalLocked, req.Purse)
+		}
+		if plan.SlotsUsed > req.Slots {
+			t.Fatalf("round %d: SlotsUsed %d > Slots %d", round, plan.SlotsUsed, req.Slots)
+		}
+
+		candidates := buildCandidates(flips, req, req.Purse/capitalBuckets)
+		if want := bruteForce(candidates, 0, req.Slots, capitalBuckets); math.Abs(plan.ExpectedProfit-want) > 1e-6 {
+			t.Fatalf("round %d: ExpectedProfit = %v, brute force found %v", round, plan.ExpectedProfit, want)
+		}
+	}
+}
+
+// bruteForce best expected profit from candidates[i:] with the slots and buckets left.
+func bruteForce(candidates []candidate, i int, slots int, buckets int) float64 {
+	if i == len(candidates) {
+		return 0
+	}
+	best := bruteForce(candidates, i+1, slots, buckets)
+	if slots == 0 {
+		return best
+	}
+	for _, opt := range candidates[i].options {
+		if opt.cost <= buckets {
+			best = max(best, opt.expected+bruteForce(candidates, i+1, slots-1, buckets-opt.cost))
+		}
+	}
+	return best
+}
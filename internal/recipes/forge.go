@@ -0,0 +1,65 @@
+package recipes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultForgeFile where the forge recipes are expected if FORGE_RECIPES_FILE isn't set.
+const DefaultForgeFile = "data/forge_recipes.json"
+
+// ForgeRecipe one Dwarven forge recipe. Ingredients use bazaar style ids like crafting recipes do.
+type ForgeRecipe struct {
+	Output      string             `json:"output"`
+	Name        string             `json:"name"`
+	Count       int                `json:"count"`
+	Duration    time.Duration      `json:"-"`
+	Ingredients map[string]float64 `json:"ingredients"`
+	// Coins the forge charges on top of the ingredients (perfect gems...)
+	Coins float64 `json:"coins"`
+}
+
+type forgeRecipeFile struct {
+	ForgeRecipe
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// LoadForgeRecipes reads the forge recipes file. Unlike the NEU repo this one's ours, so a broken entry is an error.
+func LoadForgeRecipes(file string) ([]ForgeRecipe, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw []forgeRecipeFile
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("no forge recipes in " + file)
+	}
+
+	forgeRecipes := make([]ForgeRecipe, 0, len(raw))
+	for i, r := range raw {
+		switch {
+		case r.Output == "":
+			return nil, fmt.Errorf("forge recipe %d has no output", i)
+		case r.DurationSeconds <= 0:
+			return nil, fmt.Errorf("forge recipe %s has no duration", r.Output)
+		case len(r.Ingredients) == 0:
+			return nil, fmt.Errorf("forge recipe %s has no ingredients", r.Output)
+		}
+		recipe := r.ForgeRecipe
+		recipe.Duration = time.Duration(r.DurationSeconds) * time.Second
+		if recipe.Count <= 0 {
+			recipe.Count = 1
+		}
+		if recipe.Name == "" {
+			recipe.Name = recipe.Output
+		}
+		forgeRecipes = append(forgeRecipes, recipe)
+	}
+	return forgeRecipes, nil
+}
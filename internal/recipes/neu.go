@@ -0,0 +1,148 @@
+package recipes
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRepoDir where the NEU repo (github.com/NotEnoughUpdates/NotEnoughUpdates-REPO) is expected if NEU_REPO_DIR isn't set.
+const DefaultRepoDir = "data/neu-repo"
+
+// craftingSlots the 3x3 grid, NEU style
+var craftingSlots = []string{"A1", "A2", "A3", "B1", "B2", "B3", "C1", "C2", "C3"}
+
+// Recipe one crafting table recipe. Ingredients are summed over the grid.
+type Recipe struct {
+	Output      string             `json:"output"`
+	Count       int                `json:"count"`
+	Ingredients map[string]float64 `json:"ingredients"`
+}
+
+// neuItem the parts of a NEU repo item file we care about.
+type neuItem struct {
+	InternalName string           `json:"internalname"`
+	DisplayName  string           `json:"displayname"`
+	Recipe       map[string]any   `json:"recipe"`
+	Recipes      []map[string]any `json:"recipes"`
+}
+
+// Book every crafting recipe we know, by output item id (bazaar style, see BazaarId). Items with more than one recipe keep all of them.
+type Book struct {
+	Recipes map[string][]Recipe
+	// Names display names (colour codes stripped) by item id
+	Names map[string]string
+}
+
+// LoadNeuRepo reads every items/*.json of a NEU repo checkout. Files that don't parse are skipped and logged, one broken item
+// shouldn't take every craft flip down.
+func LoadNeuRepo(dir string) (*Book, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "items", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no items found in " + filepath.Join(dir, "items"))
+	}
+
+	book := &Book{Recipes: make(map[string][]Recipe), Names: make(map[string]string)}
+	broken := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			broken++
+			continue
+		}
+		var item neuItem
+		if err := json.Unmarshal(data, &item); err != nil || item.InternalName == "" {
+			broken++
+			continue
+		}
+
+		id := BazaarId(item.InternalName)
+		book.Names[id] = StripColours(item.DisplayName)
+		if r, ok := parseCrafting(id, item.Recipe); ok {
+			book.Recipes[id] = append(book.Recipes[id], r)
+		}
+		for _, raw := range item.Recipes {
+			if t, _ := raw["type"].(string); t != "" && t != "crafting" {
+				continue // forge, npc shops, trades... not a crafting table
+			}
+			output := id
+			if override, _ := raw["overrideOutputId"].(string); override != "" {
+				output = BazaarId(override)
+			}
+			if r, ok := parseCrafting(output, raw); ok {
+				book.Recipes[output] = append(book.Recipes[output], r)
+			}
+		}
+	}
+	if broken > 0 {
+		log.Printf("Skipped %d NEU repo items that could not be read.\n", broken)
+	}
+	return book, nil
+}
+
+// parseCrafting a NEU grid recipe ("A1": "ENCHANTED_DIAMOND:32", ..., optionally "count").
+func parseCrafting(output string, raw map[string]any) (Recipe, bool) {
+	if len(raw) == 0 {
+		return Recipe{}, false
+	}
+	r := Recipe{Output: output, Count: 1, Ingredients: make(map[string]float64)}
+	if count, ok := raw["count"].(float64); ok && count >= 1 {
+		r.Count = int(count)
+	}
+	for _, slot := range craftingSlots {
+		s, _ := raw[slot].(string)
+		if s == "" {
+			continue
+		}
+		id, amount, ok := ParseIngredient(s)
+		if !ok {
+			return Recipe{}, false
+		}
+		r.Ingredients[id] += amount
+	}
+	return r, len(r.Ingredients) > 0
+}
+
+// ParseIngredient "ENCHANTED_DIAMOND:32" -> ENCHANTED_DIAMOND, 32. The amount is optional (1).
+func ParseIngredient(s string) (string, float64, bool) {
+	s = strings.TrimSpace(s)
+	id, rawAmount, found := strings.Cut(s, ":")
+	if !found {
+		return BazaarId(id), 1, id != ""
+	}
+	amount, err := strconv.ParseFloat(rawAmount, 64)
+	if err != nil || amount <= 0 || id == "" {
+		return "", 0, false
+	}
+	return BazaarId(id), amount, true
+}
+
+// BazaarId NEU writes item metadata with a dash (INK_SACK-4), the bazaar with a colon (INK_SACK:4).
+func BazaarId(neuId string) string {
+	return strings.ReplaceAll(neuId, "-", ":")
+}
+
+// StripColours removes minecraft § colour codes.
+func StripColours(s string) string {
+	var sb strings.Builder
+	skip := false
+	for _, r := range s {
+		if skip {
+			skip = false
+			continue
+		}
+		if r == '§' {
+			skip = true
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -3,18 +3,29 @@ package routes
 import (
 	"Hyflip-Server/internal/api"
 	"Hyflip-Server/internal/cache"
+	"Hyflip-Server/internal/flippers"
 	"Hyflip-Server/internal/handlers"
+	"Hyflip-Server/internal/minions"
 	"Hyflip-Server/internal/storage"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"time"
 )
 
-func RegisterRoutes(e *echo.Echo, userDb *storage.DatabaseClient, hypixelApi *api.HypixelApiClient, configTable *storage.ConfigTableClient, bzCache *cache.BazaarCache) {
+func RegisterRoutes(e *echo.Echo, userDb *storage.DatabaseClient, hypixelApi *api.HypixelApiClient, configTable *storage.ConfigTableClient, historyTable *storage.BazaarHistoryTable, bzCache *cache.BazaarCache, flipCaches *cache.Registry, items *flippers.ItemCatalog, minionDefs *minions.Definitions) {
+	if items == nil {
+		items = flippers.NewItemCatalog(hypixelApi)
+	}
 	reqStruct := &handlers.FlipperStructs{
 		Api:         hypixelApi,
+		Mojang:      api.NewMojangResolver(hypixelApi, 10000, 6*time.Hour, 10*time.Minute),
 		UsersTable:  userDb,
 		ConfigTable: configTable,
+		History:     historyTable,
 		BzCache:     bzCache,
+		Flippers:    flipCaches,
+		Items:       items,
+		Minions:     minionDefs,
 	}
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -25,5 +36,17 @@ func RegisterRoutes(e *echo.Echo, userDb *storage.DatabaseClient, hypixelApi *ap
 	e.POST("/create_account", handlers.CreateAccountPostHandler(&handlers.RegisteredPlayers{}, reqStruct))
 	protected := e.Group("/api/")
 	protected.Use(handlers.AuthMiddleware(reqStruct))
-	protected.GET("bzflips", handlers.GetBzFlipsHandler(reqStruct))
+	// /api/bzflips, /api/craftflips...
+	for _, flips := range flipCaches.All() {
+		protected.GET(flips.Name()+"flips", handlers.GetFlipsHandler(reqStruct, flips))
+	}
+	protected.GET("config/bz", handlers.GetBzConfigHandler(reqStruct))
+	protected.PUT("config/bz", handlers.UpdateBzConfigHandler(reqStruct))
+	protected.GET("portfolio", handlers.GetPortfolioHandler(reqStruct))
+	protected.GET("forge", handlers.GetForgeHandler(reqStruct))
+	protected.GET("minions", handlers.GetMinionsHandler(reqStruct))
+	protected.POST("backtest", handlers.PostBacktestHandler(reqStruct))
+	protected.POST("backtest/tune", handlers.PostTuneHandler(reqStruct))
+	protected.GET("manipulated", handlers.GetManipulatedHandler(reqStruct))
+	protected.GET("manipulated/stream", handlers.GetManipulatedStreamHandler(reqStruct))
 }
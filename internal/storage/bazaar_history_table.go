@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"Hyflip-Server/internal/api"
+	"Hyflip-Server/internal/flippers"
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// every bazaar poll, one row per product. partitioned by day so old days can be dropped instead of deleted row by row.
+// two statements, fine since it's run without arguments (simple protocol)
+const CreateBazaarHistoryTableQuery = `
+CREATE TABLE IF NOT EXISTS bazaar_history (
+    product_id TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL,
+    buy_price DOUBLE PRECISION NOT NULL,
+    sell_price DOUBLE PRECISION NOT NULL,
+    buy_volume BIGINT NOT NULL,
+    sell_volume BIGINT NOT NULL,
+    buy_moving_week BIGINT NOT NULL,
+    sell_moving_week BIGINT NOT NULL,
+    buy_orders INT NOT NULL,
+    sell_orders INT NOT NULL,
+    PRIMARY KEY (product_id, recorded_at)
+) PARTITION BY RANGE (recorded_at);
+
+-- snapshots/backtests go by time alone, which the primary key (product first) can't help with. indexes on a partitioned
+-- table end up on every partition, including the ones created later
+CREATE INDEX IF NOT EXISTS bazaar_history_recorded_at ON bazaar_history (recorded_at);
+`
+
+// partition names are generated by us (bazaar_history_YYYYMMDD), never user input, so building these with Sprintf is fine
+const CreateBazaarHistoryPartitionQuery = `
+CREATE TABLE IF NOT EXISTS %s PARTITION OF bazaar_history FOR VALUES FROM ('%s') TO ('%s');
+`
+
+const ListBazaarHistoryPartitionsQuery = `
+SELECT child.relname FROM pg_inherits
+JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
+JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+WHERE parent.relname = 'bazaar_history';
+`
+
+// one round trip per snapshot. the same lastUpdated polled twice is skipped by the primary key
+const InsertBazaarSnapshotQuery = `
+INSERT INTO bazaar_history (product_id, recorded_at, buy_price, sell_price, buy_volume, sell_volume, buy_moving_week, sell_moving_week, buy_orders, sell_orders)
+SELECT product_id, $1, buy_price, sell_price, buy_volume, sell_volume, buy_moving_week, sell_moving_week, buy_orders, sell_orders
+FROM unnest($2::text[], $3::float8[], $4::float8[], $5::bigint[], $6::bigint[], $7::bigint[], $8::bigint[], $9::int[], $10::int[])
+    AS t(product_id, buy_price, sell_price, buy_volume, sell_volume, buy_moving_week, sell_moving_week, buy_orders, sell_orders)
+ON CONFLICT DO NOTHING;
+`
+
+// averaged over buckets of $4 seconds, a week of 20s polls is way more than the manipulation check needs
+const GetBazaarHistoryQuery = `
+SELECT to_timestamp(floor(extract(epoch FROM recorded_at) / $4) * $4) AS bucket, avg(buy_price), avg(sell_price)
+FROM bazaar_history
+WHERE product_id = $1 AND recorded_at >= $2 AND recorded_at <= $3
+GROUP BY bucket
+ORDER BY bucket;
+`
+
+// every product of every poll in the range, poll by poll
+const GetBazaarSnapshotsQuery = `
+SELECT product_id, recorded_at, buy_price, sell_price, buy_volume, sell_volume, buy_moving_week, sell_moving_week, buy_orders, sell_orders
+FROM bazaar_history
+WHERE recorded_at >= $1 AND recorded_at <= $2
+ORDER BY recorded_at;
+`
+
+const BazaarProductFirstRecordedQuery = `
+SELECT min(recorded_at) FROM bazaar_history WHERE product_id = $1;
+`
+
+const (
+	// partitionLayout is how partition names encode their day.
+	partitionLayout = "20060102"
+	// historyBucket price history is served in averages over this long
+	historyBucket = 10 * time.Minute
+)
+
+// BazaarHistoryTable records every bazaar poll and serves it back as price history (it's an api.PriceHistorySource).
+type BazaarHistoryTable struct {
+	pool *pgxpool.Pool
+	// Retention partitions older than this are dropped. 0 keeps everything
+	Retention time.Duration
+
+	lock sync.Mutex
+	// partitions days we already made sure exist
+	partitions map[string]bool
+	// firstRecorded when a product's oldest row was recorded, for products that have any. forgotten when retention drops
+	// partitions
+	firstRecorded map[string]time.Time
+}
+
+// InitBazaarHistoryTable initializes BazaarHistoryTable
+func InitBazaarHistoryTable(cl *DatabaseClient, retention time.Duration) *BazaarHistoryTable {
+	ctx, cancel := getContext()
+	defer cancel()
+
+	_, err := cl.pool.Exec(ctx, CreateBazaarHistoryTableQuery)
+	if err != nil {
+		panic("Unable to create bazaar_history table: " + err.Error())
+	}
+
+	return &BazaarHistoryTable{
+		pool:          cl.pool,
+		Retention:     retention,
+		partitions:    make(map[string]bool),
+		firstRecorded: make(map[string]time.Time),
+	}
+}
+
+// RecordBazaar saves one poll. Implements flippers.SnapshotRecorder.
+func (t *BazaarHistoryTable) RecordBazaar(ctx context.Context, at time.Time, products map[string]flippers.Product) error {
+	if err := t.ensurePartition(ctx, at); err != nil {
+		return err
+	}
+
+	n := len(products)
+	var (
+		ids            = make([]string, 0, n)
+		buyPrices      = make([]float64, 0, n)
+		sellPrices     = make([]float64, 0, n)
+		buyVolumes     = make([]int64, 0, n)
+		sellVolumes    = make([]int64, 0, n)
+		buyMovingWeek  = make([]int64, 0, n)
+		sellMovingWeek = make([]int64, 0, n)
+		buyOrders      = make([]int32, 0, n)
+		sellOrders     = make([]int32, 0, n)
+	)
+	for id, p := range products {
+		qs := p.QuickStatus
+		ids = append(ids, id)
+		buyPrices = append(buyPrices, qs.BuyPrice)
+		sellPrices = append(sellPrices, qs.SellPrice)
+		buyVolumes = append(buyVolumes, int64(qs.BuyVolume))
+		sellVolumes = append(sellVolumes, int64(qs.SellVolume))
+		buyMovingWeek = append(buyMovingWeek, int64(qs.BuyMovingWeek))
+		sellMovingWeek = append(sellMovingWeek, int64(qs.SellMovingWeek))
+		buyOrders = append(buyOrders, int32(qs.BuyOrders))
+		sellOrders = append(sellOrders, int32(qs.SellOrders))
+	}
+
+	_, err := t.pool.Exec(ctx, InsertBazaarSnapshotQuery, at, ids, buyPrices, sellPrices, buyVolumes, sellVolumes, buyMovingWeek, sellMovingWeek, buyOrders, sellOrders)
+	return err
+}
+
+// History returns the recorded buy/sell prices of a product between from and to, averaged over historyBucket. Not covered
+// until we've recorded the product since `from`, a few minutes of it after a deploy would make for a useless history.
+// Implements api.PriceHistorySource.
+func (t *BazaarHistoryTable) History(ctx context.Context, itemId string, from time.Time, to time.Time) ([]api.TimedPricePoint, bool, error) {
+	first, ok, err := t.firstRecordedAt(ctx, itemId)
+	if err != nil || !ok || first.After(from.Add(historyBucket)) {
+		return nil, false, err
+	}
+
+	rows, err := t.pool.Query(ctx, GetBazaarHistoryQuery, itemId, from, to, historyBucket.Seconds())
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	points := make([]api.TimedPricePoint, 0)
+	for rows.Next() {
+		var point api.TimedPricePoint
+		if err := rows.Scan(&point.At, &point.Buy, &point.Sell); err != nil {
+			return nil, true, err
+		}
+		points = append(points, point)
+	}
+	return points, true, rows.Err()
+}
+
+// ReplayBazaar hands every poll recorded between from and to to `fn`, oldest first, as RecordBazaar was given it (minus the
+// order books, those aren't recorded). Rows are streamed so only one poll is in memory at a time. An error from fn stops it.
+func (t *BazaarHistoryTable) ReplayBazaar(ctx context.Context, from time.Time, to time.Time, fn func(at time.Time, products map[string]flippers.Product) error) error {
+	rows, err := t.pool.Query(ctx, GetBazaarSnapshotsQuery, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		at       time.Time
+		products map[string]flippers.Product
+	)
+	for rows.Next() {
+		var (
+			id                                                   string
+			recordedAt                                           time.Time
+			qs                                                   flippers.QuickStatus
+			buyVolume, sellVolume, buyMovingWeek, sellMovingWeek int64
+			buyOrders, sellOrders                                int32
+		)
+		if err := rows.Scan(&id, &recordedAt, &qs.BuyPrice, &qs.SellPrice, &buyVolume, &sellVolume, &buyMovingWeek, &sellMovingWeek, &buyOrders, &sellOrders); err != nil {
+			return err
+		}
+		if !recordedAt.Equal(at) {
+			if products != nil {
+				if err := fn(at, products); err != nil {
+					return err
+				}
+			}
+			at, products = recordedAt, make(map[string]flippers.Product, len(products))
+		}
+
+		qs.ProductID = id
+		qs.BuyVolume, qs.SellVolume = int(buyVolume), int(sellVolume)
+		qs.BuyMovingWeek, qs.SellMovingWeek = int(buyMovingWeek), int(sellMovingWeek)
+		qs.BuyOrders, qs.SellOrders = int(buyOrders), int(sellOrders)
+		products[id] = flippers.Product{ProductID: id, QuickStatus: qs}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if products != nil {
+		return fn(at, products)
+	}
+	return nil
+}
+
+// firstRecordedAt when we first recorded the product, ok false if never. Only asks the db once per product that has rows.
+func (t *BazaarHistoryTable) firstRecordedAt(ctx context.Context, itemId string) (time.Time, bool, error) {
+	t.lock.Lock()
+	first, ok := t.firstRecorded[itemId]
+	t.lock.Unlock()
+	if ok {
+		return first, true, nil
+	}
+
+	var oldest *time.Time
+	if err := t.pool.QueryRow(ctx, BazaarProductFirstRecordedQuery, itemId).Scan(&oldest); err != nil || oldest == nil {
+		return time.Time{}, false, err
+	}
+	t.lock.Lock()
+	t.firstRecorded[itemId] = *oldest
+	t.lock.Unlock()
+	return *oldest, true, nil
+}
+
+// ensurePartition creates the partition for `at`'s day (and tomorrow's, so midnight never races us). New days also trigger retention.
+func (t *BazaarHistoryTable) ensurePartition(ctx context.Context, at time.Time) error {
+	day := at.UTC().Truncate(24 * time.Hour)
+	name := day.Format(partitionLayout)
+
+	t.lock.Lock()
+	exists := t.partitions[name]
+	t.lock.Unlock()
+	if exists {
+		return nil
+	}
+
+	for _, d := range []time.Time{day, day.Add(24 * time.Hour)} {
+		// bounds carry their offset, a bare date would be read in the session's time zone
+		query := fmt.Sprintf(CreateBazaarHistoryPartitionQuery, "bazaar_history_"+d.Format(partitionLayout), d.Format(time.RFC3339), d.Add(24*time.Hour).Format(time.RFC3339))
+		if _, err := t.pool.Exec(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	t.lock.Lock()
+	t.partitions[name] = true
+	t.lock.Unlock()
+
+	if t.Retention > 0 {
+		if err := t.dropPartitionsBefore(ctx, day.Add(-t.Retention)); err != nil {
+			log.Println("Could not drop old bazaar_history partitions. Error: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// dropPartitionsBefore drops every daily partition that ends before `cutoff`.
+func (t *BazaarHistoryTable) dropPartitionsBefore(ctx context.Context, cutoff time.Time) error {
+	rows, err := t.pool.Query(ctx, ListBazaarHistoryPartitionsQuery)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		day, err := time.Parse(partitionLayout, strings.TrimPrefix(name, "bazaar_history_"))
+		if err != nil || !day.Add(24*time.Hour).Before(cutoff) {
+			continue
+		}
+		if _, err := t.pool.Exec(ctx, "DROP TABLE IF EXISTS "+name+";"); err != nil {
+			return err
+		}
+		log.Println("Dropped bazaar history partition " + name + ".")
+
+		// the oldest rows of some products just went with it
+		t.lock.Lock()
+		clear(t.firstRecorded)
+		t.lock.Unlock()
+	}
+	return nil
+}
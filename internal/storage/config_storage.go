@@ -18,12 +18,29 @@ CREATE TABLE IF NOT EXISTS user_configs (
 );
 `
 
+// configs from before craft/npc/forge flips and minions don't have these. '{}' is filled with the defaults when read
+const AddCraftConfigColumnQuery = `
+ALTER TABLE user_configs ADD COLUMN IF NOT EXISTS craftconfig JSONB NOT NULL DEFAULT '{}'::jsonb;
+`
+
+const AddNpcConfigColumnQuery = `
+ALTER TABLE user_configs ADD COLUMN IF NOT EXISTS npcconfig JSONB NOT NULL DEFAULT '{}'::jsonb;
+`
+
+const AddForgeConfigColumnQuery = `
+ALTER TABLE user_configs ADD COLUMN IF NOT EXISTS forgeconfig JSONB NOT NULL DEFAULT '{}'::jsonb;
+`
+
+const AddMinionConfigColumnQuery = `
+ALTER TABLE user_configs ADD COLUMN IF NOT EXISTS minionconfig JSONB NOT NULL DEFAULT '{}'::jsonb;
+`
+
 const GetUserConfigByUserKeyHashQuery = `
-SELECT ahconfig, bzconfig FROM user_configs WHERE user_key_hash = $1;
+SELECT ahconfig, bzconfig, craftconfig, npcconfig, forgeconfig, minionconfig FROM user_configs WHERE user_key_hash = $1;
 `
 
 const GetUserConfigByUsernameQuery = `
-SELECT ahconfig, bzconfig FROM user_configs WHERE username = $1;
+SELECT ahconfig, bzconfig, craftconfig, npcconfig, forgeconfig, minionconfig FROM user_configs WHERE username = $1;
 `
 
 const DeleteUserConfigByUsernameQuery = `
@@ -31,8 +48,8 @@ DELETE FROM user_configs WHERE username = $1;
 `
 
 const InsertUserConfigQuery = `
-INSERT INTO user_configs (user_key_hash, username, ahconfig, bzconfig)
-VALUES ($1, $2, $3, $4);
+INSERT INTO user_configs (user_key_hash, username, ahconfig, bzconfig, craftconfig, npcconfig, forgeconfig, minionconfig)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
 `
 
 type ConfigTableClient struct {
@@ -48,6 +65,22 @@ func InitConfigTable(cl *DatabaseClient) *ConfigTableClient {
 	if err != nil {
 		panic("Unable to create user_configs table: " + err.Error())
 	}
+	_, err = cl.pool.Exec(ctx, AddCraftConfigColumnQuery)
+	if err != nil {
+		panic("Unable to add craftconfig to user_configs: " + err.Error())
+	}
+	_, err = cl.pool.Exec(ctx, AddNpcConfigColumnQuery)
+	if err != nil {
+		panic("Unable to add npcconfig to user_configs: " + err.Error())
+	}
+	_, err = cl.pool.Exec(ctx, AddForgeConfigColumnQuery)
+	if err != nil {
+		panic("Unable to add forgeconfig to user_configs: " + err.Error())
+	}
+	_, err = cl.pool.Exec(ctx, AddMinionConfigColumnQuery)
+	if err != nil {
+		panic("Unable to add minionconfig to user_configs: " + err.Error())
+	}
 
 	return &ConfigTableClient{
 		pool: cl.pool,
@@ -82,11 +115,7 @@ func (cl *ConfigTableClient) SaveConfig(userKeyHash string, username string, use
 
 // saveDefaultConfig creates and saves a new default configuration for a user.
 func (cl *ConfigTableClient) saveDefaultConfig(ctx context.Context, userKeyHash string, username string) error {
-	defaultConfig := &config.UserConfig{
-		AhConfig: *config.GenerateDefaultAHConfig(),
-		BzConfig: *config.GenerateDefaultBZConfig(),
-	}
-	return cl.upsertConfig(ctx, userKeyHash, username, defaultConfig)
+	return cl.upsertConfig(ctx, userKeyHash, username, config.GenerateDefaultUserConfig())
 }
 
 // transferConfig effectively re-associates an existing configuration with a new userKeyHash.
@@ -104,6 +133,22 @@ func (cl *ConfigTableClient) upsertConfig(ctx context.Context, userKeyHash strin
 	if err != nil {
 		return err
 	}
+	craftConfigJSON, err := json.Marshal(userConfig.CraftConfig)
+	if err != nil {
+		return err
+	}
+	npcConfigJSON, err := json.Marshal(userConfig.NpcConfig)
+	if err != nil {
+		return err
+	}
+	forgeConfigJSON, err := json.Marshal(userConfig.ForgeConfig)
+	if err != nil {
+		return err
+	}
+	minionConfigJSON, err := json.Marshal(userConfig.MinionConfig)
+	if err != nil {
+		return err
+	}
 
 	tx, err := cl.pool.Begin(ctx)
 	if err != nil {
@@ -116,7 +161,7 @@ func (cl *ConfigTableClient) upsertConfig(ctx context.Context, userKeyHash strin
 		return err
 	}
 
-	_, err = tx.Exec(ctx, InsertUserConfigQuery, userKeyHash, username, ahConfigJSON, bzConfigJSON)
+	_, err = tx.Exec(ctx, InsertUserConfigQuery, userKeyHash, username, ahConfigJSON, bzConfigJSON, craftConfigJSON, npcConfigJSON, forgeConfigJSON, minionConfigJSON)
 	if err != nil {
 		return err
 	}
@@ -129,12 +174,12 @@ func (cl *ConfigTableClient) GetConfig(userKeyHash string) (*config.UserConfig,
 	ctx, cancel := getContext()
 	defer cancel()
 
-	var ahConfigRaw, bzConfigRaw []byte
-	err := cl.pool.QueryRow(ctx, GetUserConfigByUserKeyHashQuery, userKeyHash).Scan(&ahConfigRaw, &bzConfigRaw)
+	var ahConfigRaw, bzConfigRaw, craftConfigRaw, npcConfigRaw, forgeConfigRaw, minionConfigRaw []byte
+	err := cl.pool.QueryRow(ctx, GetUserConfigByUserKeyHashQuery, userKeyHash).Scan(&ahConfigRaw, &bzConfigRaw, &craftConfigRaw, &npcConfigRaw, &forgeConfigRaw, &minionConfigRaw)
 	if err != nil {
 		return nil, err
 	}
-	return unmarshalConfig(ahConfigRaw, bzConfigRaw)
+	return unmarshalConfig(ahConfigRaw, bzConfigRaw, craftConfigRaw, npcConfigRaw, forgeConfigRaw, minionConfigRaw)
 }
 
 // GetConfigByUsername retrieves a user's config by their username
@@ -142,16 +187,16 @@ func (cl *ConfigTableClient) GetConfigByUsername(username string) (*config.UserC
 	ctx, cancel := getContext()
 	defer cancel()
 
-	var ahConfigRaw, bzConfigRaw []byte
-	err := cl.pool.QueryRow(ctx, GetUserConfigByUsernameQuery, username).Scan(&ahConfigRaw, &bzConfigRaw)
+	var ahConfigRaw, bzConfigRaw, craftConfigRaw, npcConfigRaw, forgeConfigRaw, minionConfigRaw []byte
+	err := cl.pool.QueryRow(ctx, GetUserConfigByUsernameQuery, username).Scan(&ahConfigRaw, &bzConfigRaw, &craftConfigRaw, &npcConfigRaw, &forgeConfigRaw, &minionConfigRaw)
 	if err != nil {
 		return nil, err
 	}
-	return unmarshalConfig(ahConfigRaw, bzConfigRaw)
+	return unmarshalConfig(ahConfigRaw, bzConfigRaw, craftConfigRaw, npcConfigRaw, forgeConfigRaw, minionConfigRaw)
 }
 
 // unmarshalConfig to reduce code duplication
-func unmarshalConfig(ahConfigRaw, bzConfigRaw []byte) (*config.UserConfig, error) {
+func unmarshalConfig(ahConfigRaw, bzConfigRaw, craftConfigRaw, npcConfigRaw, forgeConfigRaw, minionConfigRaw []byte) (*config.UserConfig, error) {
 	var cfg config.UserConfig
 	if err := json.Unmarshal(ahConfigRaw, &cfg.AhConfig); err != nil {
 		return nil, err
@@ -159,6 +204,23 @@ func unmarshalConfig(ahConfigRaw, bzConfigRaw []byte) (*config.UserConfig, error
 	if err := json.Unmarshal(bzConfigRaw, &cfg.BzConfig); err != nil {
 		return nil, err
 	}
+	// on top of the defaults, so old rows ('{}') and fields added later get sane values
+	cfg.CraftConfig = *config.GenerateDefaultCraftConfig()
+	if err := json.Unmarshal(craftConfigRaw, &cfg.CraftConfig); err != nil {
+		return nil, err
+	}
+	cfg.NpcConfig = *config.GenerateDefaultNPCConfig()
+	if err := json.Unmarshal(npcConfigRaw, &cfg.NpcConfig); err != nil {
+		return nil, err
+	}
+	cfg.ForgeConfig = *config.GenerateDefaultForgeConfig()
+	if err := json.Unmarshal(forgeConfigRaw, &cfg.ForgeConfig); err != nil {
+		return nil, err
+	}
+	cfg.MinionConfig = *config.GenerateDefaultMinionConfig()
+	if err := json.Unmarshal(minionConfigRaw, &cfg.MinionConfig); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 